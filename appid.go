@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// guardAppID return the app id the target database must be tagged with, see Options.AppID.
+func (m *Migration) guardAppID() string {
+	if m.opts.AppID != "" {
+		return m.opts.AppID
+	}
+	return m.appID
+}
+
+// queryAppID return the app id the target database is tagged with, empty if it is not tagged yet.
+func (o *Options) queryAppID(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `select to_regclass($1) is not null`, o.appIDIdent()).Scan(&exists); err != nil || !exists {
+		return "", err
+	}
+	var id string
+	err := conn.QueryRow(ctx, `select app_id from `+o.appIDIdent()).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return id, err
+}
+
+// checkAppID return *InvalidAppIDError if the target database is tagged with different app id,
+// and report whether it is not tagged yet. it is no-op when there is no app id to guard.
+func (m *Migration) checkAppID(ctx context.Context, conn *pgx.Conn) (untagged bool, err error) {
+	expected := m.guardAppID()
+	if expected == "" {
+		return false, nil
+	}
+	actual, err := m.opts.queryAppID(ctx, conn)
+	if err != nil {
+		return false, err
+	}
+	if actual != "" && actual != expected {
+		return false, &InvalidAppIDError{Expected: expected, Actual: actual}
+	}
+	return actual == "", nil
+}
+
+func (o *Options) tagAppIDSQL() string {
+	return `insert into ` + o.appIDIdent() + `(app_id) values ($1)`
+}
+
+// enforceAppID is checkAppID for the functions that modify the database, it also tag the untagged database,
+// in the same transaction as the modification when conn is in transaction.
+func (m *Migration) enforceAppID(ctx context.Context, conn *pgx.Conn) error {
+	untagged, err := m.checkAppID(ctx, conn)
+	if err != nil || !untagged {
+		return err
+	}
+	_, err = conn.Exec(ctx, m.opts.tagAppIDSQL(), m.guardAppID())
+	return err
+}
+
+// enforceAppIDSQLTx is like enforceAppID, but inside tx.
+func (m *Migration) enforceAppIDSQLTx(ctx context.Context, tx *sql.Tx) error {
+	expected := m.guardAppID()
+	if expected == "" {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `select to_regclass($1) is not null`, m.opts.appIDIdent()).Scan(&exists); err != nil {
+		return err
+	}
+	var actual string
+	if exists {
+		err := tx.QueryRowContext(ctx, `select app_id from `+m.opts.appIDIdent()).Scan(&actual)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	if actual != "" {
+		if actual != expected {
+			return &InvalidAppIDError{Expected: expected, Actual: actual}
+		}
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, m.opts.tagAppIDSQL(), expected)
+	return err
+}
@@ -0,0 +1,44 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRunAppID(t *testing.T) {
+	target := testTarget(t)
+
+	billing := New(testSource("0001_a.sql", "create table test.a()"), WithAppID("billing"))
+	if _, err := billing.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	analytics := New(testSource(
+		appIDFile, "analytics\n",
+		"0001_a.sql", "create table test.a()",
+	))
+	var invalid *InvalidAppIDError
+	if _, err := analytics.Check(target); !errors.As(err, &invalid) || invalid.Expected != "analytics" || invalid.Actual != "billing" {
+		t.Fatalf("Check should return InvalidAppIDError, got %v", err)
+	}
+	if _, err := analytics.Run(target); !errors.As(err, &invalid) {
+		t.Fatalf("Run should return InvalidAppIDError, got %v", err)
+	}
+	for name, f := range map[string]func() error{
+		"Rollback":                 func() error { _, err := analytics.Rollback(target, 1); return err },
+		"Baseline":                 func() error { return analytics.Baseline(target, "0001_a.sql") },
+		"UnsafeMarkAsExecutedMany": func() error { return analytics.UnsafeMarkAsExecutedMany(target, []string{"0001_a.sql"}) },
+		"ClearDirty":               func() error { return analytics.ClearDirty(target, "0001_a.sql") },
+	} {
+		if err := f(); !errors.As(err, &invalid) {
+			t.Fatalf("%s should return InvalidAppIDError, got %v", name, err)
+		}
+	}
+
+	if list, err := New(testSource(appIDFile, "billing", "0001_a.sql", "create table test.a()")).Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("app id from the source should match, got %v, %v", list, err)
+	}
+	if _, err := New(testSource("0001_a.sql", "create table test.a()")).Check(target); err != nil {
+		t.Fatalf("migration without app id should not be guarded, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package migration
+
+// Baseline adopt existing database that already has the schema, but was never migrated by this package,
+// by recording the migrations up to and including upTo as executed, without executing them, so Run only
+// execute the newer ones. it is like UnsafeMarkAsExecuted for the whole range.
+//
+// it is done in the same locked transaction as Run, and return *MetaNotEmptyError if the meta table
+// already has rows, to avoid baselining twice. will return *UnknownMigrationError if upTo is not found in the source,
+// or *InvalidAppIDError like Run.
+func (m *Migration) Baseline(target, upTo string) error {
+	last, ok := m.revEntries[upTo]
+	if !ok {
+		return &UnknownMigrationError{ID: upTo}
+	}
+
+	r, err := m.begin(bgCtx, target)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	if err := m.enforceAppID(r.ctx, r.conn); err != nil {
+		return err
+	}
+	var count int
+	if err := r.conn.QueryRow(r.ctx, `select count(*) from `+m.opts.metaIdent()).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return &MetaNotEmptyError{Count: count}
+	}
+
+	for _, e := range m.entries[:last+1] {
+		if _, err := r.conn.Exec(r.ctx, m.opts.recordSQL(e), m.opts.insertArgs(e, r.chain, r.serverVersion, nil)...); err != nil {
+			return err
+		}
+		r.chain = chainLink(r.chain, e.id, e.hash)
+	}
+
+	return r.commit()
+}
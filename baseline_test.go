@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	target := testTarget(t)
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, `create schema test; create table test.a(); create table test.b()`); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+	var unknown *UnknownMigrationError
+	if err := m.Baseline(target, "0009_x.sql"); !errors.As(err, &unknown) {
+		t.Fatalf("should return UnknownMigrationError, got %v", err)
+	}
+	if err := m.Baseline(target, "0002_b.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := m.Check(target); err != nil || !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+		t.Fatalf("only newer migration should be pending, got %v, %v", list, err)
+	}
+	if err := m.VerifyChain(target); err != nil {
+		t.Fatal(err)
+	}
+
+	var notEmpty *MetaNotEmptyError
+	if err := m.Baseline(target, "0002_b.sql"); !errors.As(err, &notEmpty) || notEmpty.Count != 2 {
+		t.Fatalf("should return MetaNotEmptyError, got %v", err)
+	}
+
+	if list, err := m.Run(target); err != nil || !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+		t.Fatalf("Run should only execute newer migration, got %v, %v", list, err)
+	}
+}
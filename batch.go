@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// batchMarker is raised as notice before each migration in single batch, followed by the migration id,
+// so the failed migration can be identified.
+const batchMarker = "psql-migration:batch "
+
+// canBatch report whether list can be executed in single batch, see Options.SingleBatch.
+func (m *Migration) canBatch(list []string) bool {
+	if m.opts.BeforeEach != nil || m.opts.AfterEach != nil || m.opts.OnResult != nil || m.opts.DelayBetween > 0 ||
+		m.opts.SplitStatements {
+		return false
+	}
+	for _, id := range list {
+		if e := m.entries[m.revEntries[id]]; e.expectRows != nil || e.noTx {
+			return false
+		}
+	}
+	return true
+}
+
+// execBatch exec and record all migrations in list with single Exec.
+func (r *runner) execBatch(list []string) error {
+	var b strings.Builder
+	for _, id := range list {
+		e := r.m.entries[r.m.revEntries[id]]
+		b.WriteString(`set local client_min_messages to notice;`)
+		b.WriteString(`do $psql_migration$ begin raise notice '%', ` + quoteLiteral(batchMarker+e.id) + `; end $psql_migration$;`)
+		// newline in case the statement end with line comment
+		b.WriteString(r.m.opts.statementPrefix() + e.statement + "\n;")
+		b.WriteString(inlineArgs(r.m.opts.recordSQL(e), r.m.opts.insertArgs(e, r.chain, r.serverVersion, nil)) + ";")
+		r.chain = chainLink(r.chain, e.id, e.hash)
+	}
+
+	r.nestedTxDetected = false
+	r.batchCurrent = ""
+	if _, err := r.conn.Exec(r.ctx, b.String()); err != nil {
+		return r.m.opts.execError(r.batchCurrent, 0, err)
+	}
+	if r.nestedTxDetected {
+		return &NestedTransactionError{ID: r.batchCurrent}
+	}
+	return nil
+}
+
+var placeholderRegexp = regexp.MustCompile(`\$[0-9]+`)
+
+// inlineArgs replace the $n placeholders in sql with args as literals, args must be string, *string, or *int64.
+func inlineArgs(sql string, args []any) string {
+	return placeholderRegexp.ReplaceAllStringFunc(sql, func(p string) string {
+		i, _ := strconv.Atoi(p[1:])
+		switch v := args[i-1].(type) {
+		case string:
+			return quoteLiteral(v)
+		case *string:
+			if v == nil {
+				return "null"
+			}
+			return quoteLiteral(*v)
+		case *int64:
+			if v == nil {
+				return "null"
+			}
+			return strconv.FormatInt(*v, 10)
+		default:
+			panic(fmt.Sprintf("migration: cannot inline %T", v))
+		}
+	})
+}
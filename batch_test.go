@@ -0,0 +1,129 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInlineArgs(t *testing.T) {
+	s := "x"
+	got := inlineArgs(`insert into t values ($1, $2, $3, $10)`, []any{"it's $2", (*string)(nil), &s, 7: "", 8: "", 9: "ten"})
+	if want := `insert into t values ('it''s $2', null, 'x', 'ten')`; got != want {
+		t.Fatalf("invalid sql %s", got)
+	}
+}
+
+func TestCanBatch(t *testing.T) {
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "-- psql-migration:expect-rows >= 1\nupdate test.a set x = 1",
+	)
+	if m := New(source); !m.canBatch([]string{"0001_a.sql"}) || m.canBatch([]string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("migration with expect-rows should not be batched")
+	}
+	if New(source, func(o *Options) { o.DelayBetween = 1 }).canBatch([]string{"0001_a.sql"}) {
+		t.Fatalf("DelayBetween should not be batched")
+	}
+}
+
+// metaRows return the meta rows that should be the same regardless how the migrations executed.
+func metaRows(t *testing.T, target string) [][]any {
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+
+	rows, err := conn.Query(bgCtx, ``+
+		`select id, hash, normalized, prev_hash, deployment_id from `+new(Options).metaIdent()+` order by at, id`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ret [][]any
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, values)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestRunSingleBatch(t *testing.T) {
+	source := testSource(
+		"0001_a.sql", "create table test.a(id int); -- no newline at the end",
+		"0002_b.sql", "insert into test.a values (1), (2)",
+		"0003_c.sql", "create function test.f() returns int language sql as $$ select count(*)::int from test.a $$;",
+	)
+	opts := func(singleBatch bool) Option {
+		return func(o *Options) {
+			o.SingleBatch = singleBatch
+			o.StoreNormalized = true
+			o.DeploymentID = "deploy"
+		}
+	}
+
+	var results [][][]any
+	for _, singleBatch := range []bool{false, true} {
+		target := testTarget(t)
+		m := New(source, opts(singleBatch))
+		list, err := m.Run(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"0001_a.sql", "0002_b.sql", "0003_c.sql"}; !reflect.DeepEqual(list, want) {
+			t.Fatalf("invalid executed list %v", list)
+		}
+		if err := m.VerifyChain(target); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, metaRows(t, target))
+	}
+	if !reflect.DeepEqual(results[0], results[1]) {
+		t.Fatalf("single batch should have the same result:\n%v\n%v", results[0], results[1])
+	}
+
+	target := testTarget(t)
+	_, err := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "insert into test.a values (1)",
+		"0003_c.sql", "create table test.c()",
+	), opts(true)).Run(target)
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.ID != "0002_b.sql" {
+		t.Fatalf("should return ExecError of the failed migration, got %v", err)
+	}
+}
+
+func BenchmarkRunSingleBatch(b *testing.B) {
+	var nameAndContent []string
+	for i := 1; i <= 100; i++ {
+		nameAndContent = append(nameAndContent,
+			fmt.Sprintf("%04d_t.sql", i), fmt.Sprintf("create table test.t%d(id int)", i),
+		)
+	}
+	source := testSource(nameAndContent...)
+
+	for _, singleBatch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("SingleBatch=%v", singleBatch), func(b *testing.B) {
+			m := New(source, func(o *Options) { o.SingleBatch = singleBatch })
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				target := testTarget(b)
+				b.StartTimer()
+				if _, err := m.Run(target); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
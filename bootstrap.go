@@ -0,0 +1,40 @@
+package migration
+
+// Bootstrap only create the meta table if not exists, without executing any migration.
+//
+// it is for setup where privileged role create the meta table once, grant it to the role used
+// by the application, and the application run the migration with Options.AutoCreateMeta set to false.
+//
+// opts is usually WithSchema and WithTable, to locate the meta table.
+func Bootstrap(target string, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	conn, err := o.connect(bgCtx, target, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	_, err = conn.Exec(bgCtx, o.metaDDL())
+	return err
+}
+
+// IsInitialized report whether the meta table exists in the target database,
+// i.e. it was ever migrated or bootstrapped. it never create the meta table.
+//
+// opts is usually WithSchema and WithTable, to locate the meta table.
+func IsInitialized(target string, opts ...Option) (bool, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return false, err
+	}
+	conn, err := o.connectReadOnly(bgCtx, target)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(bgCtx)
+
+	return o.metaExists(bgCtx, conn)
+}
@@ -0,0 +1,68 @@
+package migration
+
+import "testing"
+
+func TestBootstrap(t *testing.T) {
+	target := testTarget(t)
+
+	if ok, err := IsInitialized(target); err != nil || ok {
+		t.Fatalf("should not be initialized yet, got %v, %v", ok, err)
+	}
+	if err := Bootstrap(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if exists, err := new(Options).metaExists(bgCtx, conn); err != nil || !exists {
+		t.Fatalf("meta table should be created, got %v, %v", exists, err)
+	}
+	if inDB, err := new(Options).queryMeta(bgCtx, conn); err != nil || len(inDB) != 0 {
+		t.Fatalf("no migration should be executed, got %v, %v", inDB, err)
+	}
+	if ok, err := IsInitialized(target); err != nil || !ok {
+		t.Fatalf("should be initialized, got %v, %v", ok, err)
+	}
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+	), func(o *Options) { o.AutoCreateMeta = false })
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AssertUpToDate(target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunWithoutAutoCreateMeta(t *testing.T) {
+	target := testTarget(t)
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+	), func(o *Options) { o.AutoCreateMeta = false })
+	if _, err := m.Run(target); err == nil {
+		t.Fatalf("should fail without meta table")
+	}
+}
+
+func TestIsInitialized(t *testing.T) {
+	target := testTarget(t)
+
+	if ok, err := IsInitialized(target); err != nil || ok {
+		t.Fatalf("should not be initialized yet, got %v, %v", ok, err)
+	}
+	if ok, err := IsInitialized(target); err != nil || ok {
+		t.Fatalf("IsInitialized should not create the meta table, got %v, %v", ok, err)
+	}
+
+	if _, err := New(testSource("0001_a.sql", "create table test.a()")).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := IsInitialized(target); err != nil || !ok {
+		t.Fatalf("should be initialized after Run, got %v, %v", ok, err)
+	}
+}
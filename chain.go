@@ -0,0 +1,109 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// chainLink return the prev_hash of the row applied after the row (prevHash, id, hash).
+func chainLink(prevHash, id, hash string) string {
+	sum := sha256.Sum256([]byte(prevHash + "\n" + id + "\n" + hash))
+	return hex.EncodeToString(sum[:])
+}
+
+// lastChainLinkSQL query the row applied last, the meta table must be locked.
+func (o *Options) lastChainLinkSQL() string {
+	return `select id, hash, coalesce(prev_hash, '') from ` + o.metaIdent() + ` order by at desc, id desc limit 1`
+}
+
+// queryLastChainLink return the prev_hash for the next row, the meta table must be locked.
+func (o *Options) queryLastChainLink(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var id, hash, prevHash string
+	err := conn.QueryRow(ctx, o.lastChainLinkSQL()).Scan(&id, &hash, &prevHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return chainLink(prevHash, id, hash), nil
+}
+
+type chainRow struct {
+	id       string
+	hash     string
+	prevHash *string // nil for row applied before the chain is introduced
+}
+
+// VerifyChain verify the checksum chain in the meta table.
+//
+// each row applied by Run store prev_hash, the checksum of the row applied before it, so modifying or
+// deleting a historical row break the chain. it return *ChainBrokenError at the first broken link.
+//
+// rows applied before the chain is introduced are not verified, but they are still covered by the first
+// row after them. the last applied row is only protected once another row chain to it.
+// note that hash repaired by Options.OnDrift and UnsafeMarkAsExecuted, and re-executed repeatable migration
+// also break the chain.
+//
+// VerifyChain never modify the database.
+func (m *Migration) VerifyChain(target string) error {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	if exists, err := m.opts.metaExists(bgCtx, conn); err != nil || !exists {
+		return err
+	}
+
+	rows, err := conn.Query(bgCtx, ``+
+		`select id, hash, prev_hash from `+m.opts.metaIdent()+` order by at, id`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var chain []chainRow
+	for rows.Next() {
+		var r chainRow
+		if err := rows.Scan(&r.id, &r.hash, &r.prevHash); err != nil {
+			return err
+		}
+		chain = append(chain, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return verifyChain(chain)
+}
+
+func verifyChain(chain []chainRow) error {
+	link := ""
+	started := false
+	for i, r := range chain {
+		prevHash := ""
+		if r.prevHash == nil {
+			if started {
+				return &ChainBrokenError{AtID: r.id}
+			}
+		} else {
+			if *r.prevHash != link {
+				if i == 0 {
+					return &ChainBrokenError{AtID: r.id}
+				}
+				return &ChainBrokenError{AtID: chain[i-1].id}
+			}
+			prevHash = *r.prevHash
+			started = true
+		}
+		link = chainLink(prevHash, r.id, r.hash)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyChain(t *testing.T) {
+	str := func(s string) *string { return &s }
+	build := func(ids ...string) []chainRow {
+		var ret []chainRow
+		link := ""
+		for _, id := range ids {
+			ret = append(ret, chainRow{id: id, hash: hash(id), prevHash: str(link)})
+			link = chainLink(link, id, hash(id))
+		}
+		return ret
+	}
+
+	if err := verifyChain(build("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := build("a", "b", "c")
+	chain[1].hash = "x"
+	var broken *ChainBrokenError
+	if err := verifyChain(chain); !errors.As(err, &broken) || broken.AtID != "b" {
+		t.Fatalf("modified hash should break the chain at b, got %v", err)
+	}
+
+	chain = build("a", "b", "c")
+	chain = append(chain[:1], chain[2:]...)
+	if err := verifyChain(chain); !errors.As(err, &broken) || broken.AtID != "a" {
+		t.Fatalf("deleted row should break the chain at a, got %v", err)
+	}
+
+	legacy := []chainRow{{id: "a", hash: hash("a")}, {id: "b", hash: hash("b")}}
+	chain = append(legacy, chainRow{id: "c", hash: hash("c"), prevHash: str(chainLink("", "b", hash("b")))})
+	if err := verifyChain(chain); err != nil {
+		t.Fatalf("legacy rows should not break the chain, got %v", err)
+	}
+
+	chain = append(chain, chainRow{id: "d", hash: hash("d")})
+	if err := verifyChain(chain); !errors.As(err, &broken) || broken.AtID != "d" {
+		t.Fatalf("row without prev_hash after the chain started should break it, got %v", err)
+	}
+}
+
+func TestRunVerifyChain(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+	for _, id := range []string{"0001_a.sql", "0002_b.sql"} {
+		if err := m.EnsureApplied(target, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifyChain(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := m.opts.connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, `update `+m.opts.metaIdent()+` set hash = 'x' where id = '0002_b.sql'`); err != nil {
+		t.Fatal(err)
+	}
+
+	var broken *ChainBrokenError
+	if err := m.VerifyChain(target); !errors.As(err, &broken) || broken.AtID != "0002_b.sql" {
+		t.Fatalf("should return ChainBrokenError at 0002_b.sql, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readConnFile read the connection string from path, surrounding whitespace is trimmed.
+//
+// the connection string usually contains password, so warning is printed to warn if the file is world-readable.
+func readConnFile(path string, warn io.Writer) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0o004 != 0 {
+		fmt.Fprintf(warn, "Warning: %s is world-readable, consider chmod 600\n", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	conn := strings.TrimSpace(string(data))
+	if conn == "" {
+		return "", fmt.Errorf("empty connection string in %s", path)
+	}
+	return conn, nil
+}
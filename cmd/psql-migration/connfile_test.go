@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConnFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dsn")
+	if err := os.WriteFile(path, []byte("postgres://u:p@localhost/db\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var warn bytes.Buffer
+	conn, err := readConnFile(path, &warn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != "postgres://u:p@localhost/db" {
+		t.Fatalf("invalid connection string %q", conn)
+	}
+	if warn.Len() != 0 {
+		t.Fatalf("should not warn, got %q", warn.String())
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConnFile(path, &warn); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warn.String(), "world-readable") {
+		t.Fatalf("should warn about world-readable file, got %q", warn.String())
+	}
+
+	if err := os.WriteFile(path, []byte(" \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConnFile(path, &warn); err == nil {
+		t.Fatalf("empty file should be rejected")
+	}
+}
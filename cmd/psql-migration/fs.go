@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// rootFS present dir as the only directory in the root,
+// which is the layout migration.New expect from an embed.FS.
+type rootFS struct {
+	dir fs.FileInfo
+	sub fs.FS
+}
+
+func (r *rootFS) Open(name string) (fs.File, error) {
+	switch {
+	case name == ".":
+		return &rootDir{r: r}, nil
+	case name == r.dir.Name():
+		return r.sub.Open(".")
+	case strings.HasPrefix(name, r.dir.Name()+"/"):
+		return r.sub.Open(strings.TrimPrefix(name, r.dir.Name()+"/"))
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+type rootDir struct {
+	r    *rootFS
+	done bool
+}
+
+func (d *rootDir) Stat() (fs.FileInfo, error) { return rootInfo{d.r.dir}, nil }
+func (d *rootDir) Read([]byte) (int, error)   { return 0, io.EOF }
+func (d *rootDir) Close() error               { return nil }
+
+func (d *rootDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.done {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.done = true
+	return []fs.DirEntry{fs.FileInfoToDirEntry(d.r.dir)}, nil
+}
+
+type rootInfo struct{ fs.FileInfo }
+
+func (rootInfo) Name() string { return "." }
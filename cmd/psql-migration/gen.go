@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// slugify lowercase s and replace every run of non alphanumeric character with underscore.
+func slugify(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, c := range strings.ToLower(s) {
+		if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			underscore = false
+			b.WriteRune(c)
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+// timestampPrefix return the migration prefix for t, used by the create command, "yyyymmddhhmmss" in UTC,
+// so migrations created in different branches are still ordered by their creation time.
+func timestampPrefix(t time.Time) string {
+	return t.UTC().Format("20060102150405")
+}
+
+// gen create a pair of "<prefix>_<slug>.sql" and "<prefix>_<slug>.down.sql" in dir,
+// it never overwrite existing file. description is written in the comment header with its whitespace collapsed,
+// so line break in it cannot end the comment.
+func gen(dir, prefix, description string) ([]string, error) {
+	slug := slugify(description)
+	if slug == "" {
+		return nil, errors.New("description must contains alphanumeric character")
+	}
+	name := prefix + "_" + slug
+
+	files := []struct{ path, content string }{
+		{
+			filepath.Join(dir, name+".sql"),
+			fmt.Sprintf("-- %s: %s\n\n", name, strings.Join(strings.Fields(description), " ")),
+		},
+		{
+			filepath.Join(dir, name+".down.sql"),
+			fmt.Sprintf("-- %s (down): reverse the changes of %s.sql\n\n", name, name),
+		},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			return nil, fmt.Errorf("file already exists: %s", f.path)
+		}
+	}
+
+	var created []string
+	for _, f := range files {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return created, err
+		}
+		_, err = file.WriteString(f.content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return created, err
+		}
+		created = append(created, f.path)
+	}
+
+	return created, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	migration "github.com/payfazz/psql-migration"
+)
+
+func TestSlugify(t *testing.T) {
+	for in, want := range map[string]string{
+		"Add users table":   "add_users_table",
+		"  add--Users!! 2 ": "add_users_2",
+		"already_slugified": "already_slugified",
+		"!!!":               "",
+	} {
+		if got := slugify(in); got != want {
+			t.Fatalf("slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGen(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0007_init.sql"), []byte("select 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run(&out, io.Discard, config{dir: dir}, []string{"gen", "Add users table"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"0008_add_users_table.sql", "0008_add_users_table.down.sql"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s should be created: %v", name, err)
+		}
+	}
+
+	source, err := dirFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := migration.New(source).All()
+	if len(all) != 2 || all[1].ID != "0008_add_users_table.sql" {
+		t.Fatalf("generated files should be loaded as a single migration: %v", all)
+	}
+
+	if _, err := gen(dir, "0008", "add users table"); err == nil {
+		t.Fatalf("gen should refuse to overwrite existing file")
+	}
+	created, err := gen(dir, "0009", "x\ndrop table users\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(created[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "-- 0009_x_drop_table_users: x drop table users\n\n" {
+		t.Fatalf("line break in the description should not end the comment, got %q", content)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	if p := timestampPrefix(time.Date(2024, 3, 5, 14, 7, 9, 0, time.FixedZone("WIB", 7*3600))); p != "20240305070709" {
+		t.Fatalf("invalid timestamp prefix %s", p)
+	}
+
+	dir := t.TempDir()
+	var out bytes.Buffer
+	if err := run(&out, io.Discard, config{dir: dir}, []string{"create", "Add users table"}); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^Created .*/\d{14}_add_users_table\.sql\nCreated .*/\d{14}_add_users_table\.down\.sql\n$`).MatchString(out.String()) {
+		t.Fatalf("invalid output %q", out.String())
+	}
+
+	if err := run(io.Discard, io.Discard, config{dir: dir}, []string{"create"}); err == nil {
+		t.Fatalf("create without description should be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	migration "github.com/payfazz/psql-migration"
+)
+
+// jsonStatus is the element of the array printed by check and status with -Format json.
+type jsonStatus struct {
+	ID          string     `json:"id"`
+	Hash        string     `json:"hash"`
+	Applied     bool       `json:"applied"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+	InSource    bool       `json:"inSource"`
+	HashMatches bool       `json:"hashMatches"`
+	Dirty       bool       `json:"dirty"`
+}
+
+func writeJSON(w io.Writer, v any) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// printCheckJSON print the pending migrations in list, with their hash from all.
+func printCheckJSON(w io.Writer, all []migration.Item, list []string) {
+	hashes := make(map[string]string, len(all))
+	for _, it := range all {
+		hashes[it.ID] = it.Hash
+	}
+	ret := make([]jsonStatus, len(list))
+	for i, id := range list {
+		ret[i] = jsonStatus{ID: id, Hash: hashes[id], InSource: true}
+	}
+	writeJSON(w, ret)
+}
+
+func printStatusJSON(w io.Writer, list []migration.MigrationStatus) {
+	ret := make([]jsonStatus, len(list))
+	for i, s := range list {
+		ret[i] = jsonStatus{
+			ID:          s.ID,
+			Hash:        s.Hash,
+			Applied:     s.Applied,
+			InSource:    s.InSource,
+			HashMatches: s.HashMatches,
+			Dirty:       s.Dirty,
+		}
+		if s.Applied {
+			at := s.AppliedAt
+			ret[i].AppliedAt = &at
+		}
+	}
+	writeJSON(w, ret)
+}
+
+// printErrorJSON is like printError, but as single json object, the details of errors from the library
+// are merged into it, along with their type name and code.
+func printErrorJSON(w io.Writer, err error) {
+	ret := map[string]any{}
+	var merr migration.Error
+	if errors.As(err, &merr) {
+		for k, v := range merr.Details() {
+			ret[k] = v
+		}
+		ret["type"] = strings.TrimPrefix(fmt.Sprintf("%T", merr), "*migration.")
+		ret["code"] = merr.Code()
+	}
+	ret["error"] = err.Error()
+
+	enc := json.NewEncoder(w)
+	enc.Encode(ret)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	migration "github.com/payfazz/psql-migration"
+)
+
+func TestPrintStatusJSON(t *testing.T) {
+	at := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	printStatusJSON(&buf, []migration.MigrationStatus{
+		{ID: "0001_a.sql", Hash: "a", InSource: true, Applied: true, AppliedAt: at, HashMatches: true},
+		{ID: "0002_b.sql", Hash: "b", InSource: true},
+	})
+
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{
+		{"id": "0001_a.sql", "hash": "a", "applied": true, "appliedAt": "2022-01-02T03:04:05Z", "inSource": true, "hashMatches": true, "dirty": false},
+		{"id": "0002_b.sql", "hash": "b", "applied": false, "inSource": true, "hashMatches": false, "dirty": false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	printCheckJSON(&buf, []migration.Item{{ID: "0001_a.sql", Hash: "a"}, {ID: "0002_b.sql", Hash: "b"}}, nil)
+	if out := buf.String(); out != "[]\n" {
+		t.Fatalf("no pending migration should be empty array, got %q", out)
+	}
+}
+
+func TestPrintErrorJSON(t *testing.T) {
+	var buf bytes.Buffer
+	printErrorJSON(&buf, fmt.Errorf("wrapped: %w", &migration.MismatchHashError{
+		Item:     migration.Item{ID: "0001_a.sql", Hash: "x"},
+		HashInDB: "y",
+	}))
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"error":      `wrapped: "0001_a.sql" has different hash in the database`,
+		"type":       "MismatchHashError",
+		"code":       "hash_mismatch",
+		"id":         "0001_a.sql",
+		"hash":       "x",
+		"hash_in_db": "y",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+
+	buf.Reset()
+	printErrorJSON(&buf, errors.New("plain"))
+	if out := buf.String(); out != `{"error":"plain"}`+"\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestRunFormat(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0001_a.sql"), []byte("select 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		format string
+		args   []string
+	}{
+		{"json", []string{"run"}},
+		{"json", []string{"gen", "x"}},
+		{"yaml", []string{"status"}},
+	} {
+		if err := run(io.Discard, io.Discard, config{dir: dir, format: c.format}, c.args); err == nil {
+			t.Fatalf("-Format %s with %v should be rejected", c.format, c.args)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	migration "github.com/payfazz/psql-migration"
+)
+
+// config is the flags used by run.
+type config struct {
+	dir     string
+	conn    string
+	verbose bool
+	dryRun  bool
+	files   string
+	format  string // "text" or "json", empty means "text"
+}
+
+func main() {
+	var c config
+	flag.StringVar(&c.dir, "Dir", "migrations", "directory containing the *.sql migration files")
+	flag.StringVar(&c.conn, "Conn", "", "postgres connection string")
+	connFile := flag.String("ConnFile", "", "file containing the postgres connection string, instead of -Conn")
+	flag.BoolVar(&c.verbose, "Verbose", false, "print more information")
+	flag.BoolVar(&c.dryRun, "DryRun", false, "execute the pending migrations by run in a transaction that is always rolled back")
+	flag.StringVar(&c.files, "Files", "", "comma-separated list or glob of migration files to apply by run, bypassing the normal ordering")
+	flag.StringVar(&c.format, "Format", "text", "output format of check and status, and of the error: text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [run|check|status|gen <description>|create <description>]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	fail := func(err error) {
+		if c.format == "json" {
+			printErrorJSON(os.Stderr, err)
+		} else {
+			printError(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+
+	if *connFile != "" {
+		if c.conn != "" {
+			fail(fmt.Errorf("-Conn and -ConnFile cannot be used together"))
+		}
+		var err error
+		if c.conn, err = readConnFile(*connFile, os.Stderr); err != nil {
+			fail(err)
+		}
+	}
+
+	if err := run(os.Stdout, os.Stderr, c, flag.Args()); err != nil {
+		fail(err)
+	}
+}
+
+func run(w, errW io.Writer, c config, args []string) error {
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	source, err := dirFS(c.dir)
+	if err != nil {
+		return err
+	}
+
+	var timings []timing
+	m, err := migration.NewE(source, func(o *migration.Options) {
+		o.AfterEach = func(id string, d time.Duration, err error) {
+			timings = append(timings, timing{id, d})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if (c.files != "" || c.dryRun) && cmd != "" && cmd != "run" {
+		return fmt.Errorf("-Files and -DryRun can only be used with run")
+	}
+	if c.files != "" && c.dryRun {
+		return fmt.Errorf("-Files and -DryRun cannot be used together")
+	}
+	switch c.format {
+	case "", "text":
+	case "json":
+		if cmd != "check" && cmd != "status" {
+			return fmt.Errorf("-Format json can only be used with check and status")
+		}
+	default:
+		return fmt.Errorf("unknown -Format: %s", c.format)
+	}
+
+	switch cmd {
+	case "", "run":
+		if c.dryRun {
+			list, err := m.DryRun(c.conn)
+			if err != nil {
+				return err
+			}
+			printDryRun(w, list)
+			break
+		}
+
+		var list []string
+		if c.files != "" {
+			ids, err := selectFiles(m.All(), c.files)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(errW, "WARNING: -Files bypasses the normal ordering, only these migrations are applied:")
+			for _, id := range ids {
+				fmt.Fprintln(errW, "WARNING:   "+id)
+			}
+			list, err = m.RunSpecific(c.conn, ids)
+		} else {
+			list, err = m.Run(c.conn)
+		}
+		if err != nil {
+			return err
+		}
+		printRun(w, list, timings, c.verbose)
+
+	case "check":
+		list, err := m.Check(c.conn)
+		if err != nil {
+			return err
+		}
+		if c.format == "json" {
+			printCheckJSON(w, m.All(), list)
+			break
+		}
+		printCheck(w, list)
+
+	case "status":
+		list, err := m.Status(c.conn)
+		if err != nil {
+			return err
+		}
+		if c.format == "json" {
+			printStatusJSON(w, list)
+			break
+		}
+		printStatus(w, list)
+
+	case "gen", "create":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s <description>", cmd)
+		}
+		prefix := m.NextID()
+		if cmd == "create" {
+			prefix = timestampPrefix(time.Now())
+		}
+		files, err := gen(c.dir, prefix, args[1])
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			fmt.Fprintln(w, "Created", f)
+		}
+
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+
+	return nil
+}
+
+// selectFiles return the ids of the migrations matching spec, a comma-separated list of file names or globs,
+// each of them must match at least one migration.
+func selectFiles(all []migration.Item, spec string) ([]string, error) {
+	var ids []string
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matched := false
+		for _, it := range all {
+			ok, err := filepath.Match(pattern, it.ID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -Files pattern %q: %w", pattern, err)
+			}
+			if ok {
+				matched = true
+				if !contains(ids, it.ID) {
+					ids = append(ids, it.ID)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no migration in the directory matches %q", pattern)
+		}
+	}
+	return ids, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+type timing struct {
+	id string
+	d  time.Duration
+}
+
+func printRun(w io.Writer, list []string, timings []timing, verbose bool) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "Nothing to migrate")
+		return
+	}
+	if verbose {
+		var total time.Duration
+		for _, t := range timings {
+			fmt.Fprintf(w, "Applied %s (%s)\n", t.id, t.d.Round(time.Millisecond))
+			total += t.d
+		}
+		fmt.Fprintf(w, "Migration complete: %d applied in %s\n", len(list), total.Round(time.Millisecond))
+		return
+	}
+	fmt.Fprintln(w, "Migration complete")
+}
+
+func printDryRun(w io.Writer, list []migration.PendingStatement) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "Nothing to migrate")
+		return
+	}
+	fmt.Fprintln(w, "Dry run succeeded, nothing is committed, these migrations would be applied:")
+	for _, s := range list {
+		fmt.Fprintln(w, "  "+s.ID)
+	}
+}
+
+func printCheck(w io.Writer, list []string) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "Database is up to date")
+		return
+	}
+	fmt.Fprintln(w, "Pending migrations:")
+	for _, id := range list {
+		fmt.Fprintln(w, "  "+id)
+	}
+}
+
+func printStatus(w io.Writer, list []migration.MigrationStatus) {
+	for _, s := range list {
+		switch {
+		case !s.InSource:
+			fmt.Fprintf(w, "  deleted  %s (applied %s)\n", s.ID, s.AppliedAt.Format(time.RFC3339))
+		case !s.Applied:
+			fmt.Fprintf(w, "  pending  %s\n", s.ID)
+		case s.Dirty:
+			fmt.Fprintf(w, "  dirty    %s (started %s)\n", s.ID, s.AppliedAt.Format(time.RFC3339))
+		case !s.HashMatches:
+			fmt.Fprintf(w, "  changed  %s (applied %s)\n", s.ID, s.AppliedAt.Format(time.RFC3339))
+		default:
+			fmt.Fprintf(w, "  applied  %s (%s)\n", s.ID, s.AppliedAt.Format(time.RFC3339))
+		}
+	}
+}
+
+// printError print err, errors from the library are printed with their code and details.
+func printError(w io.Writer, err error) {
+	var merr migration.Error
+	if !errors.As(err, &merr) {
+		fmt.Fprintln(w, "Error:", err)
+		return
+	}
+
+	fmt.Fprintf(w, "Error [%s]: %s\n", merr.Code(), merr.Error())
+	details := merr.Details()
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %v\n", k, details[k])
+	}
+
+	var mismatch *migration.MismatchHashError
+	if errors.As(err, &mismatch) {
+		fmt.Fprintf(w, "%s was changed after it was applied, revert the change and add a new migration instead\n", mismatch.ID)
+	}
+}
+
+func dirFS(dir string) (*rootFS, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", dir)
+	}
+	return &rootFS{info, os.DirFS(dir)}, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	migration "github.com/payfazz/psql-migration"
+)
+
+func TestPrintRunVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	printRun(&buf, []string{"0001_a.sql", "0002_b.sql"}, []timing{
+		{"0001_a.sql", 1500 * time.Millisecond},
+		{"0002_b.sql", 20 * time.Millisecond},
+	}, true)
+
+	out := buf.String()
+	for _, want := range []string{
+		"Applied 0001_a.sql (1.5s)",
+		"Applied 0002_b.sql (20ms)",
+		"Migration complete: 2 applied in 1.52s",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output should contains %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrintRunNotVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	printRun(&buf, []string{"0001_a.sql"}, []timing{{"0001_a.sql", time.Second}}, false)
+	if out := buf.String(); out != "Migration complete\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestPrintDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	printDryRun(&buf, []migration.PendingStatement{{ID: "0001_a.sql"}, {ID: "0002_b.sql"}})
+	expected := "" +
+		"Dry run succeeded, nothing is committed, these migrations would be applied:\n" +
+		"  0001_a.sql\n" +
+		"  0002_b.sql\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	buf.Reset()
+	printDryRun(&buf, nil)
+	if out := buf.String(); out != "Nothing to migrate\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestRunFlagConflict(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0001_a.sql"), []byte("select 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		config config
+		args   []string
+	}{
+		{config{dir: dir, dryRun: true}, []string{"check"}},
+		{config{dir: dir, files: "0001_a.sql"}, []string{"status"}},
+		{config{dir: dir, dryRun: true, files: "0001_a.sql"}, []string{"run"}},
+	} {
+		if err := run(io.Discard, io.Discard, c.config, c.args); err == nil {
+			t.Fatalf("%+v %v should be rejected", c.config, c.args)
+		}
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	at := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	printStatus(&buf, []migration.MigrationStatus{
+		{ID: "0001_a.sql", InSource: true, Applied: true, AppliedAt: at, HashMatches: true},
+		{ID: "0002_b.sql", InSource: true, Applied: true, AppliedAt: at},
+		{ID: "0003_c.sql", InSource: true},
+		{ID: "0004_d.sql", InSource: true, Applied: true, AppliedAt: at, HashMatches: true, Dirty: true},
+		{ID: "0000_x.sql", Applied: true, AppliedAt: at},
+	})
+	expected := "" +
+		"  applied  0001_a.sql (2022-01-02T03:04:05Z)\n" +
+		"  changed  0002_b.sql (applied 2022-01-02T03:04:05Z)\n" +
+		"  pending  0003_c.sql\n" +
+		"  dirty    0004_d.sql (started 2022-01-02T03:04:05Z)\n" +
+		"  deleted  0000_x.sql (applied 2022-01-02T03:04:05Z)\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0002_b.sql", "0001_a.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("select 1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source, err := dirFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := migration.New(source).All()
+	if len(all) != 2 || all[0].ID != "0001_a.sql" || all[1].ID != "0002_b.sql" {
+		t.Fatalf("unexpected entries: %v", all)
+	}
+}
+
+func TestPrintError(t *testing.T) {
+	var buf bytes.Buffer
+	printError(&buf, fmt.Errorf("wrapped: %w", &migration.MismatchHashError{
+		Item:     migration.Item{ID: "0001_a.sql", Hash: "x"},
+		HashInDB: "y",
+	}))
+	want := "" +
+		"Error [hash_mismatch]: \"0001_a.sql\" has different hash in the database\n" +
+		"  hash: x\n" +
+		"  hash_in_db: y\n" +
+		"  id: 0001_a.sql\n" +
+		"0001_a.sql was changed after it was applied, revert the change and add a new migration instead\n"
+	if out := buf.String(); out != want {
+		t.Fatalf("invalid output:\n%s", out)
+	}
+
+	buf.Reset()
+	printError(&buf, errors.New("plain"))
+	if out := buf.String(); out != "Error: plain\n" {
+		t.Fatalf("invalid output: %q", out)
+	}
+}
+
+func TestSelectFiles(t *testing.T) {
+	all := []migration.Item{{ID: "0001_a.sql"}, {ID: "0002_b.sql"}, {ID: "0003_c.sql"}, {ID: "r__view.sql"}}
+
+	ids, err := selectFiles(all, "0003_c.sql, 000[12]_*.sql,0001_a.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0003_c.sql", "0001_a.sql", "0002_b.sql"}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("invalid selected files %v, want %v", ids, want)
+	}
+
+	if _, err := selectFiles(all, "0001_a.sql,0004_d.sql"); err == nil || !strings.Contains(err.Error(), "0004_d.sql") {
+		t.Fatalf("missing file should be reported, got %v", err)
+	}
+	if _, err := selectFiles(all, "[.sql"); err == nil {
+		t.Fatalf("invalid pattern should be reported")
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	target := os.Getenv("PSQL_MIGRATION_TEST_TARGET")
+	if target == "" {
+		t.Skip("PSQL_MIGRATION_TEST_TARGET is not set")
+	}
+	conn, err := pgx.Connect(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(context.Background(), ``+
+		`drop schema if exists go_migration cascade;`+
+		`drop schema if exists test cascade;`+
+		`create schema test`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"0001_a.sql": "create table test.a()",
+		"0002_b.sql": "create table test.b()",
+		"0003_c.sql": "create table test.c()",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out, warn bytes.Buffer
+	if err := run(&out, &warn, config{dir: dir, conn: target, files: "0002_*.sql"}, []string{"run"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warn.String(), "WARNING") || !strings.Contains(warn.String(), "0002_b.sql") {
+		t.Fatalf("should warn about the bypassed ordering, got:\n%s", warn.String())
+	}
+
+	out.Reset()
+	if err := run(&out, io.Discard, config{dir: dir, conn: target}, []string{"check"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Pending migrations:\n  0001_a.sql\n  0003_c.sql\n"; out.String() != expected {
+		t.Fatalf("only the specified file should be applied, got:\n%s", out.String())
+	}
+
+	if err := run(&out, io.Discard, config{dir: dir, conn: target, files: "0004_d.sql"}, []string{"run"}); err == nil {
+		t.Fatalf("file not in the directory should be rejected")
+	}
+}
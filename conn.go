@@ -0,0 +1,36 @@
+package migration
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RunConn is like RunContext, but use conn owned by the caller instead of connecting to target,
+// so its TLS, credentials, and dialer configuration are kept. conn is not closed.
+//
+// the migrations are executed with the same locked serializable transaction as Run, conn must not be
+// in transaction already. each migration is executed after "reset all", so session parameters changed
+// by "set" are reset to their defaults.
+//
+// psql-migration cannot hook the notices of conn, so nested "begin" inside migration is not detected
+// (see *NestedTransactionError), and Options.SingleBatch is ignored.
+func (m *Migration) RunConn(ctx context.Context, conn *pgx.Conn) ([]string, error) {
+	return m.opts.retry(ctx, runAttempt(
+		func() (*runner, error) { return m.beginConn(ctx, conn) },
+		func(r *runner) ([]string, error) {
+			return m.run(r, nil, func(remaining []string) error { return m.verifyConn(ctx, conn, remaining) })
+		},
+	))
+}
+
+// RunPool is like RunConn, with connection acquired from pool, it is released back at the end.
+func (m *Migration) RunPool(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Release()
+	return m.RunConn(ctx, c.Conn())
+}
@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestRunConn(t *testing.T) {
+	target := testTarget(t)
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	), func(o *Options) { o.PostCommitVerify = true })
+	list, err := m.RunConn(ctx, conn)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("should run all migrations, got %v, %v", list, err)
+	}
+
+	if conn.IsClosed() {
+		t.Fatalf("conn owned by the caller should not be closed")
+	}
+	if status := conn.PgConn().TxStatus(); status != 'I' {
+		t.Fatalf("conn should not be left in transaction, got %c", status)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("migrations should be committed, got %v, %v", list, err)
+	}
+}
+
+func TestRunPool(t *testing.T) {
+	target := testTarget(t)
+	ctx := context.Background()
+
+	pool, err := pgxpool.Connect(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+	))
+	if list, err := m.RunPool(ctx, pool); err != nil || len(list) != 1 {
+		t.Fatalf("should run all migrations, got %v, %v", list, err)
+	}
+	if list, err := m.RunPool(ctx, pool); err != nil || len(list) != 0 {
+		t.Fatalf("second run should be no-op, got %v, %v", list, err)
+	}
+	if stat := pool.Stat(); stat.AcquiredConns() != 0 {
+		t.Fatalf("connection should be released, got %d acquired", stat.AcquiredConns())
+	}
+}
@@ -0,0 +1,40 @@
+package migration
+
+// MigrationsForDeployment return the migrations executed with Options.DeploymentID set to depID,
+// in the order they were executed.
+//
+// MigrationsForDeployment never modify the database.
+func (m *Migration) MigrationsForDeployment(target, depID string) ([]Item, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(bgCtx)
+
+	if exists, err := m.opts.metaExists(bgCtx, conn); err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := conn.Query(bgCtx, ``+
+		`select id, hash from `+m.opts.metaIdent()+` where deployment_id = $1 order by at, id`,
+		depID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []Item
+	for rows.Next() {
+		var it Item
+		if err := rows.Scan(&it.ID, &it.Hash); err != nil {
+			return nil, err
+		}
+		ret = append(ret, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrationsForDeployment(t *testing.T) {
+	target := testTarget(t)
+	deployment := func(id string) Option {
+		return func(o *Options) { o.DeploymentID = id }
+	}
+
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	)
+	if _, err := New(source, deployment("deploy-1")).Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	source = testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	)
+	m := New(source, deployment("deploy-2"))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	all := m.All()
+	for depID, want := range map[string][]Item{
+		"deploy-1": all[:2],
+		"deploy-2": all[2:],
+		"deploy-3": nil,
+	} {
+		got, err := m.MigrationsForDeployment(target, depID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("invalid migrations for %s: %v", depID, got)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type diffOp struct {
+	kind byte // ' ', '-', or '+'
+	line string
+}
+
+// diffLines return the line operations to transform a into b, based on longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff return unified diff from a to b with 3 lines of context,
+// or empty string if they are equal.
+func unifiedDiff(aName, bName string, a, b []string) string {
+	const context = 3
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk while the next change is close enough
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k + 1
+			} else if k-end >= 2*context {
+				break
+			}
+		}
+
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+		to := end + context
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		aLine, bLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.line)
+		}
+
+		start = to
+	}
+	return out.String()
+}
+
+// DriftDiff return unified diff between the normalized text of migration id stored in the target database
+// and the normalized text of the current source, one statement per line,
+// empty string means no difference.
+//
+// the normalized text is only stored when the migration executed with Options.StoreNormalized,
+// otherwise *NormalizedNotStoredError is returned. will return *UnknownMigrationError if id is not found in the source.
+//
+// DriftDiff never modify the database.
+func (m *Migration) DriftDiff(target, id string) (string, error) {
+	i, ok := m.revEntries[id]
+	if !ok {
+		return "", &UnknownMigrationError{ID: id}
+	}
+
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(bgCtx)
+
+	exists, err := m.opts.metaExists(bgCtx, conn)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", &NormalizedNotStoredError{ID: id}
+	}
+
+	var stored *string
+	if err := conn.QueryRow(bgCtx, ``+
+		`select normalized from `+m.opts.metaIdent()+` where id = $1`,
+		id,
+	).Scan(&stored); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+	if stored == nil {
+		return "", &NormalizedNotStoredError{ID: id}
+	}
+
+	current := m.opts.normalizerFor(&m.entries[i]).normalize(m.entries[i].statement)
+	return unifiedDiff("database/"+id, "source/"+id, normalizedLines(*stored), normalizedLines(current)), nil
+}
+
+// normalizedLines split normalized text into one line per statement.
+func normalizedLines(normalized string) []string {
+	var ret []string
+	for _, l := range strings.SplitAfter(normalized, ";") {
+		if l != "" {
+			ret = append(ret, l)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package migration
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12", " ")
+	b := strings.Split("1 2 3 x 5 6 7 8 9 10 11 12 13", " ")
+
+	want := "" +
+		"--- a\n" +
+		"+++ b\n" +
+		"@@ -1,7 +1,7 @@\n" +
+		" 1\n 2\n 3\n-4\n+x\n 5\n 6\n 7\n" +
+		"@@ -10,3 +10,4 @@\n" +
+		" 10\n 11\n 12\n+13\n"
+	if d := unifiedDiff("a", "b", a, b); d != want {
+		t.Fatalf("invalid diff:\n%s", d)
+	}
+
+	if d := unifiedDiff("a", "b", a, a); d != "" {
+		t.Fatalf("equal input should have empty diff:\n%s", d)
+	}
+}
+
+func TestNormalizedLinesDiff(t *testing.T) {
+	n := normalizer{}
+	old := n.normalize("create table a(id int);\ninsert into a values (1);\ncreate table b(id int);")
+	cur := n.normalize("create table a(id int);\ninsert into a values (2);\ncreate table b(id int);")
+
+	want := "" +
+		"--- db\n" +
+		"+++ src\n" +
+		"@@ -1,3 +1,3 @@\n" +
+		" createtablea(idint);\n" +
+		"-insertintoavalues(1);\n" +
+		"+insertintoavalues(2);\n" +
+		" createtableb(idint)\n"
+	if d := unifiedDiff("db", "src", normalizedLines(old), normalizedLines(cur)); d != want {
+		t.Fatalf("invalid diff:\n%s", d)
+	}
+}
+
+func TestDriftDiff(t *testing.T) {
+	target := testTarget(t)
+	storeNormalized := func(o *Options) { o.StoreNormalized = true }
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(id int);",
+		"0002_b.sql", "create table test.b(id int);",
+	), storeNormalized)
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	m = New(testSource(
+		"0001_a.sql", "create table test.a(id int);",
+		"0002_b.sql", "create table test.b(id bigint);",
+	), storeNormalized)
+
+	if d, err := m.DriftDiff(target, "0001_a.sql"); err != nil || d != "" {
+		t.Fatalf("unchanged migration should have empty diff, got %q, %v", d, err)
+	}
+
+	d, err := m.DriftDiff(target, "0002_b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d, "-createtabletest.b(idint)\n") || !strings.Contains(d, "+createtabletest.b(idbigint)\n") {
+		t.Fatalf("diff should show the changed statement:\n%s", d)
+	}
+
+	var notStored *NormalizedNotStoredError
+	if _, err := New(testSource(
+		"0003_c.sql", "select 1",
+	)).DriftDiff(target, "0003_c.sql"); !errors.As(err, &notStored) {
+		t.Fatalf("should return NormalizedNotStoredError, got %v", err)
+	}
+}
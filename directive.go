@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"strconv"
+	"strings"
+)
+
+// directivePrefix start a directive, written as line comment in the migration,
+// like "-- psql-migration:expect-rows >= 1".
+const directivePrefix = "psql-migration:"
+
+type directive struct {
+	name string
+	arg  string
+	line int
+}
+
+// parseDirectives return the directives in sql, in order.
+func parseDirectives(sql string) []directive {
+	var ret []directive
+	for _, t := range scan(sql) {
+		if t.kind != tokenComment || !strings.HasPrefix(t.text, "--") {
+			continue
+		}
+		text := strings.TrimSpace(t.text[2:])
+		if !strings.HasPrefix(text, directivePrefix) {
+			continue
+		}
+		name, arg, _ := strings.Cut(text[len(directivePrefix):], " ")
+		ret = append(ret, directive{name: name, arg: strings.TrimSpace(arg), line: t.line})
+	}
+	return ret
+}
+
+// rowCountExpectation is the argument of expect-rows directive, like ">= 1".
+type rowCountExpectation struct {
+	op string
+	n  int64
+}
+
+// rowCountOps is ordered so that longer operator is matched first.
+var rowCountOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+func parseRowCountExpectation(s string) (rowCountExpectation, bool) {
+	for _, op := range rowCountOps {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(s[len(op):]), 10, 64)
+		if err != nil || n < 0 {
+			return rowCountExpectation{}, false
+		}
+		return rowCountExpectation{op: op, n: n}, true
+	}
+	return rowCountExpectation{}, false
+}
+
+func (x rowCountExpectation) match(got int64) bool {
+	switch x.op {
+	case "==":
+		return got == x.n
+	case "!=":
+		return got != x.n
+	case ">=":
+		return got >= x.n
+	case "<=":
+		return got <= x.n
+	case ">":
+		return got > x.n
+	case "<":
+		return got < x.n
+	default:
+		panic("unreachable")
+	}
+}
+
+func (x rowCountExpectation) String() string {
+	return x.op + " " + strconv.FormatInt(x.n, 10)
+}
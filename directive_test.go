@@ -0,0 +1,120 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	got := parseDirectives("" +
+		"-- psql-migration:expect-rows >= 1\r\n" +
+		"update a set x = 1; -- psql-migration:foo\n" +
+		"select '-- psql-migration:in-string';\n" +
+		"/* psql-migration:in-block-comment */\n" +
+		"--psql-migration:bar  baz \n",
+	)
+	want := []directive{
+		{name: "expect-rows", arg: ">= 1", line: 1},
+		{name: "foo", arg: "", line: 2},
+		{name: "bar", arg: "baz", line: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid directives %#v", got)
+	}
+}
+
+func TestRowCountExpectation(t *testing.T) {
+	tc := []struct {
+		s     string
+		got   int64
+		match bool
+	}{
+		{"== 1", 1, true},
+		{"==1", 2, false},
+		{"!= 0", 0, false},
+		{">= 1", 1, true},
+		{">= 1", 0, false},
+		{"> 1", 1, false},
+		{"<= 10", 10, true},
+		{"< 10", 10, false},
+	}
+	for _, c := range tc {
+		x, ok := parseRowCountExpectation(c.s)
+		if !ok {
+			t.Fatalf("cannot parse %q", c.s)
+		}
+		if x.match(c.got) != c.match {
+			t.Fatalf("%q match %d should be %v", c.s, c.got, c.match)
+		}
+	}
+
+	for _, s := range []string{"", "1", "= 1", ">= -1", ">= x", "=> 1"} {
+		if _, ok := parseRowCountExpectation(s); ok {
+			t.Fatalf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestLoadInvalidDirective(t *testing.T) {
+	for _, sql := range []string{
+		"-- psql-migration:expect-rows at least one\nselect 1",
+		"-- psql-migration:unknown\nselect 1",
+	} {
+		var derr *DirectiveError
+		if _, err := NewE(testSource("0001_a.sql", sql)); !errors.As(err, &derr) || !strings.Contains(err.Error(), "0001_a.sql at line 1") {
+			t.Fatalf("should fail to load %q, got %v", sql, err)
+		}
+	}
+}
+
+func TestRunExpectRows(t *testing.T) {
+	target := testTarget(t)
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(id int); insert into test.a values (1), (2);",
+		"0002_b.sql", "-- psql-migration:expect-rows == 2\nupdate test.a set id = id + 10 where id > 0",
+	))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	m = New(testSource(
+		"0001_a.sql", "create table test.a(id int); insert into test.a values (1), (2);",
+		"0002_b.sql", "-- psql-migration:expect-rows == 2\nupdate test.a set id = id + 10 where id > 0",
+		"0003_c.sql", "-- psql-migration:expect-rows >= 1\nupdate test.a set id = 0 where id = 1",
+	))
+	_, err := m.Run(target)
+	var rowCount *RowCountError
+	if !errors.As(err, &rowCount) || rowCount.ID != "0003_c.sql" || rowCount.Got != 0 || rowCount.Expected != ">= 1" {
+		t.Fatalf("should return RowCountError, got %v", err)
+	}
+}
+
+func TestRunPause(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "-- psql-migration:pause\ncreate table test.b()",
+		"0003_c.sql", "create table test.c()",
+		"0004_d.sql", "-- psql-migration:pause\ncreate table test.d()",
+	), func(o *Options) { o.PostCommitVerify = true })
+
+	list, err := m.Run(target)
+	var paused *PausedError
+	if !errors.As(err, &paused) || paused.NextID != "0003_c.sql" {
+		t.Fatalf("should return PausedError, got %v", err)
+	}
+	if !reflect.DeepEqual(list, []string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("should execute up to the paused migration, got %v", list)
+	}
+	if pending, err := m.Check(target); err != nil || !reflect.DeepEqual(pending, []string{"0003_c.sql", "0004_d.sql"}) {
+		t.Fatalf("executed migrations should be committed, got %v, %v", pending, err)
+	}
+
+	list, err = m.Run(target)
+	if err != nil || !reflect.DeepEqual(list, []string{"0003_c.sql", "0004_d.sql"}) {
+		t.Fatalf("should finish the rest without pausing at the last one, got %v, %v", list, err)
+	}
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// migration executed outside the transaction cannot be rolled back when it fail halfway, or when the process die,
+// so it is recorded as dirty before executed, and the flag is cleared after it succeed. the dirty row stay
+// in the meta table otherwise, and Run refuse to continue until it is resolved manually.
+
+// markDirty record e as dirty, it must be committed before e is executed, so the row persist even if e fail.
+func (r *runner) markDirty(e entry) error {
+	o := &r.m.opts
+	if _, err := r.conn.Exec(r.ctx, ``+
+		`insert into `+o.metaIdent()+`(id, hash, normalized, prev_hash, server_version, deployment_id, duration_ms, dirty, at) `+
+		`values ($1, $2, $3, $4, $5, $6, $7, true, clock_timestamp())`+upsertClause(e),
+		o.insertArgs(e, r.chain, r.serverVersion, nil)...,
+	); err != nil {
+		return err
+	}
+	r.chain = chainLink(r.chain, e.id, e.hash)
+	return nil
+}
+
+// clearDirty mark e, recorded by markDirty, as finished, d is how long it took.
+func (r *runner) clearDirty(e entry, d time.Duration) error {
+	_, err := r.conn.Exec(r.ctx, `update `+r.m.opts.metaIdent()+` set dirty = false, duration_ms = $2 where id = $1`, e.id, d.Milliseconds())
+	return err
+}
+
+// hasColumnSQL check whether the table $1 exists and has column $2, the meta table created by older version
+// doesn't have the newer columns until Run upgrade it, and the functions that never modify the database don't upgrade it.
+const hasColumnSQL = `` +
+	`select exists (select 1 from pg_attribute where attrelid = to_regclass($1) and attname = $2 and not attisdropped)`
+
+// metaHasColumn report whether the meta table exists and has column name, see hasColumnSQL.
+func (o *Options) metaHasColumn(ctx context.Context, conn *pgx.Conn, name string) (bool, error) {
+	var ok bool
+	err := conn.QueryRow(ctx, hasColumnSQL, o.metaIdent(), name).Scan(&ok)
+	return ok, err
+}
+
+func (o *Options) firstDirtySQL() string {
+	return `select id from ` + o.metaIdent() + ` where dirty order by at, id limit 1`
+}
+
+// checkDirty return *DirtyMigrationError if the meta table has dirty row.
+// meta table without the dirty column has no dirty row.
+func (o *Options) checkDirty(ctx context.Context, conn *pgx.Conn) error {
+	if hasDirty, err := o.metaHasColumn(ctx, conn, "dirty"); err != nil || !hasDirty {
+		return err
+	}
+	var id string
+	err := conn.QueryRow(ctx, o.firstDirtySQL()).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &DirtyMigrationError{ID: id}
+}
+
+// ClearDirty remove the dirty row of migration id, so it become pending again and Run can continue,
+// after the half-applied changes are reverted manually. if the changes are completed manually instead,
+// use UnsafeMarkAsExecuted.
+//
+// it is no-op if id is not dirty. will return *InvalidAppIDError like Run.
+func (m *Migration) ClearDirty(target string, id string) error {
+	conn, err := m.opts.setupConn(bgCtx, target, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	if _, err := m.checkAppID(bgCtx, conn); err != nil {
+		return err
+	}
+	_, err = conn.Exec(bgCtx, `delete from `+m.opts.metaIdent()+` where id = $1 and dirty`, id)
+	return err
+}
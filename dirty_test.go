@@ -0,0 +1,101 @@
+package migration
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDirty(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	)
+	m := New(source)
+
+	conn, err := m.opts.setupConn(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	r := &runner{m: m, ctx: bgCtx, conn: conn}
+
+	a := m.entries[m.revEntries["0001_a.sql"]]
+	if err := r.markDirty(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.clearDirty(a, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 1 || list[0] != "0002_b.sql" {
+		t.Fatalf("finished migration should be applied, got %v, %v", list, err)
+	}
+
+	b := m.entries[m.revEntries["0002_b.sql"]]
+	if err := r.markDirty(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var dirty *DirtyMigrationError
+	if _, err := m.Check(target); !errors.As(err, &dirty) || dirty.ID != "0002_b.sql" {
+		t.Fatalf("Check should return DirtyMigrationError, got %v", err)
+	}
+	if _, err := m.Run(target); !errors.As(err, &dirty) {
+		t.Fatalf("Run should return DirtyMigrationError, got %v", err)
+	}
+	db, err := sql.Open("pgx", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(bgCtx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.RunSQLTx(bgCtx, tx)
+	tx.Rollback()
+	if !errors.As(err, &dirty) {
+		t.Fatalf("RunSQLTx should return DirtyMigrationError, got %v", err)
+	}
+	status, err := m.Status(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || status[0].Dirty || !status[1].Dirty {
+		t.Fatalf("Status should report the dirty migration, got %v", status)
+	}
+
+	if err := m.ClearDirty(target, "0002_b.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 1 || list[0] != "0002_b.sql" {
+		t.Fatalf("cleared migration should be pending again, got %v, %v", list, err)
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckDirtyOldMeta(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource("0001_a.sql", "create table test.a()"))
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	// the meta table created by the first release, before the dirty column
+	if _, err := conn.Exec(bgCtx, ``+
+		`create schema if not exists `+quoteIdent(m.opts.metaSchemaName())+`;`+
+		`create table `+m.opts.metaIdent()+`(id text primary key, hash text, at timestamp with time zone default now())`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if list, err := m.Check(target); err != nil || len(list) != 1 {
+		t.Fatalf("Check should work against meta table without dirty column, got %v, %v", list, err)
+	}
+}
@@ -0,0 +1,90 @@
+package migration
+
+// PendingStatement is a migration that would be executed by Run.
+type PendingStatement struct {
+	ID        string
+	Statement string
+
+	// Normalized is Statement as normalized for hashing, without comments and insignificant whitespace
+	Normalized string
+}
+
+// DryRun execute the pending migrations exactly like Run, but always rollback at the end,
+// so nothing is committed, including the meta table created by Options.AutoCreateMeta.
+// the maintenance flag of Options.Maintenance is not set.
+//
+// will return the migrations that would be executed by Run, or the error that Run would return.
+//
+// with Options.DryRunContinueOnError, each migration is executed in its own savepoint, failed one is
+// rolled back to its savepoint and the rest are still executed, all failures are reported
+// together as *MultiDryRunError.
+//
+// migration with no-transaction directive is not executed, because it cannot be rolled back.
+func (m *Migration) DryRun(target string) ([]PendingStatement, error) {
+	r, err := m.beginDryRun(bgCtx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	list, err := r.check()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkPendingLimit(list); err != nil {
+		return nil, err
+	}
+
+	var ret []PendingStatement
+	var failures []Error
+	for _, l := range list {
+		e := m.entries[m.revEntries[l]]
+		ret = append(ret, PendingStatement{ID: e.id, Statement: e.statement, Normalized: m.opts.normalizerFor(&e).normalize(e.statement)})
+
+		if e.noTx {
+			// cannot be rolled back, so it is only recorded
+			if err := r.record(e, 0); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !m.opts.DryRunContinueOnError {
+			d, err := r.exec(e)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.record(e, d); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, err := r.conn.Exec(r.ctx, `savepoint psql_migration_dry_run`); err != nil {
+			return nil, err
+		}
+		d, err := r.exec(e)
+		if err != nil {
+			if failure, ok := err.(Error); ok {
+				if _, err := r.conn.Exec(r.ctx, `rollback to savepoint psql_migration_dry_run`); err != nil {
+					return nil, err
+				}
+				failures = append(failures, failure)
+				continue
+			}
+			return nil, err
+		}
+		if err := r.record(e, d); err != nil {
+			return nil, err
+		}
+		if _, err := r.conn.Exec(r.ctx, `release savepoint psql_migration_dry_run`); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(failures) > 0 {
+		return nil, &MultiDryRunError{Failures: failures}
+	}
+
+	return ret, nil
+}
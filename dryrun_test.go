@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDryRunContinueOnError(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_ok.sql", "create table test.a()",
+		"0002_syntax.sql", "create tabel test.b()",
+		"0003_missing.sql", "alter table test.missing add column x int",
+		"0004_ok.sql", "create table test.c()",
+		"0005_duplicate.sql", "create table test.a()",
+	), func(o *Options) { o.DryRunContinueOnError = true })
+
+	_, err := m.DryRun(target)
+	var multi *MultiDryRunError
+	if !errors.As(err, &multi) {
+		t.Fatalf("DryRun should return MultiDryRunError, got %v", err)
+	}
+
+	want := []struct{ id, sqlstate string }{
+		{"0002_syntax.sql", "42601"},
+		{"0003_missing.sql", "42P01"},
+		{"0005_duplicate.sql", "42P07"},
+	}
+	if len(multi.Failures) != len(want) {
+		t.Fatalf("invalid failures: %v", multi)
+	}
+	for i, w := range want {
+		d := multi.Failures[i].Details()
+		if d["id"] != w.id || d["sqlstate"] != w.sqlstate {
+			t.Fatalf("invalid failure #%d: %v", i, d)
+		}
+	}
+
+	list, err := m.Check(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 5 {
+		t.Fatalf("DryRun should not commit anything, pending: %v", list)
+	}
+}
+
+func TestMultiDryRunErrorMessage(t *testing.T) {
+	err := &MultiDryRunError{Failures: []Error{
+		&ExecError{ID: "a.sql", Err: errors.New("x")},
+		&ExecError{ID: "b.sql", Err: errors.New("y")},
+	}}
+	if msg := err.Error(); msg != `2 migration(s) failed in dry run: cannot execute "a.sql": x; cannot execute "b.sql": y` {
+		t.Fatalf("invalid message: %s", msg)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "-- table a\nCREATE TABLE test.a();",
+		"0002_b.sql", "create table test.b()",
+	))
+
+	list, err := m.DryRun(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "0001_a.sql" || list[1].ID != "0002_b.sql" {
+		t.Fatalf("invalid pending statements %v", list)
+	}
+	if list[0].Statement != "-- table a\nCREATE TABLE test.a();" || list[0].Normalized != "createtabletest.a()" {
+		t.Fatalf("invalid pending statement %+v", list[0])
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 2 {
+		t.Fatalf("DryRun should not commit anything, got %v, %v", list, err)
+	}
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if exists, err := m.opts.metaExists(bgCtx, conn); err != nil || exists {
+		t.Fatalf("DryRun should not leave the meta table behind, got %v, %v", exists, err)
+	}
+
+	_, err = New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create tabel test.b()",
+	)).DryRun(target)
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.ID != "0002_b.sql" {
+		t.Fatalf("broken migration should fail the dry run, got %v", err)
+	}
+}
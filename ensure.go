@@ -0,0 +1,59 @@
+package migration
+
+// EnsureApplied execute migration id, and only that migration, if it is not executed yet.
+//
+// it is executed in the same locked transaction as Run, it is no-op if the migration is already executed,
+// so it is safe to be called repeatedly.
+//
+// will return *UnknownMigrationError if id is not found in the source, *MissingPrerequisiteError if
+// the after directives of it are not executed yet, or *MismatchHashError like Run.
+func (m *Migration) EnsureApplied(target, id string) error {
+	i, ok := m.revEntries[id]
+	if !ok {
+		return &UnknownMigrationError{ID: id}
+	}
+	e := m.entries[i]
+
+	r, err := m.begin(bgCtx, target)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	list, err := r.check()
+	if err != nil {
+		return err
+	}
+	if !contains(list, id) {
+		return nil
+	}
+	if err := m.checkPrerequisites(m.notPending(list), []string{id}); err != nil {
+		return err
+	}
+
+	if e.noTx {
+		if err := r.execNoTx(e, nil); err != nil {
+			return err
+		}
+	} else {
+		d, err := r.exec(e)
+		if err != nil {
+			return err
+		}
+		m.metrics.observeDuration(d)
+		if err := r.record(e, d); err != nil {
+			return err
+		}
+		if len(e.replaces) > 0 {
+			if err := r.recordSquash(e); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.commit(); err != nil {
+		return err
+	}
+	m.metrics.addApplied(1)
+
+	return nil
+}
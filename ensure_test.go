@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEnsureApplied(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	))
+
+	for i := 0; i < 2; i++ {
+		if err := m.EnsureApplied(target, "0002_b.sql"); err != nil {
+			t.Fatalf("call #%d: %v", i, err)
+		}
+	}
+
+	list, err := m.Check(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"0001_a.sql"}) {
+		t.Fatalf("only 0002_b.sql should be applied, pending: %v", list)
+	}
+
+	if err := m.EnsureApplied(target, "9999_x.sql"); !errors.As(err, new(*UnknownMigrationError)) {
+		t.Fatalf("should return UnknownMigrationError, got %v", err)
+	}
+}
+
+func TestEnsureAppliedPrerequisite(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "-- psql-migration:after 0001_a.sql\ncreate table test.b()",
+	))
+
+	var missing *MissingPrerequisiteError
+	if err := m.EnsureApplied(target, "0002_b.sql"); !errors.As(err, &missing) || missing.RequiredID != "0001_a.sql" {
+		t.Fatalf("should return MissingPrerequisiteError, got %v", err)
+	}
+	if err := m.EnsureApplied(target, "0001_a.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.EnsureApplied(target, "0002_b.sql"); err != nil {
+		t.Fatalf("executed prerequisite should satisfy it, got %v", err)
+	}
+}
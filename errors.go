@@ -1,7 +1,28 @@
 package migration
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/jackc/pgconn"
+)
+
+// Error is implemented by every error type returned by this package,
+// so callers like the CLI can format them uniformly.
+type Error interface {
+	error
+
+	// Code is stable machine readable identifier of the error.
+	Code() string
+
+	// Details of the error, the keys are stable.
+	Details() map[string]any
+}
+
+// MismatchHashError is returned when migration ID was already executed in the database with HashInDB,
+// but it has different hash in the source, Hash. the id and the source hash are the embedded Item.
 type MismatchHashError struct {
 	Item
 	HashInDB string
@@ -10,3 +31,793 @@ type MismatchHashError struct {
 func (d *MismatchHashError) Error() string {
 	return fmt.Sprintf("\"%s\" has different hash in the database", d.ID)
 }
+
+func (d *MismatchHashError) Code() string { return "hash_mismatch" }
+
+func (d *MismatchHashError) Details() map[string]any {
+	return map[string]any{"id": d.ID, "hash": d.Hash, "hash_in_db": d.HashInDB}
+}
+
+// OrphanedMigrationError is returned when the database already execute migrations
+// that are not found in the source.
+type OrphanedMigrationError struct {
+	// Orphans contains the id and the hash stored in the database of every orphaned migration
+	Orphans []Item
+}
+
+func (o *OrphanedMigrationError) Error() string {
+	ids := make([]string, len(o.Orphans))
+	for i, it := range o.Orphans {
+		ids[i] = fmt.Sprintf("\"%s\"", it.ID)
+	}
+	return fmt.Sprintf("executed migration not found in the source: %s", strings.Join(ids, ", "))
+}
+
+func (o *OrphanedMigrationError) Code() string { return "orphaned_migration" }
+
+func (o *OrphanedMigrationError) Details() map[string]any {
+	ids := make([]string, len(o.Orphans))
+	for i, it := range o.Orphans {
+		ids[i] = it.ID
+	}
+	return map[string]any{"ids": ids}
+}
+
+// LockHeldError is returned by Run with Options.NoWait when the meta table, or the advisory lock with
+// Options.AdvisoryLock, is locked by another session.
+type LockHeldError struct {
+	Blockers []Blocker
+}
+
+func (l *LockHeldError) Error() string {
+	return "meta table is locked by another session" + describeBlockers(l.Blockers)
+}
+
+func (l *LockHeldError) Code() string { return "lock_held" }
+
+func (l *LockHeldError) Details() map[string]any {
+	return map[string]any{"blockers": l.Blockers}
+}
+
+func describeBlockers(blockers []Blocker) string {
+	if len(blockers) == 0 {
+		return ""
+	}
+	list := make([]string, len(blockers))
+	for i, b := range blockers {
+		list[i] = fmt.Sprintf("pid %d (application \"%s\")", b.PID, b.ApplicationName)
+	}
+	return ": " + strings.Join(list, ", ")
+}
+
+// ExecError is returned when a migration statement failed to execute.
+type ExecError struct {
+	ID  string
+	Err error
+
+	// Statement is the 1-based index of the failed statement in the migration with Options.SplitStatements,
+	// 0 when the migration is executed as a whole.
+	Statement int
+}
+
+func (e *ExecError) Error() string {
+	if e.Statement > 0 {
+		return fmt.Sprintf("cannot execute \"%s\" (statement %d): %s", e.ID, e.Statement, e.Err)
+	}
+	return fmt.Sprintf("cannot execute \"%s\": %s", e.ID, e.Err)
+}
+
+func (e *ExecError) Unwrap() error { return e.Err }
+
+func (e *ExecError) Code() string { return "exec_failed" }
+
+func (e *ExecError) Details() map[string]any {
+	d := map[string]any{"id": e.ID}
+	if e.Statement > 0 {
+		d["statement"] = e.Statement
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(e.Err, &pgErr) {
+		d["sqlstate"] = pgErr.Code
+	}
+	return d
+}
+
+// TimeoutError is returned when a migration is cancelled by statement_timeout or lock_timeout, see
+// Options.StatementTimeout. ID is empty when it timed out while waiting for the meta table lock.
+type TimeoutError struct {
+	ID   string
+	Kind string // "statement_timeout" or "lock_timeout"
+	Err  error
+}
+
+func (t *TimeoutError) Error() string {
+	if t.ID == "" {
+		return fmt.Sprintf("cannot lock the meta table: %s exceeded", t.Kind)
+	}
+	return fmt.Sprintf("cannot execute \"%s\": %s exceeded", t.ID, t.Kind)
+}
+
+func (t *TimeoutError) Unwrap() error { return t.Err }
+
+func (t *TimeoutError) Code() string { return "timeout" }
+
+func (t *TimeoutError) Details() map[string]any {
+	return map[string]any{"id": t.ID, "kind": t.Kind}
+}
+
+// execError wrap err returned by executing statement stmt of migration id, as *TimeoutError if it is caused by
+// statement_timeout or lock_timeout, otherwise as *ExecError.
+func (o *Options) execError(id string, stmt int, err error) error {
+	if kind := o.timeoutKind(err); kind != "" {
+		return &TimeoutError{ID: id, Kind: kind, Err: err}
+	}
+	return &ExecError{ID: id, Err: err, Statement: stmt}
+}
+
+// timeoutKind return "statement_timeout" or "lock_timeout" if err is caused by it, otherwise empty string.
+//
+// the sqlstates are shared with cancellation and nowait, so they are only attributed to the timeout when it is set,
+// the message is not checked because it is localized by lc_messages of the server.
+func (o *Options) timeoutKind(err error) string {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ""
+	}
+	switch {
+	case pgErr.Code == "57014" && o.StatementTimeout > 0:
+		return "statement_timeout"
+	case pgErr.Code == "55P03" && o.LockTimeout > 0 && !o.NoWait:
+		return "lock_timeout"
+	}
+	return ""
+}
+
+// NestedTransactionError is returned when a migration statement try to start its own transaction.
+type NestedTransactionError struct {
+	ID string
+}
+
+func (n *NestedTransactionError) Error() string {
+	return fmt.Sprintf("cannot execute \"%s\": migration statement is already in transaction", n.ID)
+}
+
+func (n *NestedTransactionError) Code() string { return "nested_transaction" }
+
+func (n *NestedTransactionError) Details() map[string]any {
+	return map[string]any{"id": n.ID}
+}
+
+// UnknownMigrationError is returned when the requested migration id is not found in the source.
+type UnknownMigrationError struct {
+	ID string
+}
+
+func (u *UnknownMigrationError) Error() string {
+	return fmt.Sprintf("\"%s\" not found in the source", u.ID)
+}
+
+func (u *UnknownMigrationError) Code() string { return "unknown_migration" }
+
+func (u *UnknownMigrationError) Details() map[string]any {
+	return map[string]any{"id": u.ID}
+}
+
+// IncompleteSquashError is returned when the database only execute some of the migrations
+// squashed into baseline migration, so neither the baseline nor the rest can be executed safely.
+type IncompleteSquashError struct {
+	ID      string
+	Missing []string
+}
+
+func (i *IncompleteSquashError) Error() string {
+	return fmt.Sprintf("\"%s\" is squashed from migrations partially executed in the database, missing: %s",
+		i.ID, strings.Join(i.Missing, ", "))
+}
+
+func (i *IncompleteSquashError) Code() string { return "incomplete_squash" }
+
+func (i *IncompleteSquashError) Details() map[string]any {
+	return map[string]any{"id": i.ID, "missing": i.Missing}
+}
+
+// MultiDryRunError is returned by DryRun with Options.DryRunContinueOnError when some migrations failed.
+type MultiDryRunError struct {
+	// Failures is usually *ExecError, in the order of the migrations
+	Failures []Error
+}
+
+func (d *MultiDryRunError) Error() string {
+	msgs := make([]string, len(d.Failures))
+	for i, f := range d.Failures {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("%d migration(s) failed in dry run: %s", len(d.Failures), strings.Join(msgs, "; "))
+}
+
+func (d *MultiDryRunError) Code() string { return "dry_run_failed" }
+
+func (d *MultiDryRunError) Details() map[string]any {
+	failures := make([]map[string]any, len(d.Failures))
+	for i, f := range d.Failures {
+		failures[i] = f.Details()
+		failures[i]["code"] = f.Code()
+	}
+	return map[string]any{"failures": failures}
+}
+
+// PendingMigrationsError is returned by AssertUpToDate when the database is not fully migrated.
+type PendingMigrationsError struct {
+	Pending []string
+}
+
+func (p *PendingMigrationsError) Error() string {
+	return fmt.Sprintf("database has %d pending migration(s): %s", len(p.Pending), strings.Join(p.Pending, ", "))
+}
+
+func (p *PendingMigrationsError) Code() string { return "pending_migrations" }
+
+func (p *PendingMigrationsError) Details() map[string]any {
+	return map[string]any{"pending": p.Pending}
+}
+
+// PsqlMetaCommandError is returned when a migration contains psql meta-command (backslash command like \copy),
+// which only understood by psql client.
+type PsqlMetaCommandError struct {
+	ID   string
+	Line int
+}
+
+func (p *PsqlMetaCommandError) Error() string {
+	return fmt.Sprintf("\"%s\" contains psql meta-command at line %d", p.ID, p.Line)
+}
+
+func (p *PsqlMetaCommandError) Code() string { return "psql_meta_command" }
+
+func (p *PsqlMetaCommandError) Details() map[string]any {
+	return map[string]any{"id": p.ID, "line": p.Line}
+}
+
+// NormalizedNotStoredError is returned by DriftDiff when the database doesn't have the normalized text
+// of the migration, because it is not executed yet or executed without Options.StoreNormalized.
+type NormalizedNotStoredError struct {
+	ID string
+}
+
+func (n *NormalizedNotStoredError) Error() string {
+	return fmt.Sprintf("normalized text of \"%s\" is not stored in the database", n.ID)
+}
+
+func (n *NormalizedNotStoredError) Code() string { return "normalized_not_stored" }
+
+func (n *NormalizedNotStoredError) Details() map[string]any {
+	return map[string]any{"id": n.ID}
+}
+
+// RowCountError is returned when the number of rows affected by the migration
+// doesn't satisfy its expect-rows directive.
+type RowCountError struct {
+	ID       string
+	Got      int64
+	Expected string // like ">= 1"
+}
+
+func (r *RowCountError) Error() string {
+	return fmt.Sprintf("\"%s\" affected %d row(s), expected %s", r.ID, r.Got, r.Expected)
+}
+
+func (r *RowCountError) Code() string { return "unexpected_row_count" }
+
+func (r *RowCountError) Details() map[string]any {
+	return map[string]any{"id": r.ID, "got": r.Got, "expected": r.Expected}
+}
+
+// ChainBrokenError is returned by VerifyChain when the checksum chain in the meta table is broken,
+// either the row of AtID or the prev_hash of the row applied after it was modified.
+type ChainBrokenError struct {
+	AtID string
+}
+
+func (c *ChainBrokenError) Error() string {
+	return fmt.Sprintf("meta table checksum chain is broken at \"%s\"", c.AtID)
+}
+
+func (c *ChainBrokenError) Code() string { return "chain_broken" }
+
+func (c *ChainBrokenError) Details() map[string]any {
+	return map[string]any{"id": c.AtID}
+}
+
+// MultipleStatementsError is returned when a migration file has more than one top-level statement
+// with Options.OneStatementPerFile.
+type MultipleStatementsError struct {
+	ID    string
+	Count int
+}
+
+func (m *MultipleStatementsError) Error() string {
+	return fmt.Sprintf("\"%s\" has %d statements, only one is allowed", m.ID, m.Count)
+}
+
+func (m *MultipleStatementsError) Code() string { return "multiple_statements" }
+
+func (m *MultipleStatementsError) Details() map[string]any {
+	return map[string]any{"id": m.ID, "count": m.Count}
+}
+
+// EmptyMigrationError is returned when a migration file only has whitespace and comments
+// with Options.RejectEmptyMigration.
+type EmptyMigrationError struct {
+	ID string
+}
+
+func (e *EmptyMigrationError) Error() string {
+	return fmt.Sprintf("\"%s\" is empty", e.ID)
+}
+
+func (e *EmptyMigrationError) Code() string { return "empty_migration" }
+
+func (e *EmptyMigrationError) Details() map[string]any {
+	return map[string]any{"id": e.ID}
+}
+
+// OrderingError is returned when migration ID violates Options.StrictOrdering,
+// Previous is the versioned migration sorted right before it, if any.
+type OrderingError struct {
+	ID       string
+	Previous string
+	Reason   string
+}
+
+func (o *OrderingError) Error() string {
+	if o.Previous == "" {
+		return fmt.Sprintf("\"%s\" %s", o.ID, o.Reason)
+	}
+	return fmt.Sprintf("\"%s\" %s, after \"%s\"", o.ID, o.Reason, o.Previous)
+}
+
+func (o *OrderingError) Code() string { return "invalid_ordering" }
+
+func (o *OrderingError) Details() map[string]any {
+	return map[string]any{"id": o.ID, "previous": o.Previous, "reason": o.Reason}
+}
+
+// MultiSchemaError is returned by RunInSchemas, Failures is the error of each failed schema.
+type MultiSchemaError struct {
+	Failures map[string]error
+}
+
+// schemas return the failed schemas, sorted.
+func (m *MultiSchemaError) schemas() []string {
+	ret := make([]string, 0, len(m.Failures))
+	for s := range m.Failures {
+		ret = append(ret, s)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (m *MultiSchemaError) Error() string {
+	var msgs []string
+	for _, s := range m.schemas() {
+		msgs = append(msgs, fmt.Sprintf("\"%s\": %s", s, m.Failures[s]))
+	}
+	return fmt.Sprintf("%d schema(s) failed: %s", len(m.Failures), strings.Join(msgs, "; "))
+}
+
+func (m *MultiSchemaError) Code() string { return "multi_schema_failed" }
+
+func (m *MultiSchemaError) Details() map[string]any {
+	return map[string]any{"schemas": m.schemas()}
+}
+
+// TooManyPendingError is returned by Run when the number of pending migrations exceeds Options.MaxPendingForRun.
+type TooManyPendingError struct {
+	Count int
+	Limit int
+}
+
+func (t *TooManyPendingError) Error() string {
+	return fmt.Sprintf("refusing to execute %d pending migrations, the limit is %d", t.Count, t.Limit)
+}
+
+func (t *TooManyPendingError) Code() string { return "too_many_pending" }
+
+func (t *TooManyPendingError) Details() map[string]any {
+	return map[string]any{"count": t.Count, "limit": t.Limit}
+}
+
+// PrecheckFailedError is returned when Options.Precheck return error.
+type PrecheckFailedError struct {
+	Err error
+}
+
+func (p *PrecheckFailedError) Error() string {
+	return fmt.Sprintf("precheck failed: %s", p.Err)
+}
+
+func (p *PrecheckFailedError) Unwrap() error { return p.Err }
+
+func (p *PrecheckFailedError) Code() string { return "precheck_failed" }
+
+func (p *PrecheckFailedError) Details() map[string]any {
+	return map[string]any{"error": p.Err.Error()}
+}
+
+// PartialNoTxMigrationError is returned by Run when a pending migration create index concurrently,
+// but the index already exists as invalid index, usually left by previous attempt that crashed midway.
+// the invalid index must be dropped before the migration can be executed again.
+type PartialNoTxMigrationError struct {
+	ID    string
+	Index string
+}
+
+func (p *PartialNoTxMigrationError) Error() string {
+	return fmt.Sprintf("\"%s\" was partially executed, invalid index %s is left behind, drop it and run again", p.ID, p.Index)
+}
+
+func (p *PartialNoTxMigrationError) Code() string { return "partial_notx_migration" }
+
+func (p *PartialNoTxMigrationError) Details() map[string]any {
+	return map[string]any{"id": p.ID, "index": p.Index}
+}
+
+// NondeterministicHashError is returned by SelfTest when the migration doesn't always have the same hash.
+type NondeterministicHashError struct {
+	ID string
+}
+
+func (n *NondeterministicHashError) Error() string {
+	return fmt.Sprintf("hash of \"%s\" is not deterministic", n.ID)
+}
+
+func (n *NondeterministicHashError) Code() string { return "nondeterministic_hash" }
+
+func (n *NondeterministicHashError) Details() map[string]any {
+	return map[string]any{"id": n.ID}
+}
+
+// PostCommitVerifyError is returned by Run with Options.PostCommitVerify when the committed state doesn't match
+// the source, either some migrations are still pending, or Err happen while checking.
+type PostCommitVerifyError struct {
+	Pending []string
+	Err     error
+}
+
+func (p *PostCommitVerifyError) Error() string {
+	if p.Err != nil {
+		return fmt.Sprintf("post-commit verification failed: %s", p.Err)
+	}
+	return fmt.Sprintf("post-commit verification failed, still pending: %s", strings.Join(p.Pending, ", "))
+}
+
+func (p *PostCommitVerifyError) Unwrap() error { return p.Err }
+
+func (p *PostCommitVerifyError) Code() string { return "post_commit_verify_failed" }
+
+func (p *PostCommitVerifyError) Details() map[string]any {
+	d := map[string]any{"pending": p.Pending}
+	if p.Err != nil {
+		d["error"] = p.Err.Error()
+	}
+	return d
+}
+
+// BlockedError is returned by Run when Options.WarnOnBlockers abort it.
+type BlockedError struct {
+	Blockers []Blocker
+	Err      error
+}
+
+func (b *BlockedError) Error() string {
+	return fmt.Sprintf("aborted because of open transactions (%s)%s", b.Err, describeBlockers(b.Blockers))
+}
+
+func (b *BlockedError) Unwrap() error { return b.Err }
+
+func (b *BlockedError) Code() string { return "blocked" }
+
+func (b *BlockedError) Details() map[string]any {
+	return map[string]any{"blockers": b.Blockers, "error": b.Err.Error()}
+}
+
+// FinalizerError is returned by Run when Options.Finalizer failed, when Committed is true,
+// the migrations are already committed.
+type FinalizerError struct {
+	Committed bool
+	Err       error
+}
+
+func (f *FinalizerError) Error() string {
+	if f.Committed {
+		return fmt.Sprintf("finalizer failed after the migrations committed: %s", f.Err)
+	}
+	return fmt.Sprintf("finalizer failed: %s", f.Err)
+}
+
+func (f *FinalizerError) Unwrap() error { return f.Err }
+
+func (f *FinalizerError) Code() string { return "finalizer_failed" }
+
+func (f *FinalizerError) Details() map[string]any {
+	return map[string]any{"committed": f.Committed, "error": f.Err.Error()}
+}
+
+// MissingPrerequisiteError is returned by Check and Run when pending migration ID has after directive,
+// but RequiredID is not executed before it.
+type MissingPrerequisiteError struct {
+	ID         string
+	RequiredID string
+}
+
+func (m *MissingPrerequisiteError) Error() string {
+	return fmt.Sprintf("\"%s\" requires \"%s\" to be executed first", m.ID, m.RequiredID)
+}
+
+func (m *MissingPrerequisiteError) Code() string { return "missing_prerequisite" }
+
+func (m *MissingPrerequisiteError) Details() map[string]any {
+	return map[string]any{"id": m.ID, "required_id": m.RequiredID}
+}
+
+// SchemaQualifyError is returned by New with Options.StrictSchemaQualify when some migration
+// create table or index on table without explicit schema.
+type SchemaQualifyError struct {
+	Objects []UnqualifiedObject
+}
+
+func (s *SchemaQualifyError) Error() string {
+	list := make([]string, len(s.Objects))
+	for i, o := range s.Objects {
+		list[i] = o.String()
+	}
+	return "objects without explicit schema:\n  " + strings.Join(list, "\n  ")
+}
+
+func (s *SchemaQualifyError) Code() string { return "unqualified_object" }
+
+func (s *SchemaQualifyError) Details() map[string]any {
+	return map[string]any{"objects": s.Objects}
+}
+
+// MissingDownMigrationError is returned by Rollback when executed migration ID has no down migration.
+type MissingDownMigrationError struct {
+	ID string
+}
+
+func (m *MissingDownMigrationError) Error() string {
+	return fmt.Sprintf("\"%s\" has no down migration, cannot be rolled back", m.ID)
+}
+
+func (m *MissingDownMigrationError) Code() string { return "missing_down_migration" }
+
+func (m *MissingDownMigrationError) Details() map[string]any {
+	return map[string]any{"id": m.ID}
+}
+
+// SquashedRollbackError is returned by Rollback when executed migration ID is squashed into Baseline by Squash,
+// its down migration is no longer in the source, and the baseline cannot be rolled back partially.
+type SquashedRollbackError struct {
+	ID       string
+	Baseline string
+}
+
+func (s *SquashedRollbackError) Error() string {
+	return fmt.Sprintf("\"%s\" is squashed into \"%s\", cannot be rolled back", s.ID, s.Baseline)
+}
+
+func (s *SquashedRollbackError) Code() string { return "squashed_rollback" }
+
+func (s *SquashedRollbackError) Details() map[string]any {
+	return map[string]any{"id": s.ID, "baseline": s.Baseline}
+}
+
+// NoTxUnsupportedError is returned by RunSQLTx when pending migration ID has no-transaction directive,
+// it must be executed by Run instead. it is also returned by Squash, the baseline is executed in transaction.
+type NoTxUnsupportedError struct {
+	ID string
+}
+
+func (n *NoTxUnsupportedError) Error() string {
+	return fmt.Sprintf("\"%s\" has no-transaction directive, it cannot be executed inside transaction", n.ID)
+}
+
+func (n *NoTxUnsupportedError) Code() string { return "no_tx_unsupported" }
+
+func (n *NoTxUnsupportedError) Details() map[string]any {
+	return map[string]any{"id": n.ID}
+}
+
+// DirtyMigrationError is returned by Check and Run when migration ID was started outside transaction
+// but never finished, so the database may be left half-applied. it must be fixed manually, then
+// resolved with ClearDirty or UnsafeMarkAsExecuted.
+type DirtyMigrationError struct {
+	ID string
+}
+
+func (d *DirtyMigrationError) Error() string {
+	return fmt.Sprintf("\"%s\" was not finished, the database may be left half-applied", d.ID)
+}
+
+func (d *DirtyMigrationError) Code() string { return "dirty_migration" }
+
+func (d *DirtyMigrationError) Details() map[string]any {
+	return map[string]any{"id": d.ID}
+}
+
+// IrreversibleMigrationError is returned by VerifyReversible when the down migration of ID
+// doesn't bring the schema back to the state before ID.
+type IrreversibleMigrationError struct {
+	ID string
+}
+
+func (i *IrreversibleMigrationError) Error() string {
+	return fmt.Sprintf("down migration of \"%s\" doesn't fully reverse it", i.ID)
+}
+
+func (i *IrreversibleMigrationError) Code() string { return "irreversible_migration" }
+
+func (i *IrreversibleMigrationError) Details() map[string]any {
+	return map[string]any{"id": i.ID}
+}
+
+// PausedError is returned by Run, together with the executed migrations, when it stop after migration with
+// pause directive. the executed migrations are committed, the next Run continue from NextID.
+type PausedError struct {
+	NextID string
+}
+
+func (p *PausedError) Error() string {
+	return fmt.Sprintf("paused, waiting for approval to continue with \"%s\"", p.NextID)
+}
+
+func (p *PausedError) Code() string { return "paused" }
+
+func (p *PausedError) Details() map[string]any {
+	return map[string]any{"next_id": p.NextID}
+}
+
+// PlanSignatureError is returned by ApplyPlan when the artifact is malformed or its signature is rejected.
+type PlanSignatureError struct {
+	Err error
+}
+
+func (p *PlanSignatureError) Error() string {
+	return fmt.Sprintf("invalid plan signature: %s", p.Err.Error())
+}
+
+func (p *PlanSignatureError) Unwrap() error { return p.Err }
+
+func (p *PlanSignatureError) Code() string { return "invalid_plan_signature" }
+
+func (p *PlanSignatureError) Details() map[string]any {
+	return map[string]any{"error": p.Err.Error()}
+}
+
+// PlanMismatchError is returned by ApplyPlan when the plan cannot be applied as is, Changed is the planned
+// migrations that are missing or different in the source, Pending is the actual pending migrations
+// in the database when they are not the Planned ones.
+type PlanMismatchError struct {
+	Planned []string
+	Changed []string
+	Pending []string
+}
+
+func (p *PlanMismatchError) Error() string {
+	if len(p.Changed) > 0 {
+		return fmt.Sprintf("planned migrations are changed in the source: %s", strings.Join(p.Changed, ", "))
+	}
+	return fmt.Sprintf("pending migrations are no longer the planned ones: %s", strings.Join(p.Pending, ", "))
+}
+
+func (p *PlanMismatchError) Code() string { return "plan_mismatch" }
+
+func (p *PlanMismatchError) Details() map[string]any {
+	return map[string]any{"planned": p.Planned, "changed": p.Changed, "pending": p.Pending}
+}
+
+// SchemaHashMismatchError is returned by VerifySchemaHash when the live schema is changed
+// since the last Run, Stored is empty if the schema hash was never captured.
+type SchemaHashMismatchError struct {
+	Stored  string
+	Current string
+}
+
+func (s *SchemaHashMismatchError) Error() string {
+	if s.Stored == "" {
+		return "schema hash was never captured"
+	}
+	return "schema is changed outside the migration"
+}
+
+func (s *SchemaHashMismatchError) Code() string { return "schema_hash_mismatch" }
+
+func (s *SchemaHashMismatchError) Details() map[string]any {
+	return map[string]any{"stored": s.Stored, "current": s.Current}
+}
+
+// SourceError is returned by NewE, or Squash, when the source doesn't follow the layout described in New,
+// Name is the offending file or directory, relative to the migration directory, "." for the source root.
+type SourceError struct {
+	Name string
+	Err  error
+}
+
+func (s *SourceError) Error() string {
+	return fmt.Sprintf("migration: %s: %s", s.Err, s.Name)
+}
+
+func (s *SourceError) Unwrap() error { return s.Err }
+
+func (s *SourceError) Code() string { return "invalid_source" }
+
+func (s *SourceError) Details() map[string]any {
+	return map[string]any{"name": s.Name, "error": s.Err.Error()}
+}
+
+// DirectiveError is returned by NewE when the Directive at Line of migration ID is invalid, see New.
+type DirectiveError struct {
+	ID        string
+	Line      int
+	Directive string
+	Reason    string
+}
+
+func (d *DirectiveError) Error() string {
+	return fmt.Sprintf("migration: %s directive in %s at line %d: %s", d.Directive, d.ID, d.Line, d.Reason)
+}
+
+func (d *DirectiveError) Code() string { return "invalid_directive" }
+
+func (d *DirectiveError) Details() map[string]any {
+	return map[string]any{"id": d.ID, "line": d.Line, "directive": d.Directive, "reason": d.Reason}
+}
+
+// InvalidMetaNameError is returned when the meta schema or table Name set by WithSchema or WithTable,
+// or the schema passed to RunInSchemas, is not [a-z0-9_], or longer than Max characters.
+type InvalidMetaNameError struct {
+	Name string
+	Max  int
+}
+
+func (i *InvalidMetaNameError) Error() string {
+	return fmt.Sprintf("migration: invalid meta table name %q, only [a-z0-9_] is allowed, at most %d characters", i.Name, i.Max)
+}
+
+func (i *InvalidMetaNameError) Code() string { return "invalid_meta_name" }
+
+func (i *InvalidMetaNameError) Details() map[string]any {
+	return map[string]any{"name": i.Name, "max": i.Max}
+}
+
+// InvalidAppIDError is returned by Check and Run when the target database is tagged with Actual app id,
+// but the migration is for Expected one, see Options.AppID.
+type InvalidAppIDError struct {
+	Expected string
+	Actual   string
+}
+
+func (i *InvalidAppIDError) Error() string {
+	return fmt.Sprintf("database belong to app \"%s\", not \"%s\"", i.Actual, i.Expected)
+}
+
+func (i *InvalidAppIDError) Code() string { return "invalid_app_id" }
+
+func (i *InvalidAppIDError) Details() map[string]any {
+	return map[string]any{"expected": i.Expected, "actual": i.Actual}
+}
+
+// MetaNotEmptyError is returned by Baseline when the meta table already has Count rows.
+type MetaNotEmptyError struct {
+	Count int
+}
+
+func (m *MetaNotEmptyError) Error() string {
+	return fmt.Sprintf("meta table already has %d migrations, cannot baseline", m.Count)
+}
+
+func (m *MetaNotEmptyError) Code() string { return "meta_not_empty" }
+
+func (m *MetaNotEmptyError) Details() map[string]any {
+	return map[string]any{"count": m.Count}
+}
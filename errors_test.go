@@ -0,0 +1,281 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestErrorCode(t *testing.T) {
+	tc := []struct {
+		err     Error
+		code    string
+		details map[string]any
+	}{
+		{
+			&MismatchHashError{Item: Item{ID: "a.sql", Hash: "x"}, HashInDB: "y"},
+			"hash_mismatch",
+			map[string]any{"id": "a.sql", "hash": "x", "hash_in_db": "y"},
+		},
+		{
+			&OrphanedMigrationError{Orphans: []Item{{ID: "a.sql"}, {ID: "b.sql"}}},
+			"orphaned_migration",
+			map[string]any{"ids": []string{"a.sql", "b.sql"}},
+		},
+		{
+			&LockHeldError{Blockers: []Blocker{{PID: 1}}},
+			"lock_held",
+			map[string]any{"blockers": []Blocker{{PID: 1}}},
+		},
+		{
+			&ExecError{ID: "a.sql", Err: &pgconn.PgError{Code: "42601"}},
+			"exec_failed",
+			map[string]any{"id": "a.sql", "sqlstate": "42601"},
+		},
+		{
+			&ExecError{ID: "a.sql", Err: &pgconn.PgError{Code: "42601"}, Statement: 2},
+			"exec_failed",
+			map[string]any{"id": "a.sql", "statement": 2, "sqlstate": "42601"},
+		},
+		{
+			&ExecError{ID: "a.sql", Err: errors.New("conn closed")},
+			"exec_failed",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&UnknownMigrationError{ID: "a.sql"},
+			"unknown_migration",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&IncompleteSquashError{ID: "a.baseline.sql", Missing: []string{"a.sql"}},
+			"incomplete_squash",
+			map[string]any{"id": "a.baseline.sql", "missing": []string{"a.sql"}},
+		},
+		{
+			&PendingMigrationsError{Pending: []string{"a.sql"}},
+			"pending_migrations",
+			map[string]any{"pending": []string{"a.sql"}},
+		},
+		{
+			&NestedTransactionError{ID: "a.sql"},
+			"nested_transaction",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&NormalizedNotStoredError{ID: "a.sql"},
+			"normalized_not_stored",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&ChainBrokenError{AtID: "a.sql"},
+			"chain_broken",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&MultipleStatementsError{ID: "a.sql", Count: 2},
+			"multiple_statements",
+			map[string]any{"id": "a.sql", "count": 2},
+		},
+		{
+			&EmptyMigrationError{ID: "a.sql"},
+			"empty_migration",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&MultiSchemaError{Failures: map[string]error{"b": errors.New("x"), "a": errors.New("y")}},
+			"multi_schema_failed",
+			map[string]any{"schemas": []string{"a", "b"}},
+		},
+		{
+			&TooManyPendingError{Count: 3, Limit: 2},
+			"too_many_pending",
+			map[string]any{"count": 3, "limit": 2},
+		},
+		{
+			&PrecheckFailedError{Err: errors.New("low disk")},
+			"precheck_failed",
+			map[string]any{"error": "low disk"},
+		},
+		{
+			&TimeoutError{ID: "a.sql", Kind: "lock_timeout", Err: &pgconn.PgError{Code: "55P03"}},
+			"timeout",
+			map[string]any{"id": "a.sql", "kind": "lock_timeout"},
+		},
+		{
+			&InvalidAppIDError{Expected: "billing", Actual: "analytics"},
+			"invalid_app_id",
+			map[string]any{"expected": "billing", "actual": "analytics"},
+		},
+		{
+			&MetaNotEmptyError{Count: 2},
+			"meta_not_empty",
+			map[string]any{"count": 2},
+		},
+		{
+			&SquashedRollbackError{ID: "0001_a.sql", Baseline: "0002_b.baseline.sql"},
+			"squashed_rollback",
+			map[string]any{"id": "0001_a.sql", "baseline": "0002_b.baseline.sql"},
+		},
+		{
+			&OrderingError{ID: "0001a_b.sql", Previous: "0001_a.sql", Reason: "has prefix not greater than the previous one"},
+			"invalid_ordering",
+			map[string]any{"id": "0001a_b.sql", "previous": "0001_a.sql", "reason": "has prefix not greater than the previous one"},
+		},
+		{
+			&DirectiveError{ID: "a.sql", Line: 1, Directive: "after", Reason: "invalid argument: "},
+			"invalid_directive",
+			map[string]any{"id": "a.sql", "line": 1, "directive": "after", "reason": "invalid argument: "},
+		},
+		{
+			&InvalidMetaNameError{Name: "Meta", Max: 51},
+			"invalid_meta_name",
+			map[string]any{"name": "Meta", "max": 51},
+		},
+		{
+			&SourceError{Name: "A.sql", Err: errors.New("must have lowercase name")},
+			"invalid_source",
+			map[string]any{"name": "A.sql", "error": "must have lowercase name"},
+		},
+		{
+			&PartialNoTxMigrationError{ID: "a.sql", Index: `"test"."a_idx"`},
+			"partial_notx_migration",
+			map[string]any{"id": "a.sql", "index": `"test"."a_idx"`},
+		},
+		{
+			&NondeterministicHashError{ID: "a.sql"},
+			"nondeterministic_hash",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&PostCommitVerifyError{Pending: []string{"a.sql"}},
+			"post_commit_verify_failed",
+			map[string]any{"pending": []string{"a.sql"}},
+		},
+		{
+			&BlockedError{Blockers: []Blocker{{PID: 1}}, Err: errors.New("too old")},
+			"blocked",
+			map[string]any{"blockers": []Blocker{{PID: 1}}, "error": "too old"},
+		},
+		{
+			&FinalizerError{Committed: true, Err: errors.New("boom")},
+			"finalizer_failed",
+			map[string]any{"committed": true, "error": "boom"},
+		},
+		{
+			&MissingPrerequisiteError{ID: "b.sql", RequiredID: "a.sql"},
+			"missing_prerequisite",
+			map[string]any{"id": "b.sql", "required_id": "a.sql"},
+		},
+		{
+			&SchemaQualifyError{Objects: []UnqualifiedObject{{ID: "a.sql", Line: 1}}},
+			"unqualified_object",
+			map[string]any{"objects": []UnqualifiedObject{{ID: "a.sql", Line: 1}}},
+		},
+		{
+			&MissingDownMigrationError{ID: "a.sql"},
+			"missing_down_migration",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&NoTxUnsupportedError{ID: "a.sql"},
+			"no_tx_unsupported",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&DirtyMigrationError{ID: "a.sql"},
+			"dirty_migration",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&IrreversibleMigrationError{ID: "a.sql"},
+			"irreversible_migration",
+			map[string]any{"id": "a.sql"},
+		},
+		{
+			&PausedError{NextID: "b.sql"},
+			"paused",
+			map[string]any{"next_id": "b.sql"},
+		},
+		{
+			&PlanSignatureError{Err: errors.New("boom")},
+			"invalid_plan_signature",
+			map[string]any{"error": "boom"},
+		},
+		{
+			&PlanMismatchError{Planned: []string{"a.sql"}, Pending: []string{"b.sql"}},
+			"plan_mismatch",
+			map[string]any{"planned": []string{"a.sql"}, "changed": []string(nil), "pending": []string{"b.sql"}},
+		},
+		{
+			&SchemaHashMismatchError{Stored: "a", Current: "b"},
+			"schema_hash_mismatch",
+			map[string]any{"stored": "a", "current": "b"},
+		},
+		{
+			&RowCountError{ID: "a.sql", Got: 0, Expected: ">= 1"},
+			"unexpected_row_count",
+			map[string]any{"id": "a.sql", "got": int64(0), "expected": ">= 1"},
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.code, func(t *testing.T) {
+			if code := c.err.Code(); code != c.code {
+				t.Fatalf("invalid code %s", code)
+			}
+			if details := c.err.Details(); !reflect.DeepEqual(details, c.details) {
+				t.Fatalf("invalid details %#v", details)
+			}
+		})
+	}
+}
+
+func TestMismatchHashErrorMessage(t *testing.T) {
+	err := &MismatchHashError{Item: Item{ID: "0001_a.sql", Hash: "x"}, HashInDB: "y"}
+	if err.ID != "0001_a.sql" || err.Hash != "x" {
+		t.Fatalf("id and hash should be promoted from Item")
+	}
+	if msg := err.Error(); msg != `"0001_a.sql" has different hash in the database` {
+		t.Fatalf("invalid message: %s", msg)
+	}
+}
+
+func TestExecErrorUnwrap(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: "42601"}
+	var target *pgconn.PgError
+	if err := error(&ExecError{ID: "a.sql", Err: pgErr}); !errors.As(err, &target) || target != pgErr {
+		t.Fatalf("ExecError should unwrap to the underlying error")
+	}
+}
+
+func TestExecErrorTimeout(t *testing.T) {
+	timeouts := &Options{StatementTimeout: time.Second, LockTimeout: time.Second}
+	for _, tc := range []struct {
+		opts *Options
+		err  *pgconn.PgError
+		kind string
+	}{
+		{timeouts, &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}, "statement_timeout"},
+		{timeouts, &pgconn.PgError{Code: "55P03", Message: "canceling statement due to lock timeout"}, "lock_timeout"},
+		// localized by lc_messages
+		{timeouts, &pgconn.PgError{Code: "57014", Message: "Anweisung wegen Statement-Timeout abgebrochen"}, "statement_timeout"},
+		{&Options{}, &pgconn.PgError{Code: "57014", Message: "canceling statement due to user request"}, ""},
+		{&Options{LockTimeout: time.Second, NoWait: true}, &pgconn.PgError{Code: "55P03", Message: `could not obtain lock on relation "a"`}, ""},
+		{&Options{}, &pgconn.PgError{Code: "55P03", Message: `could not obtain lock on relation "a"`}, ""},
+		{timeouts, &pgconn.PgError{Code: "42601"}, ""},
+	} {
+		err := tc.opts.execError("a.sql", 0, tc.err)
+		var timeout *TimeoutError
+		var exec *ExecError
+		switch {
+		case tc.kind != "" && (!errors.As(err, &timeout) || timeout.Kind != tc.kind || timeout.ID != "a.sql"):
+			t.Fatalf("%s should be TimeoutError of %s, got %v", tc.err.Message, tc.kind, err)
+		case tc.kind == "" && !errors.As(err, &exec):
+			t.Fatalf("%s should be ExecError, got %v", tc.err.Message, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExportForSchemaDiff write the migrations executed in the target database to w, for external tools.
+//
+// the format is tab separated values with header, one executed migration per line in the order they were
+// executed, the time is in RFC 3339 format, UTC:
+//
+//	id	hash	applied_at
+//	0001_init.sql	9f86d081884c7d65...	2022-01-02T03:04:05.123456Z
+//
+// the id is escaped like the text format of postgres COPY, backslash, tab, newline, and carriage return
+// are written as \\, \t, \n, and \r, because the meta table can have any id, e.g. recorded by UnsafeMarkAsExecuted.
+// only the header is written if the meta table doesn't exist.
+//
+// ExportForSchemaDiff never modify the database.
+func (m *Migration) ExportForSchemaDiff(target string, w io.Writer) error {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	list, err := m.opts.queryApplied(bgCtx, conn)
+	if err != nil {
+		return err
+	}
+
+	return writeExport(w, list)
+}
+
+// exportEscaper escape the id in the output of ExportForSchemaDiff.
+var exportEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func writeExport(w io.Writer, list []appliedRow) error {
+	if _, err := fmt.Fprint(w, "id\thash\tapplied_at\n"); err != nil {
+		return err
+	}
+	for _, r := range list {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", exportEscaper.Replace(r.id), r.hash, r.at.UTC().Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseExport parse the output of ExportForSchemaDiff.
+func parseExport(t *testing.T, r io.Reader) []appliedRow {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if lines[0] != "id\thash\tapplied_at" {
+		t.Fatalf("invalid header %q", lines[0])
+	}
+
+	var ret []appliedRow
+	for _, l := range lines[1:] {
+		fields := strings.Split(l, "\t")
+		if len(fields) != 3 {
+			t.Fatalf("invalid line %q", l)
+		}
+		at, err := time.Parse(time.RFC3339Nano, fields[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r").Replace(fields[0])
+		ret = append(ret, appliedRow{id: id, hash: fields[1], at: at})
+	}
+	return ret
+}
+
+func TestWriteExport(t *testing.T) {
+	list := []appliedRow{
+		{"0001_a.sql", hash("a"), time.Date(2022, 1, 2, 3, 4, 5, 123456000, time.UTC), false, 0},
+		{"0002_b.sql", hash("b"), time.Date(2022, 1, 2, 3, 4, 6, 0, time.UTC), false, 0},
+		{"0003_\tc\\t\n.sql", hash("c"), time.Date(2022, 1, 2, 3, 4, 7, 0, time.UTC), false, 0},
+	}
+
+	var buf bytes.Buffer
+	if err := writeExport(&buf, list); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "0001_a.sql\t"+hash("a")+"\t2022-01-02T03:04:05.123456Z\n") {
+		t.Fatalf("invalid export:\n%s", buf.String())
+	}
+	if got := parseExport(t, &buf); !reflect.DeepEqual(got, list) {
+		t.Fatalf("export should parse back into the same list, got %v", got)
+	}
+}
+
+func TestExportForSchemaDiff(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	))
+
+	var buf bytes.Buffer
+	if err := m.ExportForSchemaDiff(target, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := parseExport(t, &buf); len(got) != 0 {
+		t.Fatalf("nothing should be exported yet, got %v", got)
+	}
+
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := m.ExportForSchemaDiff(target, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var got []Item
+	for _, r := range parseExport(t, &buf) {
+		got = append(got, Item{ID: r.id, Hash: r.hash})
+	}
+	if !reflect.DeepEqual(got, m.All()) {
+		t.Fatalf("export should have the executed migrations, got %v", got)
+	}
+}
@@ -3,23 +3,78 @@ package migration
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"sort"
 	"strings"
 	"unicode"
 )
 
-// this hash function will ignore case sensitivity, whitespace, sql comment, last semicolon
+// normalizer control how sql is normalized before hashed.
+type normalizer struct {
+	// keepTrailingSemicolon make trailing semicolons significant
+	keepTrailingSemicolon bool
+
+	// sortStatements make the order of top-level statements insignificant
+	sortStatements bool
+
+	// legacy treat quoted text like any other text, like the normalizer before quoting was understood,
+	// the result is only used to accept hash stored by older version, see entry.legacyHash
+	legacy bool
+}
+
+// hash with default normalizer.
 func hash(sql string) string {
+	return normalizer{}.hash(sql)
+}
+
+// HashRawContent hash content as is, without normalization,
+// it is meant for Options.EmptyMigrationHash, so placeholder migrations with different comments have different hash.
+//
+// id is unused, it is only there to match the signature of Options.EmptyMigrationHash, so HashRawContent can be
+// assigned to it directly.
+func HashRawContent(_ string, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func (n normalizer) hash(sql string) string {
+	sum := sha256.Sum256([]byte(n.normalize(sql)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalize ignore case sensitivity, whitespace, sql comment, last semicolon,
+// except inside string literal, dollar quoted string, and quoted identifier, which are kept as is.
+func (n normalizer) normalize(sql string) string {
+	if n.sortStatements {
+		var parts []string
+		for _, stmt := range statements(scan(sql)) {
+			first, last := stmt[0], stmt[len(stmt)-1]
+			parts = append(parts, normalizer{legacy: n.legacy}.normalize(sql[first.pos:last.pos+len(last.text)]))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ";")
+	}
+
 	sql = strings.ReplaceAll(sql, "\r\n", "\n")
 	sql = strings.ReplaceAll(sql, "\r", "\n")
-	sql = strings.ToLower(sql)
+	if n.legacy {
+		sql = strings.ToLower(sql)
+	}
 
 	const (
 		normal = iota
 		lineComment
 		blockComment
+		stringLiteral
+		dollarQuoted
+		quotedIdent
 	)
 
-	sum := sha256.New()
+	// out hold the normalized text, code hold the text outside quotes that is not lowercased yet
+	var out, code strings.Builder
+	flush := func() {
+		out.WriteString(strings.ToLower(code.String()))
+		code.Reset()
+	}
 
 	state := normal
 	blockCommentCount := 0
@@ -41,13 +96,23 @@ func hash(sql string) string {
 				blockCommentCount = 1
 			default:
 				if lastIsSemicolon {
-					sum.Write([]byte{';'})
+					code.WriteByte(';')
 					lastIsSemicolon = false
 				}
-				if c == ';' {
+				if c == ';' && !n.keepTrailingSemicolon {
 					lastIsSemicolon = true
 				} else {
-					sum.Write([]byte{c})
+					code.WriteByte(c)
+				}
+				if n.legacy {
+					break
+				}
+				if c == '\'' {
+					state = stringLiteral
+				} else if c == '"' {
+					state = quotedIdent
+				} else if c == '$' && (i == 0 || !isWordPart(sql[i-1])) && dollarTag(sql[i:]) != "" {
+					state = dollarQuoted
 				}
 			}
 
@@ -74,10 +139,41 @@ func hash(sql string) string {
 			}
 			state = normal
 
+		case stringLiteral:
+			// i-1 is the opening quote, the literal is copied as is, including the closing quote
+			flush()
+			backslashEscape := i >= 2 && (sql[i-2] == 'e' || sql[i-2] == 'E') && (i < 3 || !isWordPart(sql[i-3]))
+			end := scanQuoted(sql, i-1, '\'', backslashEscape)
+			out.WriteString(sql[i:end])
+			i = end - 1
+			state = normal
+
+		case quotedIdent:
+			// i-1 is the opening quote, "MyTable" and "mytable" are different objects, so the case is kept
+			flush()
+			end := scanQuoted(sql, i-1, '"', false)
+			out.WriteString(sql[i:end])
+			i = end - 1
+			state = normal
+
+		case dollarQuoted:
+			// i-1 is the start of opening tag, the string is copied as is, up to and including the closing tag,
+			// any other dollar quote inside it is just content because only the same tag can close it
+			flush()
+			tag := dollarTag(sql[i-1:])
+			end := len(sql)
+			if j := strings.Index(sql[i-1+len(tag):], tag); j >= 0 {
+				end = i - 1 + len(tag) + j + len(tag)
+			}
+			out.WriteString(sql[i:end])
+			i = end - 1
+			state = normal
+
 		default:
 			panic("unreachable")
 		}
 	}
 
-	return hex.EncodeToString(sum.Sum(nil))
+	flush()
+	return out.String()
 }
@@ -63,3 +63,138 @@ func TestHash(t *testing.T) {
 		})
 	}
 }
+
+func TestHashStrictSemicolon(t *testing.T) {
+	strict := normalizer{keepTrailingSemicolon: true}
+
+	if a, b := strict.hash("ab;cd;"), strict.hash("ab;cd"); a == b {
+		t.Fatalf("trailing semicolon should change the hash under strict normalizer")
+	}
+	if a, b := strict.hash("AB ; cd;"), strict.hash("ab;cd;"); a != b {
+		t.Fatalf("strict normalizer should still ignore case and whitespace")
+	}
+	if a, b := strict.hash("ab;;cd"), hash("ab;;cd"); a != b {
+		t.Fatalf("non trailing semicolons should hash the same under both normalizer")
+	}
+}
+
+func TestHashSortStatements(t *testing.T) {
+	sorted := normalizer{sortStatements: true}
+
+	a := "grant select on test.a to app;\n-- reader\ngrant select, insert on test.b to \"role;x\";\nrevoke all on test.c from public;"
+	b := "REVOKE ALL ON test.c FROM public;\ngrant select, insert on test.b to \"role;x\";\ngrant select on test.a to app"
+	if sorted.hash(a) != sorted.hash(b) {
+		t.Fatalf("reordered statements should hash the same under sorting normalizer")
+	}
+	if hash(a) == hash(b) {
+		t.Fatalf("reordered statements should not hash the same by default")
+	}
+	if sorted.hash(a) == sorted.hash("grant select on test.a to app") {
+		t.Fatalf("removed statement should change the hash")
+	}
+}
+
+func TestHashStringLiteral(t *testing.T) {
+	tc := []struct {
+		name, a, b string
+		same       bool
+	}{
+		{"comment marker inside string is kept", "select 'a -- b'", "select 'a'", false},
+		{"block comment marker inside string is kept", "select 'a /* b */'", "select 'a'", false},
+		{"case inside string is kept", "select 'ABC'", "select 'abc'", false},
+		{"whitespace inside string is kept", "select 'a  b'", "select 'a b'", false},
+		{"case outside string is ignored", "SELECT 'ABC' AS X", "select 'ABC' as x", true},
+		{"doubled quote is escaped quote", "select 'it''s -- x' -- comment", "select 'it''s -- x'", true},
+		{"backslash escape in E string", `select E'\' -- x' -- comment`, `select e'\' -- x'`, true},
+		{"backslash is not escape in plain string", `select 'a\' -- comment`, `select 'a\'`, true},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if same := hash(c.a) == hash(c.b); same != c.same {
+				t.Fatalf("hash(%q) == hash(%q) should be %v", c.a, c.b, c.same)
+			}
+		})
+	}
+}
+
+func TestHashLegacy(t *testing.T) {
+	legacy := normalizer{legacy: true}
+
+	if legacy.hash("select 'ABC'") != hash("select 'abc'") {
+		t.Fatalf("legacy normalizer should ignore case inside string")
+	}
+	if legacy.hash("select 'a -- b'") != hash("select 'a") {
+		t.Fatalf("legacy normalizer should treat -- inside string as comment")
+	}
+
+	e := entry{id: "0001", statement: "select 'ABC'"}
+	e.hash = new(Options).entryHash(&e)
+	e.legacyHash = new(Options).legacyEntryHash(&e)
+	if !e.hashMatches(e.hash) || !e.hashMatches(legacy.hash(e.statement)) {
+		t.Fatalf("both current and legacy hash should match")
+	}
+	if e.hashMatches(hash("select 'abd'")) {
+		t.Fatalf("other hash should not match")
+	}
+}
+
+func TestHashDollarQuoted(t *testing.T) {
+	body := func(s string) string {
+		return "CREATE FUNCTION f() RETURNS int AS " + s + " LANGUAGE sql; -- trailing comment"
+	}
+
+	tc := []struct {
+		name, a, b string
+		same       bool
+	}{
+		{"comment inside body is kept", body("$$ select 1 -- one\n $$"), body("$$ select 1\n $$"), false},
+		{"block comment inside body is kept", body("$f$ select /* x */ 1 $f$"), body("$f$ select 1 $f$"), false},
+		{"case inside body is kept", body("$$ SELECT 1 $$"), body("$$ select 1 $$"), false},
+		{"whitespace inside body is kept", body("$$ select  1 $$"), body("$$ select 1 $$"), false},
+		{"case and comment outside body is ignored", body("$$ select 1 $$"), "create function f() returns int as $$ select 1 $$ language sql", true},
+		{"other tag inside body doesn't close it", body("$f$ select $$ -- x $$ $f$ -- y\n"), body("$f$ select $$ -- x $$ $f$"), true},
+		{"other tag inside body is content", body("$f$ select $$ -- x $$ $f$"), body("$f$ select $$ $$ $f$"), false},
+		{"dollar inside identifier is not a quote", "select a$b$ -- c\n, 1", "select a$b$, 1", true},
+		{"positional parameter is not a quote", "select $1 -- c\n, 1", "select $1, 1", true},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if same := hash(c.a) == hash(c.b); same != c.same {
+				t.Fatalf("hash(%q) == hash(%q) should be %v", c.a, c.b, c.same)
+			}
+		})
+	}
+
+	legacy := normalizer{legacy: true}
+	if legacy.hash(body("$$ SELECT 1 -- one\n $$")) != legacy.hash(body("$$ select 1 $$")) {
+		t.Fatalf("legacy normalizer should not understand dollar quote")
+	}
+}
+
+func TestHashQuotedIdent(t *testing.T) {
+	tc := []struct {
+		name, a, b string
+		same       bool
+	}{
+		{"case inside quoted identifier is kept", `create table "AB"()`, `create table "ab"()`, false},
+		{"quoted identifier is not the same as unquoted one", `create table "AB"()`, `create table ab()`, false},
+		{"case of unquoted identifier is ignored", `create table AB()`, `create table ab()`, true},
+		{"comment marker inside quoted identifier is kept", `create table "a--b"()`, `create table "a"()`, false},
+		{"doubled quote is escaped quote", `create table "a""B -- x"() -- comment`, `CREATE TABLE "a""B -- x"()`, true},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if same := hash(c.a) == hash(c.b); same != c.same {
+				t.Fatalf("hash(%q) == hash(%q) should be %v", c.a, c.b, c.same)
+			}
+		})
+	}
+
+	legacy := normalizer{legacy: true}
+	if legacy.hash(`create table "AB"()`) != legacy.hash(`create table "ab"()`) {
+		t.Fatalf("legacy normalizer should ignore case inside quoted identifier")
+	}
+}
@@ -0,0 +1,35 @@
+package migration
+
+import "time"
+
+// AppliedMigration is a migration executed in the target database, see History.
+type AppliedMigration struct {
+	ID        string
+	Hash      string
+	AppliedAt time.Time
+
+	// Duration is how long the migration took, with millisecond precision. it is zero when unknown:
+	// migration executed by older version, by Options.SingleBatch, or still dirty.
+	Duration time.Duration
+}
+
+// History return the migrations executed in the target database, in the order they were executed.
+//
+// History never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) History(target string) ([]AppliedMigration, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(bgCtx)
+
+	applied, err := m.opts.queryApplied(bgCtx, conn)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]AppliedMigration, len(applied))
+	for i, r := range applied {
+		ret[i] = AppliedMigration{ID: r.id, Hash: r.hash, AppliedAt: r.at, Duration: r.duration}
+	}
+	return ret, nil
+}
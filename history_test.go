@@ -0,0 +1,45 @@
+package migration
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "select pg_sleep(0.2)",
+	))
+
+	if list, err := m.History(target); err != nil || len(list) != 0 {
+		t.Fatalf("history should be empty before the first run, got %v, %v", list, err)
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := m.History(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "0001_a.sql" || list[1].ID != "0002_b.sql" {
+		t.Fatalf("invalid history %v", list)
+	}
+	if list[0].Hash != hash("create table test.a()") || list[0].AppliedAt.IsZero() {
+		t.Fatalf("invalid history %v", list[0])
+	}
+	if d := list[1].Duration.Seconds(); d < 0.2 || d > 5 {
+		t.Fatalf("invalid duration %v", list[1].Duration)
+	}
+}
+
+func TestHistoryOldMeta(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource("0001_a.sql", "create table test.a()"))
+	// the meta table before the duration_ms column
+	createOldMeta(t, target, &m.opts, `id text primary key, hash text, at timestamp with time zone default now(), `+
+		`dirty boolean not null default false`)
+
+	list, err := m.History(target)
+	if err != nil || len(list) != 1 || list[0].ID != "0001_a.sql" || list[0].Duration != 0 {
+		t.Fatalf("History should work against meta table without duration_ms column, got %v, %v", list, err)
+	}
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LintIssue is a problem found by Lint.
+type LintIssue struct {
+	Path    string // relative to the linted directory
+	Problem string
+}
+
+func (l LintIssue) String() string {
+	return l.Path + ": " + l.Problem
+}
+
+// Lint check that dir, the directory that will be embedded as the source of New,
+// only contains valid migration files, so New will not panic at runtime.
+// it is meant to be called in tests or CI, before "go:embed".
+//
+// it report file not ending with .sql (like backup or editor swap file),
+// uppercase file name, and down migration without its migration. __APP_ID__.txt is allowed, see New.
+// the issues are sorted by path, nil means no issue.
+func Lint(dir string) []LintIssue {
+	var ret []LintIssue
+	ids := make(map[string]bool)
+	var downs []string
+
+	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			ret = append(ret, LintIssue{path, err.Error()})
+			return nil
+		}
+		if path == "." {
+			return nil
+		}
+
+		switch {
+		case d.IsDir():
+		case path == appIDFile:
+		case !strings.HasSuffix(path, ".sql"):
+			ret = append(ret, LintIssue{path, "not a .sql file"})
+		case strings.ToLower(path) != path:
+			ret = append(ret, LintIssue{path, "file name must be lowercase"})
+		case strings.HasSuffix(path, downSuffix):
+			downs = append(downs, path)
+		default:
+			ids[path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		ret = append(ret, LintIssue{".", err.Error()})
+	}
+
+	for _, down := range downs {
+		base := strings.TrimSuffix(down, downSuffix)
+		if !ids[base+".sql"] && !ids[base+upSuffix] {
+			ret = append(ret, LintIssue{down, "down migration without its migration"})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
@@ -0,0 +1,57 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"0001_a.sql",
+		"0001_a.down.sql",
+		"0002_B.sql",
+		"0002_b.sql~",
+		".0003_c.sql.swp",
+		"0003_c.sql",
+		"0004_d.down.sql",
+		"notes.txt",
+		appIDFile,
+		"sub/0005_e.sql",
+		"sub/0006_f.down.sql",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("select 1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for _, issue := range Lint(dir) {
+		got = append(got, issue.String())
+	}
+	expected := []string{
+		".0003_c.sql.swp: not a .sql file",
+		"0002_B.sql: file name must be lowercase",
+		"0002_b.sql~: not a .sql file",
+		"0004_d.down.sql: down migration without its migration",
+		"notes.txt: not a .sql file",
+		"sub/0006_f.down.sql: down migration without its migration",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("invalid issues, got %q", got)
+	}
+
+	clean := t.TempDir()
+	if err := os.WriteFile(filepath.Join(clean, "0001_a.sql"), []byte("select 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if issues := Lint(clean); issues != nil {
+		t.Fatalf("clean directory should have no issue, got %v", issues)
+	}
+}
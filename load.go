@@ -0,0 +1,247 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// load the migration entries from source, see New for the layout.
+func (m *Migration) load(source fs.FS) error {
+	list, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return &SourceError{Name: ".", Err: err}
+	}
+	if len(list) != 1 || !list[0].IsDir() {
+		return &SourceError{Name: ".", Err: errors.New("source should have single dir in the root")}
+	}
+
+	sub, err := fs.Sub(source, list[0].Name())
+	if err != nil {
+		return &SourceError{Name: list[0].Name(), Err: err}
+	}
+
+	downs := make(map[string]string)
+	// name is the path relative to the migration directory, which is the id of the migration
+	if err := fs.WalkDir(sub, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return &SourceError{Name: name, Err: err}
+		}
+		if name == "." || d.IsDir() {
+			return nil
+		}
+
+		if name == appIDFile {
+			data, err := fs.ReadFile(sub, name)
+			if err != nil {
+				return &SourceError{Name: name, Err: err}
+			}
+			m.appID = strings.TrimSpace(string(data))
+			if m.appID == "" || strings.ContainsAny(m.appID, "\r\n") {
+				return &SourceError{Name: name, Err: errors.New("must contains single line app id")}
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".sql") {
+			return &SourceError{Name: name, Err: errors.New("must ending with .sql")}
+		}
+		if strings.ToLower(name) != name {
+			return &SourceError{Name: name, Err: errors.New("must have lowercase name")}
+		}
+
+		data, err := fs.ReadFile(sub, name)
+		if err != nil {
+			return &SourceError{Name: name, Err: err}
+		}
+
+		stmt := string(data)
+		if strings.HasSuffix(name, downSuffix) {
+			downs[name] = stmt
+			return nil
+		}
+		m.entries = append(m.entries, entry{id: name, statement: stmt})
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Slice(m.entries, func(i, j int) bool { return entryLess(m.entries[i].id, m.entries[j].id) })
+
+	for i, e := range m.entries {
+		if _, ok := m.revEntries[e.id]; ok {
+			return &SourceError{Name: e.id, Err: errors.New("duplicate entry")}
+		}
+		m.revEntries[e.id] = i
+	}
+
+	downIDs := make([]string, 0, len(downs))
+	for id := range downs {
+		downIDs = append(downIDs, id)
+	}
+	sort.Strings(downIDs)
+	for _, id := range downIDs {
+		base := strings.TrimSuffix(id, downSuffix)
+		i, ok := m.revEntries[base+".sql"]
+		j, upOK := m.revEntries[base+upSuffix]
+		switch {
+		case ok && upOK:
+			return &SourceError{Name: id, Err: fmt.Errorf("ambiguous down migration, both %s.sql and %s exist", base, base+upSuffix)}
+		case upOK:
+			i = j
+		case !ok:
+			return &SourceError{Name: id, Err: errors.New("down migration without its migration")}
+		}
+		m.entries[i].down = downs[id]
+		m.entries[i].hasDown = true
+	}
+
+	for i := range m.entries {
+		if err := m.entries[i].validate(); err != nil {
+			return err
+		}
+		if err := m.entries[i].applyDirectives(); err != nil {
+			return err
+		}
+		if m.opts.RejectEmptyMigration && m.opts.normalizerFor(&m.entries[i]).normalize(m.entries[i].statement) == "" {
+			return &EmptyMigrationError{ID: m.entries[i].id}
+		}
+		m.entries[i].hash = m.opts.entryHash(&m.entries[i])
+		if h := m.opts.legacyEntryHash(&m.entries[i]); h != m.entries[i].hash {
+			m.entries[i].legacyHash = h
+		}
+		if m.opts.OneStatementPerFile {
+			if err := m.entries[i].checkOneStatement(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.opts.StrictOrdering {
+		if err := m.checkOrdering(); err != nil {
+			return err
+		}
+	}
+
+	if m.opts.ForceSchemaQualify != "" {
+		if err := m.checkSchemaQualify(); err != nil {
+			return err
+		}
+	}
+
+	if m.opts.ContentAddressed {
+		return m.contentAddress()
+	}
+
+	return nil
+}
+
+// contentAddressedPrefix is the id prefix of migration with Options.ContentAddressed.
+const contentAddressedPrefix = "sha256:"
+
+// contentAddress replace the id of each entry with its content-addressed id, see Options.ContentAddressed.
+func (m *Migration) contentAddress() error {
+	names := make(map[string]string)
+	m.revEntries = make(map[string]int)
+	for i := range m.entries {
+		e := &m.entries[i]
+		id := contentAddressedPrefix + e.hash
+		if name, ok := names[id]; ok {
+			return &SourceError{Name: e.id, Err: fmt.Errorf("%s and %s have the same content", name, e.id)}
+		}
+		names[id] = e.id
+		e.id = id
+		m.revEntries[id] = i
+	}
+	return nil
+}
+
+// repeatablePrefix is the file name prefix of repeatable migration.
+const repeatablePrefix = "r__"
+
+// isRepeatable report whether id is repeatable migration, by its file name, regardless of its directory.
+func isRepeatable(id string) bool {
+	return strings.HasPrefix(path.Base(id), repeatablePrefix)
+}
+
+// entryLess order versioned migrations before repeatable ones, each sorted by id,
+// because repeatable migration usually depends on objects created by the versioned ones.
+func entryLess(a, b string) bool {
+	if ra, rb := isRepeatable(a), isRepeatable(b); ra != rb {
+		return rb
+	}
+	return a < b
+}
+
+// validate the statements of e.
+func (e *entry) validate() error {
+	for _, stmt := range []string{e.statement, e.down} {
+		if line, ok := psqlMetaCommandLine(stmt); ok {
+			return &PsqlMetaCommandError{ID: e.id, Line: line}
+		}
+	}
+	return nil
+}
+
+// checkOneStatement check that e and its down migration have at most one top-level statement.
+func (e *entry) checkOneStatement() error {
+	if n := len(statements(scan(e.statement))); n > 1 {
+		return &MultipleStatementsError{ID: e.id, Count: n}
+	}
+	if n := len(statements(scan(e.down))); n > 1 {
+		return &MultipleStatementsError{ID: downID(e.id), Count: n}
+	}
+	return nil
+}
+
+// applyDirectives parse the directives in e.statement, see New.
+func (e *entry) applyDirectives() error {
+	for _, d := range parseDirectives(e.statement) {
+		switch d.name {
+		case "expect-rows":
+			x, ok := parseRowCountExpectation(d.arg)
+			if !ok {
+				return &DirectiveError{ID: e.id, Line: d.line, Directive: d.name, Reason: "invalid argument: " + d.arg}
+			}
+			e.expectRows = &x
+		case "unordered-grants":
+			for _, stmt := range statements(scan(e.statement)) {
+				if !stmt[0].is("grant") && !stmt[0].is("revoke") {
+					return &DirectiveError{ID: e.id, Line: stmt[0].line, Directive: d.name, Reason: "only grant and revoke statement is allowed"}
+				}
+			}
+			e.unorderedGrants = true
+		case "after":
+			if d.arg == "" || strings.ContainsAny(d.arg, " \t") {
+				return &DirectiveError{ID: e.id, Line: d.line, Directive: d.name, Reason: "invalid argument: " + d.arg}
+			}
+			e.after = append(e.after, d.arg)
+		case "pause":
+			e.pause = true
+		case "no-transaction":
+			if n := len(statements(scan(e.statement))); n != 1 {
+				return &DirectiveError{ID: e.id, Line: d.line, Directive: d.name, Reason: fmt.Sprintf("require exactly one statement, found %d", n)}
+			}
+			e.noTx = true
+		default:
+			return &DirectiveError{ID: e.id, Line: d.line, Directive: d.name, Reason: "unknown directive"}
+		}
+	}
+	return nil
+}
+
+// psqlMetaCommandLine return the line number of the first psql meta-command (like \i or \copy) in sql,
+// they are interpreted by psql client, not by the server, so they cannot be executed by the migration.
+func psqlMetaCommandLine(sql string) (int, bool) {
+	lastLine := 0
+	for _, t := range scan(sql) {
+		if t.line != lastLine && t.kind == tokenPunct && t.text == `\` {
+			return t.line, true
+		}
+		lastLine = t.line + strings.Count(t.text, "\n")
+	}
+	return 0, false
+}
@@ -0,0 +1,314 @@
+package migration
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadPsqlMetaCommand(t *testing.T) {
+	_, err := NewE(testSource(
+		"0001_a.sql", "create table test.a(id int);\n  \\copy test.a from 'a.csv'\n",
+	))
+	var meta *PsqlMetaCommandError
+	if !errors.As(err, &meta) || meta.ID != "0001_a.sql" || meta.Line != 2 {
+		t.Fatalf("should return PsqlMetaCommandError, got %v", err)
+	}
+
+	_, err = NewE(testSource(
+		"0001_a.sql", "create table test.a();",
+		"0001_a.down.sql", "\\i drop.sql",
+	))
+	if !errors.As(err, &meta) || meta.ID != "0001_a.sql" || meta.Line != 1 {
+		t.Fatalf("should check down migration, got %v", err)
+	}
+
+	if _, err := NewE(testSource(
+		"0001_a.sql", "select E'\\n\\\nx', 'a\n\\b';\n-- \\copy in comment\n/*\n\\i in comment */ select 1",
+	)); err != nil {
+		t.Fatalf("backslash inside string or comment should be allowed: %v", err)
+	}
+}
+
+func TestLoadOneStatementPerFile(t *testing.T) {
+	oneStatement := func(o *Options) { o.OneStatementPerFile = true }
+
+	if _, err := NewE(testSource(
+		"0001_a.sql", "-- comment; here\ncreate function test.f() returns int language sql as $$ select 1; $$;\n",
+		"0001_a.down.sql", "drop function test.f()",
+	), oneStatement); err != nil {
+		t.Fatalf("single statement should be accepted, got %v", err)
+	}
+
+	_, err := NewE(testSource(
+		"0001_a.sql", "create table test.a(); create table test.b();",
+	), oneStatement)
+	var multi *MultipleStatementsError
+	if !errors.As(err, &multi) || multi.ID != "0001_a.sql" || multi.Count != 2 {
+		t.Fatalf("should return MultipleStatementsError, got %v", err)
+	}
+
+	_, err = NewE(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0001_a.down.sql", "drop table test.a; select 1",
+	), oneStatement)
+	if !errors.As(err, &multi) || multi.ID != "0001_a.down.sql" || multi.Count != 2 {
+		t.Fatalf("should check down migration, got %v", err)
+	}
+
+	if _, err := NewE(testSource(
+		"0001_a.sql", "create table test.a(); create table test.b();",
+	)); err != nil {
+		t.Fatalf("multiple statements is allowed by default, got %v", err)
+	}
+}
+
+func TestLoadEmptyMigration(t *testing.T) {
+	source := testSource(
+		"0001_a.sql", "-- placeholder for a\n",
+		"0002_b.sql", "/* placeholder for b */",
+		"0003_c.sql", "create table test.c()",
+	)
+
+	m := New(source)
+	if m.entries[0].hash != hash("") || m.entries[0].hash != m.entries[1].hash {
+		t.Fatalf("empty migrations should hash as empty string by default")
+	}
+
+	m = New(source, func(o *Options) { o.EmptyMigrationHash = HashRawContent })
+	if m.entries[0].hash != HashRawContent("", "-- placeholder for a\n") || m.entries[0].hash == m.entries[1].hash {
+		t.Fatalf("empty migrations should be hashed by EmptyMigrationHash")
+	}
+	if m.entries[2].hash != hash("create table test.c()") {
+		t.Fatalf("non-empty migration should not be affected by EmptyMigrationHash")
+	}
+	if err := m.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewE(source, func(o *Options) { o.RejectEmptyMigration = true })
+	var empty *EmptyMigrationError
+	if !errors.As(err, &empty) || empty.ID != "0001_a.sql" {
+		t.Fatalf("should return EmptyMigrationError, got %v", err)
+	}
+}
+
+func TestLoadContentAddressed(t *testing.T) {
+	contentAddressed := func(o *Options) { o.ContentAddressed = true }
+
+	m1 := New(testSource(
+		"0001.sql", "create table test.a()",
+		"0002.sql", "create table test.b()",
+	), contentAddressed)
+	m2 := New(testSource(
+		"0001.sql", "create table test.c()",
+	), contentAddressed)
+	m3 := New(testSource(
+		"0001_renamed.sql", "create table test.a()",
+	), contentAddressed)
+
+	if m1.entries[0].id != contentAddressedPrefix+hash("create table test.a()") {
+		t.Fatalf("invalid content-addressed id %s", m1.entries[0].id)
+	}
+	if m1.entries[1].id != contentAddressedPrefix+hash("create table test.b()") {
+		t.Fatalf("file name should still define the order, got %s", m1.entries[1].id)
+	}
+	if m1.entries[0].id == m2.entries[0].id {
+		t.Fatalf("different content with the same file name should have different id")
+	}
+	if m1.entries[0].id != m3.entries[0].id {
+		t.Fatalf("same content with different file name should have the same id")
+	}
+	if _, ok := m1.revEntries[m1.entries[1].id]; !ok {
+		t.Fatalf("content-addressed id should be indexed")
+	}
+
+	if _, err := NewE(testSource(
+		"0001.sql", "create table test.a()",
+		"0002.sql", "CREATE TABLE test.a();",
+	), contentAddressed); err == nil || !strings.Contains(err.Error(), "0001.sql and 0002.sql") {
+		t.Fatalf("same content should be rejected, got %v", err)
+	}
+}
+
+func TestLoadAppID(t *testing.T) {
+	m := New(testSource(
+		"__APP_ID__.txt", "billing\n",
+		"0001_a.sql", "create table test.a()",
+	))
+	if id := m.AppID(); id != "billing" {
+		t.Fatalf("invalid app id %q", id)
+	}
+	if all := m.All(); len(all) != 1 || all[0].ID != "0001_a.sql" {
+		t.Fatalf("app id file should not be a migration, got %v", all)
+	}
+
+	if id := New(testSource("0001_a.sql", "select 1")).AppID(); id != "" {
+		t.Fatalf("app id should be empty without the file, got %q", id)
+	}
+	if _, err := NewE(testSource("__APP_ID__.txt", "a\nb")); err == nil {
+		t.Fatalf("multi-line app id should be rejected")
+	}
+}
+
+func TestLoadUnorderedGrants(t *testing.T) {
+	m1 := New(testSource(
+		"0001_a.sql", "-- psql-migration:unordered-grants\ngrant select on test.a to app; grant select on test.b to app;",
+	))
+	m2 := New(testSource(
+		"0001_a.sql", "grant select on test.b to app;\n-- psql-migration:unordered-grants\ngrant select on test.a to app;",
+	))
+	if m1.entries[0].hash != m2.entries[0].hash {
+		t.Fatalf("reordered grants should hash the same with unordered-grants directive")
+	}
+
+	if _, err := NewE(testSource(
+		"0001_a.sql", "-- psql-migration:unordered-grants\ngrant select on test.a to app;\ncreate table test.b();",
+	)); err == nil || !strings.Contains(err.Error(), "at line 3") {
+		t.Fatalf("should reject non grant statement, got %v", err)
+	}
+}
+
+func TestLoadRepeatableOrder(t *testing.T) {
+	m := New(testSource(
+		"r__views.sql", "create or replace view test.v as select * from test.a",
+		"0001_a.sql", "create table test.a()",
+		"r__functions.sql", "create or replace function test.f() returns int language sql as 'select 1'",
+		"seed.sql", "insert into test.a default values",
+		"0002_b.sql", "create table test.b()",
+	))
+
+	var ids []string
+	for _, it := range m.All() {
+		ids = append(ids, it.ID)
+	}
+	want := []string{"0001_a.sql", "0002_b.sql", "seed.sql", "r__functions.sql", "r__views.sql"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("versioned migrations should be ordered before repeatable ones, got %v", ids)
+	}
+	if next := m.NextID(); next != "0003" {
+		t.Fatalf("repeatable migration should not affect next id, got %s", next)
+	}
+}
+
+func TestRunRepeatableOrder(t *testing.T) {
+	target := testTarget(t)
+
+	m := New(testSource(
+		"r__view.sql", "create or replace view test.v as select * from test.users",
+		"0001_users.sql", "create table test.users(id int)",
+		"users_name.sql", "alter table test.users add column name text",
+	))
+	list, err := m.Run(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0001_users.sql", "users_name.sql", "r__view.sql"}; !reflect.DeepEqual(list, want) {
+		t.Fatalf("invalid execution order %v", list)
+	}
+
+	if d, err := m.VerifyApplyOrder(target); err != nil || len(d) != 0 {
+		t.Fatalf("should be applied in order, got %v, %v", d, err)
+	}
+	if err := m.VerifyChain(target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunRepeatableChanged(t *testing.T) {
+	target := testTarget(t)
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(id int)",
+		"r__v.sql", "create or replace view test.v as select id from test.a",
+	))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	m = New(testSource(
+		"0001_a.sql", "create table test.a(id int)",
+		"0002_b.sql", "alter table test.a add column name text",
+		"r__v.sql", "create or replace view test.v as select id, name from test.a",
+	))
+	list, err := m.Run(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0002_b.sql", "r__v.sql"}; !reflect.DeepEqual(list, want) {
+		t.Fatalf("changed repeatable migration should be re-executed after the versioned ones, got %v", list)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("hash of repeatable migration should be updated, got %v, %v", list, err)
+	}
+	if list, err := m.Run(target); err != nil || len(list) != 0 {
+		t.Fatalf("unchanged repeatable migration should not be re-executed, got %v, %v", list, err)
+	}
+
+	_, err = New(testSource(
+		"0001_a.sql", "create table test.a(id bigint)",
+		"0002_b.sql", "alter table test.a add column name text",
+		"r__v.sql", "create or replace view test.v as select id, name from test.a",
+	)).Run(target)
+	var mismatch *MismatchHashError
+	if !errors.As(err, &mismatch) || mismatch.ID != "0001_a.sql" {
+		t.Fatalf("changed versioned migration should still fail, got %v", err)
+	}
+}
+
+func TestLoadSubdirectories(t *testing.T) {
+	m := New(testSource(
+		"v2/r__view.sql", "create or replace view test.v as select * from test.a",
+		"v2/0050_feature.sql", "alter table test.a add column name text",
+		"v1/0001_init.sql", "create table test.a(id int)",
+		"v1/0001_init.down.sql", "drop table test.a",
+	))
+
+	var ids []string
+	for _, it := range m.All() {
+		ids = append(ids, it.ID)
+	}
+	if want := []string{"v1/0001_init.sql", "v2/0050_feature.sql", "v2/r__view.sql"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("id should be the relative path, in global order, got %v", ids)
+	}
+	if e := m.entries[0]; !e.hasDown || e.down != "drop table test.a" {
+		t.Fatalf("down migration should be matched in the same directory")
+	}
+	if next := m.NextID(); next != "0051" {
+		t.Fatalf("next id should consider the file name only, got %s", next)
+	}
+
+	if _, err := NewE(testSource("v1/0001_a.sql", "select 1", "v2/0001_a.down.sql", "select 1")); err == nil {
+		t.Fatalf("down migration in other directory should be rejected")
+	}
+}
+
+func TestNewESourceError(t *testing.T) {
+	for _, tc := range []struct {
+		source fs.FS
+		name   string
+	}{
+		{fstest.MapFS{"a.sql": &fstest.MapFile{}}, "."},
+		{testSource("0001_a.sql", "select 1", "V2/0002_b.sql", "select 1"), "V2/0002_b.sql"},
+		{testSource("0001_a.sql", "select 1", "0002_b.sql~", "select 1"), "0002_b.sql~"},
+		{testSource("0001_A.sql", "select 1"), "0001_A.sql"},
+		{testSource("0001_a.down.sql", "select 1"), "0001_a.down.sql"},
+		{testSource(appIDFile, "a\nb"), appIDFile},
+	} {
+		m, err := NewE(tc.source)
+		var src *SourceError
+		if m != nil || !errors.As(err, &src) || src.Name != tc.name {
+			t.Fatalf("should return SourceError for %s, got %v", tc.name, err)
+		}
+	}
+
+	if _, err := NewE(testSource("0001_a.sql", "select 1")); err != nil {
+		t.Fatalf("valid source should not return error, got %v", err)
+	}
+	if _, err := NewE(testSource("0001_a.sql", "select 1"), WithSchema("Invalid")); err == nil {
+		t.Fatalf("invalid options should return error")
+	}
+}
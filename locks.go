@@ -0,0 +1,153 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Blocker is another session that hold a lock needed by the migration.
+type Blocker struct {
+	PID             int
+	ApplicationName string
+	State           string
+	Query           string
+
+	// TxAge is how long its current transaction has been open, zero if it is not in transaction
+	TxAge time.Duration
+}
+
+// blockerColumns is the columns of pg_stat_activity a scanned by scanBlockers.
+const blockerColumns = `` +
+	`a.pid, coalesce(a.application_name, ''), coalesce(a.state, ''), coalesce(a.query, ''), ` +
+	`coalesce(extract(epoch from now() - a.xact_start), 0)::float8`
+
+// lockMeta lock the meta table, or the lock table with Options.LockTable, conn must be in transaction.
+//
+// with Options.NoWait, it return *LockHeldError instead of waiting when the table is already locked,
+// in that case the transaction is already rolled back.
+func (m *Migration) lockMeta(ctx context.Context, conn *pgx.Conn) error {
+	nowait := ""
+	if m.opts.NoWait {
+		nowait = " nowait"
+	}
+	_, err := conn.Exec(ctx, `lock table `+m.opts.lockIdent()+` in access exclusive mode`+nowait)
+
+	var pgErr *pgconn.PgError
+	if m.opts.NoWait && errors.As(err, &pgErr) && pgErr.Code == "55P03" {
+		if _, err := conn.Exec(ctx, `rollback`); err != nil {
+			return err
+		}
+		blockers, err := queryBlockers(ctx, conn, m.opts.lockIdent())
+		if err != nil {
+			return err
+		}
+		return &LockHeldError{Blockers: blockers}
+	}
+	if kind := m.opts.timeoutKind(err); kind != "" {
+		return &TimeoutError{Kind: kind, Err: err}
+	}
+
+	return err
+}
+
+// advisoryLockKey return the key of the advisory lock taken with Options.AdvisoryLock, derived from the meta table
+// name, so migrations with different meta table don't exclude each other.
+func (o *Options) advisoryLockKey() int64 {
+	sum := sha256.Sum256([]byte("psql-migration " + o.metaIdent()))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// lockAdvisory take the session level advisory lock of Options.AdvisoryLock.
+//
+// with Options.NoWait, it return *LockHeldError instead of waiting when the lock is already held.
+func (m *Migration) lockAdvisory(ctx context.Context, conn *pgx.Conn) error {
+	key := m.opts.advisoryLockKey()
+	if !m.opts.NoWait {
+		_, err := conn.Exec(ctx, `select pg_advisory_lock($1)`, key)
+		return err
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `select pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil || locked {
+		return err
+	}
+	blockers, err := queryAdvisoryBlockers(ctx, conn, key)
+	if err != nil {
+		return err
+	}
+	return &LockHeldError{Blockers: blockers}
+}
+
+// queryAdvisoryBlockers return other sessions that hold the advisory lock of key.
+func queryAdvisoryBlockers(ctx context.Context, conn *pgx.Conn, key int64) ([]Blocker, error) {
+	// bigint key is stored as classid (high 32 bits) and objid (low 32 bits), with objsubid 1
+	rows, err := conn.Query(ctx, ``+
+		`select `+blockerColumns+` `+
+		`from pg_locks l join pg_stat_activity a on a.pid = l.pid `+
+		`where l.locktype = 'advisory' and l.objsubid = 1 `+
+		`and l.classid::bigint = ($1::bigint >> 32) & 4294967295 and l.objid::bigint = $1::bigint & 4294967295 `+
+		`and l.granted and l.pid <> pg_backend_pid() `+
+		`order by a.pid`,
+		key,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlockers(rows)
+}
+
+// queryBlockers return other sessions that hold lock on the table.
+func queryBlockers(ctx context.Context, conn *pgx.Conn, table string) ([]Blocker, error) {
+	rows, err := conn.Query(ctx, ``+
+		`select `+blockerColumns+` `+
+		`from pg_locks l join pg_stat_activity a on a.pid = l.pid `+
+		`where l.locktype = 'relation' and l.relation = to_regclass($1) `+
+		`and l.granted and l.pid <> pg_backend_pid() `+
+		`order by a.pid`,
+		table,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlockers(rows)
+}
+
+// queryOpenTransactions return other client sessions in the same database that are in transaction, oldest first.
+func queryOpenTransactions(ctx context.Context, conn *pgx.Conn) ([]Blocker, error) {
+	rows, err := conn.Query(ctx, ``+
+		`select `+blockerColumns+` from pg_stat_activity a `+
+		`where a.datname = current_database() and a.backend_type = 'client backend' `+
+		`and a.xact_start is not null and a.pid <> pg_backend_pid() `+
+		`order by a.xact_start, a.pid`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlockers(rows)
+}
+
+func scanBlockers(rows pgx.Rows) ([]Blocker, error) {
+	defer rows.Close()
+
+	var ret []Blocker
+	for rows.Next() {
+		var b Blocker
+		var age float64
+		if err := rows.Scan(&b.PID, &b.ApplicationName, &b.State, &b.Query, &age); err != nil {
+			return nil, err
+		}
+		b.TxAge = time.Duration(age * float64(time.Second))
+		ret = append(ret, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,224 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockHeldErrorMessage(t *testing.T) {
+	err := &LockHeldError{Blockers: []Blocker{{PID: 12345, ApplicationName: "foo"}}}
+	if msg := err.Error(); msg != `meta table is locked by another session: pid 12345 (application "foo")` {
+		t.Fatalf("invalid message: %s", msg)
+	}
+}
+
+func TestRunNoWait(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource("0001_a.sql", "create table test.a()"), func(o *Options) { o.NoWait = true })
+
+	holder, err := new(Options).setupConn(bgCtx, withRuntimeParam(t, target, "application_name", "holder"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close(bgCtx)
+	if _, err := holder.Exec(bgCtx, `begin; lock table `+new(Options).metaIdent()+` in access exclusive mode`); err != nil {
+		t.Fatal(err)
+	}
+	var pid int
+	if err := holder.QueryRow(bgCtx, `select pg_backend_pid()`).Scan(&pid); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Run(target)
+	var held *LockHeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("Run should return LockHeldError, got %v", err)
+	}
+	if len(held.Blockers) != 1 || held.Blockers[0].PID != pid || held.Blockers[0].ApplicationName != "holder" {
+		t.Fatalf("invalid blockers: %#v", held.Blockers)
+	}
+
+	if _, err := holder.Exec(bgCtx, `rollback`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatalf("Run should succeed once the lock is released: %v", err)
+	}
+}
+
+func TestRunProcessLockKey(t *testing.T) {
+	target := testTarget(t)
+	const key = 42
+	m := New(testSource("0001_a.sql", "create table test.a()"), func(o *Options) { o.ProcessLockKey = key })
+
+	other, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(bgCtx)
+	if _, err := other.Exec(bgCtx, `select pg_advisory_lock($1)`, key); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Run(target)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Run should wait for the process lock, returned %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	if _, err := other.Exec(bgCtx, `select pg_advisory_unlock($1)`, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var locked bool
+	if err := other.QueryRow(bgCtx, `select pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatalf("Run should release the process lock")
+	}
+}
+
+func TestRunLockTable(t *testing.T) {
+	target := testTarget(t)
+	lockTable := func(o *Options) { o.LockTable = true }
+	m := New(testSource("0001_a.sql", "create table test.a()"), lockTable)
+
+	r, err := m.begin(bgCtx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+
+	// readers would wait forever on locked meta table, fail fast instead
+	reader := withRuntimeParam(t, target, "lock_timeout", "1s")
+	if list, err := m.Check(reader); err != nil || len(list) != 1 {
+		t.Fatalf("Check should not be blocked by in-progress Run, got %v, %v", list, err)
+	}
+
+	_, err = New(testSource("0001_a.sql", "create table test.a()"), lockTable, func(o *Options) {
+		o.NoWait = true
+	}).Run(target)
+	var held *LockHeldError
+	if !errors.As(err, &held) || len(held.Blockers) != 1 {
+		t.Fatalf("another Run should still be excluded, got %v", err)
+	}
+}
+
+func TestAdvisoryLockKey(t *testing.T) {
+	key := func(opts ...Option) int64 {
+		o, err := newOptions(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o.advisoryLockKey()
+	}
+	if key() != key() {
+		t.Fatalf("advisory lock key should be stable")
+	}
+	if key() == key(WithSchema("other")) || key() == key(WithTable("other")) {
+		t.Fatalf("advisory lock key should depend on the meta table")
+	}
+}
+
+func TestRunAdvisoryLock(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource("0001_a.sql", "create table test.a()"), WithAdvisoryLock(true))
+
+	r, err := m.begin(bgCtx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// readers would wait forever on locked meta table, fail fast instead
+	reader := withRuntimeParam(t, target, "lock_timeout", "1s")
+	if list, err := m.Check(reader); err != nil || len(list) != 1 {
+		t.Fatalf("Check should not be blocked by in-progress Run, got %v, %v", list, err)
+	}
+
+	_, err = New(testSource("0001_a.sql", "create table test.a()"), WithAdvisoryLock(true), func(o *Options) {
+		o.NoWait = true
+	}).Run(target)
+	var held *LockHeldError
+	if !errors.As(err, &held) || len(held.Blockers) != 1 {
+		t.Fatalf("another Run should be excluded, got %v", err)
+	}
+
+	r.close()
+
+	failing := New(testSource("0001_a.sql", "select 1/0"), WithAdvisoryLock(true))
+	if _, err := failing.Run(target); err == nil {
+		t.Fatalf("Run should fail")
+	}
+
+	other, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(bgCtx)
+	var locked bool
+	if err := other.QueryRow(bgCtx, `select pg_try_advisory_lock($1)`, new(Options).advisoryLockKey()).Scan(&locked); err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatalf("Run should release the advisory lock on error")
+	}
+}
+
+func TestRunWarnOnBlockers(t *testing.T) {
+	target := testTarget(t)
+
+	other, err := new(Options).connect(bgCtx, withRuntimeParam(t, target, "application_name", "report"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(bgCtx)
+	if _, err := other.Exec(bgCtx, `begin; select 1`); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	tooOld := errors.New("too old")
+	var warned []Blocker
+	m := New(testSource("0001_a.sql", "create table test.a()"), func(o *Options) {
+		o.WarnOnBlockers = func(blockers []Blocker) error {
+			warned = blockers
+			for _, b := range blockers {
+				if b.ApplicationName == "report" && b.TxAge >= 100*time.Millisecond {
+					return tooOld
+				}
+			}
+			return nil
+		}
+	})
+
+	_, err = m.Run(target)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) || !errors.Is(err, tooOld) {
+		t.Fatalf("should return BlockedError, got %v", err)
+	}
+	if len(warned) != 1 || warned[0].ApplicationName != "report" || warned[0].State != "idle in transaction" {
+		t.Fatalf("invalid blockers %#v", warned)
+	}
+
+	if _, err := other.Exec(bgCtx, `rollback`); err != nil {
+		t.Fatal(err)
+	}
+	warned = nil
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if warned != nil {
+		t.Fatalf("should not be called without open transaction, got %#v", warned)
+	}
+}
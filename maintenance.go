@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// setMaintenance set or clear the maintenance flag, conn must not be in transaction,
+// so the flag is visible to other sessions immediately.
+func (o *Options) setMaintenance(ctx context.Context, conn *pgx.Conn, active bool) error {
+	_, err := conn.Exec(ctx, ``+
+		`insert into `+o.maintenanceIdent()+`(active) values ($1) `+
+		`on conflict (id) do update set active = excluded.active, at = now()`,
+		active,
+	)
+	return err
+}
+
+// queryMaintenance return the maintenance flag, false if the maintenance table doesn't exist.
+func (o *Options) queryMaintenance(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `select to_regclass($1) is not null`, o.maintenanceIdent()).Scan(&exists); err != nil || !exists {
+		return false, err
+	}
+	var active bool
+	err := conn.QueryRow(ctx, `select active from `+o.maintenanceIdent()).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return active, err
+}
+
+// InMaintenance report whether Run with Options.Maintenance is in progress on target.
+//
+// it is meant to be polled by the application, so it only read the flag and never modify the database.
+func (m *Migration) InMaintenance(target string) (bool, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, target)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(bgCtx)
+
+	return m.opts.queryMaintenance(bgCtx, conn)
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	target := testTarget(t)
+	maintenance := func(o *Options) { o.Maintenance = true }
+
+	// the migration itself fail unless the flag is visible while it is running
+	assertActive := `do $$ begin ` +
+		`if not (select active from go_migration.maintenance) then raise exception 'maintenance flag is not set'; end if; ` +
+		`end $$`
+
+	if active, err := New(testSource()).InMaintenance(target); err != nil || active {
+		t.Fatalf("flag should be cleared before the first run, got %v, %v", active, err)
+	}
+
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", assertActive,
+	)
+	if _, err := New(source, maintenance).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if active, err := New(source).InMaintenance(target); err != nil || active {
+		t.Fatalf("flag should be cleared after run, got %v, %v", active, err)
+	}
+
+	failing := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", assertActive,
+		"0003_c.sql", "select pg_sleep(0.5); select 1/0",
+	)
+	if _, err := New(failing, maintenance).Run(target); err == nil {
+		t.Fatalf("run should fail")
+	}
+	if active, err := New(failing).InMaintenance(target); err != nil || active {
+		t.Fatalf("flag should be cleared after failed run, got %v, %v", active, err)
+	}
+
+	// concurrent Run that fail to get the lock should not clear the flag of the running one
+	slow := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", assertActive,
+		"0003_c.sql", "select pg_sleep(1)",
+		"0004_d.sql", assertActive,
+	)
+	done := make(chan error)
+	go func() {
+		_, err := New(slow, maintenance).Run(target)
+		done <- err
+	}()
+	time.Sleep(300 * time.Millisecond)
+	nowait := func(o *Options) { o.NoWait = true }
+	if _, err := New(slow, maintenance, nowait).Run(target); !errors.As(err, new(*LockHeldError)) {
+		t.Fatalf("concurrent run should return LockHeldError, got %v", err)
+	}
+	if active, err := New(slow).InMaintenance(target); err != nil || !active {
+		t.Fatalf("flag should still be set while the first run is running, got %v, %v", active, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsRegisterer create the metrics exposed by the migration.
+//
+// it is intentionally small, so it can be implemented on top of prometheus.Registerer
+// without this package depending on the prometheus client library.
+type MetricsRegisterer interface {
+	NewCounter(name, help string) Counter
+	NewGauge(name, help string) Gauge
+	NewHistogram(name, help string) Histogram
+}
+
+// Counter is satisfied by prometheus.Counter.
+type Counter interface{ Add(float64) }
+
+// Gauge is satisfied by prometheus.Gauge.
+type Gauge interface{ Set(float64) }
+
+// Histogram is satisfied by prometheus.Histogram.
+type Histogram interface{ Observe(float64) }
+
+type metrics struct {
+	applied  Counter
+	duration Histogram
+	pending  Gauge
+}
+
+func newMetrics(r MetricsRegisterer) *metrics {
+	if r == nil {
+		return nil
+	}
+	return &metrics{
+		applied: r.NewCounter(
+			"migrations_applied_total",
+			"Total number of migrations applied.",
+		),
+		duration: r.NewHistogram(
+			"migration_duration_seconds",
+			"Execution time of each applied migration.",
+		),
+		pending: r.NewGauge(
+			"migrations_pending",
+			"Number of migrations not yet applied to the database.",
+		),
+	}
+}
+
+// all methods of metrics are no-op on nil receiver, so it cost nothing when not configured
+
+func (mt *metrics) observeDuration(d time.Duration) {
+	if mt == nil {
+		return
+	}
+	mt.duration.Observe(d.Seconds())
+}
+
+func (mt *metrics) addApplied(n int) {
+	if mt == nil {
+		return
+	}
+	mt.applied.Add(float64(n))
+}
+
+func (mt *metrics) setPending(n int) {
+	if mt == nil {
+		return
+	}
+	mt.pending.Set(float64(n))
+}
+
+// metricsSnapshot is the state of the target database written by WriteMetrics.
+type metricsSnapshot struct {
+	pending     int
+	applied     int
+	drifted     int
+	lastApplied time.Time // zero if nothing is applied
+}
+
+// WriteMetrics write the migration state of the target database to w in OpenMetrics text format,
+// so small exporter can serve it without the prometheus client library:
+//
+//	migrations_pending                        number of migrations not yet applied
+//	migrations_applied                        number of rows in the meta table
+//	migrations_drifted                        number of applied migrations with different hash in the source
+//	migrations_last_applied_timestamp_seconds when the last migration was applied, omitted if none
+//
+// drifted and orphaned migrations don't make it fail, they are counted as applied instead.
+// WriteMetrics never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) WriteMetrics(target string, w io.Writer) error {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	inDB, err := m.opts.queryMeta(bgCtx, conn)
+	if err != nil {
+		return err
+	}
+
+	// count the pending migrations as if the drifts and the orphans are accepted, without touching the registered metrics
+	acceptDrift := *m
+	acceptDrift.opts.OnDrift = func(err *MismatchHashError) error { return nil }
+	acceptDrift.opts.OnOrphan = func(err *OrphanedMigrationError) error { return nil }
+	acceptDrift.metrics = nil
+	list, err := acceptDrift.pending(inDB)
+	if err != nil {
+		return err
+	}
+
+	s := metricsSnapshot{pending: len(list), applied: len(inDB), drifted: len(m.drifted(inDB))}
+	if len(inDB) > 0 {
+		if err := conn.QueryRow(bgCtx, ``+
+			`select max(at) from `+m.opts.metaIdent(),
+		).Scan(&s.lastApplied); err != nil {
+			return err
+		}
+	}
+
+	return s.write(w)
+}
+
+func (s metricsSnapshot) write(w io.Writer) error {
+	var b strings.Builder
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n# HELP %s %s\n%s %s\n", name, name, help, name, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	gauge("migrations_pending", "Number of migrations not yet applied to the database.", float64(s.pending))
+	gauge("migrations_applied", "Number of migrations applied to the database.", float64(s.applied))
+	gauge("migrations_drifted", "Number of applied migrations that changed in the source.", float64(s.drifted))
+	if !s.lastApplied.IsZero() {
+		gauge("migrations_last_applied_timestamp_seconds", "When the last migration was applied.",
+			float64(s.lastApplied.UnixNano())/float64(time.Second))
+	}
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,143 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type fakeMetric struct{ value float64 }
+
+func (f *fakeMetric) Add(v float64)     { f.value += v }
+func (f *fakeMetric) Set(v float64)     { f.value = v }
+func (f *fakeMetric) Observe(v float64) { f.value += v }
+
+type fakeRegisterer map[string]*fakeMetric
+
+func (f fakeRegisterer) register(name string) *fakeMetric {
+	m := &fakeMetric{}
+	f[name] = m
+	return m
+}
+
+func (f fakeRegisterer) NewCounter(name, help string) Counter     { return f.register(name) }
+func (f fakeRegisterer) NewGauge(name, help string) Gauge         { return f.register(name) }
+func (f fakeRegisterer) NewHistogram(name, help string) Histogram { return f.register(name) }
+
+func TestMetrics(t *testing.T) {
+	reg := make(fakeRegisterer)
+	m := New(fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("create table a()")},
+	}, func(o *Options) { o.MetricsRegisterer = reg })
+
+	for _, name := range []string{
+		"migrations_applied_total",
+		"migration_duration_seconds",
+		"migrations_pending",
+	} {
+		if _, ok := reg[name]; !ok {
+			t.Fatalf("%s should be registered", name)
+		}
+	}
+
+	m.metrics.setPending(3)
+	m.metrics.observeDuration(1500 * time.Millisecond)
+	m.metrics.addApplied(2)
+
+	if v := reg["migrations_pending"].value; v != 3 {
+		t.Fatalf("invalid migrations_pending %v", v)
+	}
+	if v := reg["migration_duration_seconds"].value; v != 1.5 {
+		t.Fatalf("invalid migration_duration_seconds %v", v)
+	}
+	if v := reg["migrations_applied_total"].value; v != 2 {
+		t.Fatalf("invalid migrations_applied_total %v", v)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	m := New(fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("create table a()")},
+	})
+	if m.metrics != nil {
+		t.Fatalf("metrics should be nil when MetricsRegisterer is not set")
+	}
+
+	// must not panic
+	m.metrics.setPending(1)
+	m.metrics.observeDuration(time.Second)
+	m.metrics.addApplied(1)
+}
+
+func TestMetricsSnapshotWrite(t *testing.T) {
+	var b strings.Builder
+	s := metricsSnapshot{pending: 2, applied: 3, drifted: 1, lastApplied: time.Unix(1650000000, 500000000)}
+	if err := s.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"# TYPE migrations_pending gauge\n" +
+		"# HELP migrations_pending Number of migrations not yet applied to the database.\n" +
+		"migrations_pending 2\n" +
+		"# TYPE migrations_applied gauge\n" +
+		"# HELP migrations_applied Number of migrations applied to the database.\n" +
+		"migrations_applied 3\n" +
+		"# TYPE migrations_drifted gauge\n" +
+		"# HELP migrations_drifted Number of applied migrations that changed in the source.\n" +
+		"migrations_drifted 1\n" +
+		"# TYPE migrations_last_applied_timestamp_seconds gauge\n" +
+		"# HELP migrations_last_applied_timestamp_seconds When the last migration was applied.\n" +
+		"migrations_last_applied_timestamp_seconds 1650000000.5\n" +
+		"# EOF\n"
+	if b.String() != expected {
+		t.Fatalf("invalid output:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := (metricsSnapshot{pending: 1}).write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "last_applied") {
+		t.Fatalf("last applied timestamp should be omitted when nothing is applied:\n%s", b.String())
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	target := testTarget(t)
+
+	if _, err := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	)).Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := make(fakeRegisterer)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b(id int)",
+		"0003_c.sql", "create table test.c()",
+	), func(o *Options) { o.MetricsRegisterer = reg })
+
+	var b strings.Builder
+	if err := m.WriteMetrics(target, &b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"\nmigrations_pending 1\n",
+		"\nmigrations_applied 2\n",
+		"\nmigrations_drifted 1\n",
+		"\nmigrations_last_applied_timestamp_seconds ",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Fatalf("output should contain %q:\n%s", line, b.String())
+		}
+	}
+	if !strings.HasSuffix(b.String(), "# EOF\n") {
+		t.Fatalf("output should end with EOF marker:\n%s", b.String())
+	}
+	if reg["migrations_pending"].value != 0 {
+		t.Fatalf("registered metrics should not be touched")
+	}
+}
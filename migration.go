@@ -1,136 +1,363 @@
 package migration
 
 import (
-	"embed"
-	"fmt"
+	"context"
 	"io/fs"
-	"sort"
 	"strings"
 
 	"github.com/jackc/pgx/v4"
 )
 
 type entry struct {
-	id        string
-	statement string
-	hash      string
+	id         string
+	statement  string
+	hash       string
+	legacyHash string // hash computed by older version, if different, see hashMatches
+	down       string // statement of the paired down migration
+	hasDown    bool
+	replaces   []entry // migrations squashed into this one, see Squash
+
+	expectRows      *rowCountExpectation // from expect-rows directive
+	unorderedGrants bool                 // from unordered-grants directive
+	after           []string             // from after directive
+	noTx            bool                 // from no-transaction directive
+	pause           bool                 // from pause directive
+}
+
+// hashMatches report whether h, the hash recorded in database, is the hash of e.
+//
+// hash recorded by older version is accepted too, so changes in normalization
+// doesn't turn every already applied migration into a mismatch.
+func (e *entry) hashMatches(h string) bool {
+	return h == e.hash || (e.legacyHash != "" && h == e.legacyHash)
+}
+
+const (
+	downSuffix = ".down.sql"
+	upSuffix   = ".up.sql"
+)
+
+// downID return the file name of the down migration of migration id.
+func downID(id string) string {
+	if strings.HasSuffix(id, upSuffix) {
+		return strings.TrimSuffix(id, upSuffix) + downSuffix
+	}
+	return strings.TrimSuffix(id, ".sql") + downSuffix
 }
 
 type Migration struct {
 	entries    []entry
 	revEntries map[string]int
+	replacedBy map[string]int // id of squashed migration to index of its baseline entry
+	opts       Options
+	metrics    *metrics
+
+	unqualified []UnqualifiedObject // see Options.ForceSchemaQualify
+	appID       string              // from appIDFile
+}
+
+// appIDFile is the file in the source that contains the app id, see New.
+const appIDFile = "__APP_ID__.txt"
+
+// AppID return the app id read from __APP_ID__.txt in the source, or empty string if there is none.
+// it is the default of Options.AppID.
+func (m *Migration) AppID() string {
+	return m.appID
 }
 
 // New return new Migration object.
 //
-// source must contains exactly one directory, and that directory must contains only *.sql file.
-// each sql file must have lowercase name.
+// source must contains exactly one directory, and that directory must contains only *.sql file,
+// and optionally __APP_ID__.txt that contains the app id, see AppID. the sql files can be grouped in
+// subdirectories, like "v1/0001_init.sql", in that case the id of the migration is its path relative to the
+// directory, which must be lowercase.
+//
+// the migration is sorted by sql file name, except repeatable migration (file prefixed with "r__"),
+// which is always sorted after all other migrations, because it usually depends on objects created by them.
+// unlike versioned migration, changing repeatable migration doesn't cause *MismatchHashError, it become pending
+// again and Run re-execute it and update its hash, so it must be idempotent, like "create or replace view".
+//
+// file named "xxx.down.sql" is not a migration, it is the down migration that reverse "xxx.sql",
+// or "xxx.up.sql", see Rollback.
+//
+// source is usually an embed.FS, opts can be used to tune the behaviour of the migration.
+//
+// migration can contains directive in line comment starting with "psql-migration:",
+// unknown or invalid directive make New panic:
+//
+//	-- psql-migration:expect-rows >= 1
+//
+// expect-rows make Run fail with *RowCountError when the number of rows affected by the migration
+// doesn't satisfy the comparison (==, !=, >=, <=, >, or <). if the migration has multiple statements,
+// only the last one is counted, like the command tag reported by postgres.
+//
+//	-- psql-migration:unordered-grants
+//
+// unordered-grants make the hash ignore the order of the statements, so reordering them doesn't
+// cause *MismatchHashError. the migration can only contains grant and revoke statements.
+//
+//	-- psql-migration:after 0005_x.sql
+//
+// after make Check and Run fail with *MissingPrerequisiteError when the migration is pending but 0005_x.sql
+// is neither executed nor executed before it in the same Run. it can be repeated for multiple prerequisites.
+//
+//	-- psql-migration:no-transaction
 //
-// the migration is sorted by sql file name.
-func New(source embed.FS) *Migration {
-	list, err := fs.ReadDir(source, ".")
+// no-transaction make Run execute the migration outside the transaction, for statement that cannot run inside
+// transaction block, like "create index concurrently". Run commit the migrations before it, execute it alone,
+// then reopen the transaction and lock the meta table again for the rest. it must contain exactly one statement.
+// it cannot be rolled back, so when it fail halfway, e.g. leaving invalid index, the database is left partially
+// changed and Run refuse to continue with *DirtyMigrationError until it is fixed manually. the meta table is
+// unlocked while it is executed, concurrent Run fail with *DirtyMigrationError meanwhile, use Options.ProcessLockKey
+// or Options.AdvisoryLock to make it wait instead. when Run fail after the migrations before it are committed,
+// they are returned together with the error.
+//
+//	-- psql-migration:pause
+//
+// pause make Run stop right after the migration, commit it together with the migrations before it, and return
+// *PausedError, so the rest can be executed by the next Run after manual approval.
+//
+// New panic on invalid source or options, use NewE when the source is not known at compile time.
+func New(source fs.FS, opts ...Option) *Migration {
+	m, err := NewE(source, opts...)
 	if err != nil {
 		panic(err)
 	}
-	if len(list) != 1 || !list[0].IsDir() {
-		panic("migration: source should have single dir in the root")
+	return m
+}
+
+// NewE is like New, but return the error instead of panic, e.g. to validate user-supplied directory.
+//
+// invalid layout, like non-sql file, uppercase file name, or duplicate entry, is reported as *SourceError,
+// other errors are the same as the ones New panic with, like *PsqlMetaCommandError.
+func NewE(source fs.FS, opts ...Option) (*Migration, error) {
+	m := &Migration{revEntries: make(map[string]int)}
+	m.opts.AutoCreateMeta = true
+	for _, o := range opts {
+		o(&m.opts)
+	}
+	if err := m.opts.validate(); err != nil {
+		return nil, err
 	}
 
-	sub, err := fs.Sub(source, list[0].Name())
-	if err != nil {
-		panic(err)
+	if err := m.load(source); err != nil {
+		return nil, err
 	}
+	m.metrics = newMetrics(m.opts.MetricsRegisterer)
 
-	m := &Migration{revEntries: make(map[string]int)}
+	return m, nil
+}
 
-	if err := fs.WalkDir(sub, ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			panic(err)
-		}
-		if path == "." {
-			return nil
-		}
+// Check the current state of the database.
+//
+// will return list of migration that need to be executed.
+//
+// also will return *MismatchHashError error if the database already execute a migration file
+// but it has different hash with source, or *OrphanedMigrationError listing every migration executed
+// in the database that is no longer in the source, e.g. the file is deleted or renamed, unless accepted by
+// Options.OnOrphan.
+//
+// Check never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+// it connects with default_transaction_read_only, so any write fail, like the other functions that never
+// modify the database.
+func (m *Migration) Check(target string) ([]string, error) {
+	return m.CheckContext(bgCtx, target)
+}
 
-		name := d.Name()
-		if d.IsDir() {
-			panic(fmt.Sprintf("migration: cannot include directory: %s", name))
-		}
-		if !strings.HasSuffix(name, ".sql") {
-			panic(fmt.Sprintf("migration: must ending with .sql: %s", name))
-		}
-		if strings.ToLower(name) != name {
-			panic(fmt.Sprintf("migration: must have lowercase name: %s", name))
-		}
+// CheckContext is like Check, but ctx can be used to cancel it or set its deadline.
+func (m *Migration) CheckContext(ctx context.Context, target string) ([]string, error) {
+	conn, err := m.opts.connectReadOnly(ctx, m.opts.readTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+	return m.check(ctx, conn)
+}
 
-		data, err := fs.ReadFile(sub, name)
-		if err != nil {
-			panic(err)
-		}
+// AssertUpToDate return nil if there is no pending migration in the target database.
+//
+// will return *PendingMigrationsError listing the pending migrations, or *MismatchHashError and *OrphanedMigrationError like Check.
+// it is meant to be called at application startup to refuse running against outdated database.
+func (m *Migration) AssertUpToDate(target string) error {
+	list, err := m.Check(target)
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return &PendingMigrationsError{Pending: list}
+	}
+	return nil
+}
 
-		stmt := string(data)
-		e := entry{name, stmt, hash(stmt)}
-		m.entries = append(m.entries, e)
+// IsUpToDate report whether there is no pending migration in the target database.
+func (m *Migration) IsUpToDate(target string) (bool, error) {
+	list, err := m.Check(target)
+	if err != nil {
+		return false, err
+	}
+	return len(list) == 0, nil
+}
 
-		return nil
-	}); err != nil {
-		panic(err)
+// PendingCount return the number of pending migrations in the target database, computed by a single query,
+// meant for dashboard and alert threshold.
+//
+// unlike Check, it only compare the ids, it doesn't verify the hashes or report other inconsistency,
+// except repeatable migration with changed hash, which is counted as pending like Check.
+// PendingCount never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) PendingCount(target string) (int, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return 0, err
 	}
+	defer conn.Close(bgCtx)
 
-	sort.Slice(m.entries, func(i, j int) bool { return m.entries[i].id < m.entries[j].id })
+	return m.queryPendingCount(bgCtx, conn)
+}
 
-	for i, e := range m.entries {
-		if _, ok := m.revEntries[e.id]; ok {
-			panic(fmt.Sprintf("migration: duplicate entry: %s", e.id))
-		}
-		m.revEntries[e.id] = i
+// queryPendingCount count the pending migrations with single query, see PendingCount.
+func (m *Migration) queryPendingCount(ctx context.Context, conn *pgx.Conn) (int, error) {
+	if exists, err := m.opts.metaExists(ctx, conn); err != nil || !exists {
+		return len(m.entries), err
 	}
 
-	return m
+	// squashed migration is executed when itself or any of the migrations it replaces is executed,
+	// repeatable migration is only executed with its current hash, or its legacy hash
+	var ids, aliases, hashes, legacyHashes []string
+	for _, e := range m.entries {
+		h, legacy := "", ""
+		if isRepeatable(e.id) {
+			h, legacy = e.hash, e.legacyHash
+		}
+		ids, aliases = append(ids, e.id), append(aliases, e.id)
+		hashes, legacyHashes = append(hashes, h), append(legacyHashes, legacy)
+		for _, r := range e.replaces {
+			ids, aliases = append(ids, e.id), append(aliases, r.id)
+			hashes, legacyHashes = append(hashes, ""), append(legacyHashes, "")
+		}
+	}
+	// dirty migration is not finished yet
+	hasDirty, err := m.opts.metaHasColumn(ctx, conn, "dirty")
+	if err != nil {
+		return 0, err
+	}
+	notDirty := ""
+	if hasDirty {
+		notDirty = `and not meta.dirty `
+	}
+	var count int
+	err = conn.QueryRow(ctx, ``+
+		`select count(*) from (`+
+		`select s.id from unnest($1::text[], $2::text[], $3::text[], $4::text[]) as s(id, alias, hash, legacy_hash) `+
+		`left join `+m.opts.metaIdent()+` as meta on meta.id = s.alias `+
+		`and (s.hash = '' or meta.hash = s.hash or meta.hash = s.legacy_hash) `+notDirty+
+		`group by s.id having count(meta.id) = 0`+
+		`) as pending`,
+		ids, aliases, hashes, legacyHashes,
+	).Scan(&count)
+	return count, err
 }
 
-// Check the current state of the database.
-//
-// will return list of migration that need to be executed.
+// Counts return the number of migrations in the source that are executed in the target database, and the number
+// of pending migrations, like PendingCount, without returning the lists, e.g. for metrics exporter called on a timer.
+// they always add up to the number of migrations in the source: squashed migrations are counted through their
+// baseline, and rows in the meta table that are not in the source are not counted.
 //
-// also will return *MismatchHashError error if the database already execute a migration file
-// but it has different hash with source.
-func (m *Migration) Check(target string) ([]string, error) {
-	conn, err := setupConn(target, nil)
+// it also verify the executed migrations like Verify, and return *MismatchHashError or *OrphanedMigrationError,
+// unless Options.CountsSkipVerify is set. it doesn't lock the meta table and never modify the database,
+// so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) Counts(target string) (applied int, pending int, err error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
 	defer conn.Close(bgCtx)
-	return m.check(conn)
+
+	if exists, err := m.opts.metaExists(bgCtx, conn); err != nil || !exists {
+		return 0, len(m.entries), err
+	}
+
+	if !m.opts.CountsSkipVerify {
+		inDB, err := m.opts.queryMeta(bgCtx, conn)
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := m.verify(inDB); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if pending, err = m.queryPendingCount(bgCtx, conn); err != nil {
+		return 0, 0, err
+	}
+	return len(m.entries) - pending, pending, nil
 }
 
-func (m *Migration) check(conn *pgx.Conn) ([]string, error) {
-	rows, err := conn.Query(bgCtx, ``+
-		`select id, hash from go_migration.meta`,
-	)
+func (m *Migration) check(ctx context.Context, conn *pgx.Conn) ([]string, error) {
+	if err := m.opts.checkDirty(ctx, conn); err != nil {
+		return nil, err
+	}
+	if _, err := m.checkAppID(ctx, conn); err != nil {
+		return nil, err
+	}
+	inDB, err := m.opts.queryMeta(ctx, conn)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return m.pending(inDB)
+}
 
+// pending return list of migration that not in inDB yet, or repeatable migration with different hash in inDB.
+//
+// executed migration that is not in the source is reported as *OrphanedMigrationError, all of them at once,
+// after the hash of the others is checked, unless accepted by Options.OnOrphan.
+func (m *Migration) pending(inDB []Item) ([]string, error) {
 	alreadyInDB := make(map[string]struct{})
-	for rows.Next() {
-		var id, hash string
-		if err := rows.Scan(&id, &hash); err != nil {
-			return nil, err
-		}
-		i, ok := m.revEntries[id]
+	squashedInDB := make(map[int]map[string]struct{})
+	var orphans []Item
+	for _, it := range inDB {
+		i, ok := m.revEntries[it.ID]
 		if !ok {
+			if b, ok := m.replacedBy[it.ID]; ok {
+				if err := m.entries[b].checkReplaced(it); err != nil {
+					return nil, err
+				}
+				if squashedInDB[b] == nil {
+					squashedInDB[b] = make(map[string]struct{})
+				}
+				squashedInDB[b][it.ID] = struct{}{}
+				continue
+			}
+			orphans = append(orphans, it)
 			continue
 		}
 		e := m.entries[i]
-		if e.hash != hash {
-			return nil, &MismatchHashError{Item: Item{ID: id, Hash: e.hash}, HashInDB: hash}
+		if !e.hashMatches(it.Hash) {
+			if isRepeatable(e.id) {
+				continue // re-executed
+			}
+			err := &MismatchHashError{Item: Item{ID: it.ID, Hash: e.hash}, HashInDB: it.Hash}
+			if m.opts.OnDrift == nil {
+				return nil, err
+			}
+			if err := m.opts.OnDrift(err); err != nil {
+				return nil, err
+			}
 		}
-		alreadyInDB[id] = struct{}{}
+		alreadyInDB[it.ID] = struct{}{}
 	}
-	if err := rows.Err(); err != nil {
+	if err := m.opts.acceptOrphans(orphans); err != nil {
 		return nil, err
 	}
+	for b, ids := range squashedInDB {
+		e := m.entries[b]
+		if _, ok := alreadyInDB[e.id]; ok {
+			continue
+		}
+		if err := e.checkSquashedComplete(ids); err != nil {
+			return nil, err
+		}
+		alreadyInDB[e.id] = struct{}{}
+	}
 
 	var ret []string
 	for _, e := range m.entries {
@@ -139,62 +366,266 @@ func (m *Migration) check(conn *pgx.Conn) ([]string, error) {
 		}
 		ret = append(ret, e.id)
 	}
+	if err := m.checkPrerequisites(alreadyInDB, ret); err != nil {
+		return nil, err
+	}
+	m.metrics.setPending(len(ret))
 
 	return ret, nil
 }
 
+// checkPrerequisites check the after directives of the pending migrations in list,
+// each prerequisite must be in alreadyInDB or before it in list.
+func (m *Migration) checkPrerequisites(alreadyInDB map[string]struct{}, list []string) error {
+	satisfied := make(map[string]struct{}, len(alreadyInDB)+len(list))
+	for id := range alreadyInDB {
+		satisfied[id] = struct{}{}
+	}
+	for _, id := range list {
+		e := m.entries[m.revEntries[id]]
+		for _, required := range e.after {
+			if b, ok := m.replacedBy[required]; ok {
+				required = m.entries[b].id
+			}
+			if _, ok := satisfied[required]; !ok {
+				return &MissingPrerequisiteError{ID: id, RequiredID: required}
+			}
+		}
+		satisfied[id] = struct{}{}
+	}
+	return nil
+}
+
+// notPending return the id of the entries that is not in list, list is the result of pending,
+// so they are already in the database.
+func (m *Migration) notPending(list []string) map[string]struct{} {
+	ret := make(map[string]struct{})
+	for _, e := range m.entries {
+		if !contains(list, e.id) {
+			ret[e.id] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// checkPendingLimit return *TooManyPendingError if list is longer than Options.MaxPendingForRun.
+func (m *Migration) checkPendingLimit(list []string) error {
+	if limit := m.opts.MaxPendingForRun; limit > 0 && len(list) > limit {
+		return &TooManyPendingError{Count: len(list), Limit: limit}
+	}
+	return nil
+}
+
+// drifted return the entries that has different hash in inDB, except repeatable migration, which is re-executed instead.
+func (m *Migration) drifted(inDB []Item) []entry {
+	var ret []entry
+	for _, it := range inDB {
+		if i, ok := m.revEntries[it.ID]; ok && !isRepeatable(it.ID) && !m.entries[i].hashMatches(it.Hash) {
+			ret = append(ret, m.entries[i])
+		}
+	}
+	return ret
+}
+
 // Run the migration.
 //
 // will return list of migration that executed.
 //
 // also will return *MismatchHashError error if the database already execute a migration file
-// but it has different hash with source.
+// but it has different hash with source, unless accepted by Options.OnDrift, or *OrphanedMigrationError
+// like Check, unless accepted by Options.OnOrphan. older version ignored the orphans silently,
+// set Options.OnOrphan to return nil to keep that behavior, e.g. when old migration files are pruned.
+//
+// on error, nothing is executed, except the migrations committed before no-transaction migration,
+// which are returned together with the error.
 func (m *Migration) Run(target string) ([]string, error) {
-	nestedTxDetected := false
-	conn, err := setupConn(target, func() { nestedTxDetected = true })
+	return m.RunContext(bgCtx, target)
+}
+
+// RunContext is like Run, but ctx can be used to cancel it or set its deadline,
+// e.g. to fit in the hard timeout of the deployment.
+//
+// when ctx is done in the middle of the migrations, the transaction is rolled back,
+// and none of them is persisted.
+func (m *Migration) RunContext(ctx context.Context, target string) ([]string, error) {
+	return m.opts.retry(ctx, runAttempt(
+		func() (*runner, error) { return m.begin(ctx, target) },
+		func(r *runner) ([]string, error) {
+			return m.run(r, nil, func(remaining []string) error { return m.postCommitVerify(ctx, target, remaining) })
+		},
+	))
+}
+
+// RunTo is like Run, but stop after executing migration upTo, the later ones are left pending.
+//
+// it is no-op if upTo is already executed, and return *UnknownMigrationError if upTo is not found in the source.
+func (m *Migration) RunTo(target string, upTo string) ([]string, error) {
+	if _, ok := m.revEntries[upTo]; !ok {
+		return nil, &UnknownMigrationError{ID: upTo}
+	}
+	return m.opts.retry(bgCtx, runAttempt(
+		func() (*runner, error) { return m.begin(bgCtx, target) },
+		func(r *runner) ([]string, error) {
+			pick := func(list []string) ([]string, []string, error) {
+				before, after := splitAfter(list, upTo)
+				return before, after, nil
+			}
+			return m.run(r, pick, func(remaining []string) error { return m.postCommitVerify(bgCtx, target, remaining) })
+		},
+	))
+}
+
+// picker select which pending migrations in list are executed, the rest are left pending.
+type picker func(list []string) (selected, remaining []string, err error)
+
+// run the pending migrations with r, or only the ones selected by pick if not nil.
+// verify is called after commit with Options.PostCommitVerify, with the migrations that should be still pending.
+func (m *Migration) run(r *runner, pick picker, verify func(remaining []string) error) ([]string, error) {
+	defer r.close()
+
+	list, err := r.check()
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close(bgCtx)
-
-	if _, err := conn.Exec(bgCtx, ``+
-		`begin isolation level serializable;`+
-		`lock table go_migration.meta in access exclusive mode`,
-	); err != nil {
+	var remaining []string
+	if pick != nil {
+		if list, remaining, err = pick(list); err != nil {
+			return nil, err
+		}
+	}
+	var paused []string
+	for _, id := range list {
+		if m.entries[m.revEntries[id]].pause {
+			list, paused = splitAfter(list, id)
+			remaining = append(append([]string(nil), paused...), remaining...)
+			break
+		}
+	}
+	if err := m.checkPendingLimit(list); err != nil {
 		return nil, err
 	}
-	committed := false
-	defer func() {
-		if !committed {
-			conn.Exec(bgCtx, `rollback`)
+	if err := r.checkPartialNoTx(list); err != nil {
+		return nil, err
+	}
+	execAll := r.execEach
+	if m.opts.SingleBatch && r.ownConn && m.canBatch(list) {
+		execAll = r.execBatch
+	}
+	if err := execAll(list); err != nil {
+		return r.durable, err
+	}
+	finalize := len(list) > 0 && m.opts.Finalizer != ""
+	if finalize && !m.opts.FinalizerAfterCommit {
+		if err := r.finalize(); err != nil {
+			return r.durable, err
+		}
+	}
+	if m.opts.CaptureSchemaHash {
+		if err := r.captureSchemaHash(len(list) > 0); err != nil {
+			return r.durable, err
 		}
-	}()
+	}
+	if err := r.recordRun(list); err != nil {
+		return r.durable, err
+	}
+	for _, e := range m.entries {
+		if len(e.replaces) > 0 && !contains(remaining, e.id) {
+			if err := r.recordSquash(e); err != nil {
+				return r.durable, err
+			}
+		}
+	}
 
-	list, err := m.check(conn)
-	if err != nil {
-		return nil, err
+	if err := r.commit(); err != nil {
+		return r.durable, err
 	}
-	for _, l := range list {
-		e := m.entries[m.revEntries[l]]
-		nestedTxDetected = false
-		if _, err := conn.Exec(bgCtx, `reset all;`+e.statement); err != nil {
-			return nil, fmt.Errorf("cannot execute \"%s\": %w", e.id, err)
-		}
-		if nestedTxDetected {
-			return nil, fmt.Errorf("cannot execute \"%s\": migration statement is already in transaction", e.id)
-		}
-		if _, err := conn.Exec(bgCtx, ``+
-			`insert into go_migration.meta(id, hash) values ($1, $2)`,
-			e.id, e.hash,
-		); err != nil {
-			return nil, err
+	m.metrics.addApplied(len(list))
+	m.metrics.setPending(len(remaining))
+
+	if finalize && m.opts.FinalizerAfterCommit {
+		if err := r.finalize(); err != nil {
+			return list, err
 		}
 	}
 
-	if _, err := conn.Exec(bgCtx, `commit`); err != nil {
-		return nil, err
+	if m.opts.PostCommitVerify {
+		if err := verify(remaining); err != nil {
+			return list, err
+		}
+	}
+
+	if len(paused) > 0 {
+		return list, &PausedError{NextID: paused[0]}
 	}
-	committed = true
 
 	return list, nil
 }
+
+// postCommitVerify Check target on fresh connection, see Options.PostCommitVerify.
+func (m *Migration) postCommitVerify(ctx context.Context, target string, remaining []string) error {
+	conn, err := m.opts.connectReadOnly(ctx, target)
+	if err != nil {
+		return &PostCommitVerifyError{Err: err}
+	}
+	defer conn.Close(ctx)
+	return m.verifyConn(ctx, conn, remaining)
+}
+
+// verifyConn Check with conn that only remaining is pending, see Options.PostCommitVerify.
+func (m *Migration) verifyConn(ctx context.Context, conn *pgx.Conn, remaining []string) error {
+	list, err := m.check(ctx, conn)
+	if err != nil || !equalStrings(list, remaining) {
+		return &PostCommitVerifyError{Pending: list, Err: err}
+	}
+	return nil
+}
+
+// RunSpecific is like Run, but only execute the pending migrations in ids, in the source order,
+// the other pending migrations are left pending, even the earlier ones.
+//
+// it bypass the normal ordering, so it is only meant for incident response, the skipped migrations are executed
+// by the next Run after the specified ones. ids that are already executed are ignored, and it return
+// *UnknownMigrationError if some of ids is not found in the source. the after directives are still enforced,
+// it return *MissingPrerequisiteError if the prerequisite is neither executed nor in ids.
+func (m *Migration) RunSpecific(target string, ids []string) ([]string, error) {
+	for _, id := range ids {
+		if _, ok := m.revEntries[id]; !ok {
+			return nil, &UnknownMigrationError{ID: id}
+		}
+	}
+	return m.opts.retry(bgCtx, runAttempt(
+		func() (*runner, error) { return m.begin(bgCtx, target) },
+		func(r *runner) ([]string, error) {
+			pick := func(list []string) ([]string, []string, error) {
+				selected, rest := splitSelected(list, ids)
+				if err := m.checkPrerequisites(m.notPending(list), selected); err != nil {
+					return nil, nil, err
+				}
+				return selected, rest, nil
+			}
+			return m.run(r, pick, func(remaining []string) error { return m.postCommitVerify(bgCtx, target, remaining) })
+		},
+	))
+}
+
+// splitSelected split list into the ones in ids and the rest, both keep the order of list.
+func splitSelected(list []string, ids []string) (selected, rest []string) {
+	for _, l := range list {
+		if contains(ids, l) {
+			selected = append(selected, l)
+		} else {
+			rest = append(rest, l)
+		}
+	}
+	return selected, rest
+}
+
+// splitAfter split list after id, if id is not in list, all of them are after it.
+func splitAfter(list []string, id string) (before, after []string) {
+	for i, l := range list {
+		if l == id {
+			return list[:i+1], list[i+1:]
+		}
+	}
+	return nil, list
+}
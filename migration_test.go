@@ -0,0 +1,663 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// testSource build migration source from pairs of file name and content.
+func testSource(nameAndContent ...string) fs.FS {
+	source := fstest.MapFS{"migrations": &fstest.MapFile{Mode: fs.ModeDir}}
+	for i := 0; i < len(nameAndContent); i += 2 {
+		source["migrations/"+nameAndContent[i]] = &fstest.MapFile{Data: []byte(nameAndContent[i+1])}
+	}
+	return source
+}
+
+// testTarget return connection string to a disposable database for integration tests,
+// they are skipped unless PSQL_MIGRATION_TEST_TARGET is set.
+//
+// the database is cleaned before returned, test migrations should create their objects in "test" schema.
+func testTarget(t testing.TB) string {
+	target := os.Getenv("PSQL_MIGRATION_TEST_TARGET")
+	if target == "" {
+		t.Skip("PSQL_MIGRATION_TEST_TARGET is not set")
+	}
+
+	conn, err := pgx.Connect(bgCtx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, ``+
+		`drop schema if exists go_migration cascade;`+
+		`drop schema if exists test cascade;`+
+		`create schema test`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	return target
+}
+
+// withRuntimeParam add runtime parameter to target connection string.
+func withRuntimeParam(t testing.TB, target, key, value string) string {
+	if !strings.Contains(target, "://") {
+		return target + " " + key + "=" + value
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestPending(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+
+	list, err := m.pending([]Item{{ID: "0001_a.sql", Hash: hash("create table test.a()")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"0002_b.sql", "0003_c.sql"}) {
+		t.Fatalf("invalid pending list: %v", list)
+	}
+
+	_, err = m.pending([]Item{{ID: "0002_b.sql", Hash: "xxx"}})
+	var mismatch *MismatchHashError
+	if !errors.As(err, &mismatch) || mismatch.ID != "0002_b.sql" || mismatch.HashInDB != "xxx" {
+		t.Fatalf("should return MismatchHashError, got %v", err)
+	}
+
+	_, err = m.pending([]Item{
+		{ID: "0000_x.sql", Hash: "x"},
+		{ID: "0001_a.sql", Hash: hash("create table test.a()")},
+		{ID: "0001_y.sql", Hash: "y"},
+	})
+	var orphan *OrphanedMigrationError
+	if !errors.As(err, &orphan) || !reflect.DeepEqual(orphan.Orphans, []Item{{ID: "0000_x.sql", Hash: "x"}, {ID: "0001_y.sql", Hash: "y"}}) {
+		t.Fatalf("should return OrphanedMigrationError with every orphan, got %v", err)
+	}
+
+	m.opts.OnOrphan = func(err *OrphanedMigrationError) error { return nil }
+	list, err = m.pending([]Item{{ID: "0000_x.sql", Hash: "x"}, {ID: "0001_a.sql", Hash: hash("create table test.a()")}})
+	if err != nil || !reflect.DeepEqual(list, []string{"0002_b.sql", "0003_c.sql"}) {
+		t.Fatalf("orphans accepted by OnOrphan should be ignored, got %v, %v", list, err)
+	}
+}
+
+func TestPendingRepeatable(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"r__v.sql", "create or replace view test.v as select 2",
+	))
+
+	list, err := m.pending([]Item{
+		{ID: "0001_a.sql", Hash: hash("create table test.a()")},
+		{ID: "r__v.sql", Hash: hash("create or replace view test.v as select 1")},
+	})
+	if err != nil || !reflect.DeepEqual(list, []string{"r__v.sql"}) {
+		t.Fatalf("changed repeatable migration should be pending, got %v, %v", list, err)
+	}
+	if d := m.drifted([]Item{{ID: "r__v.sql", Hash: "xxx"}}); len(d) != 0 {
+		t.Fatalf("changed repeatable migration should not be drifted, got %v", d)
+	}
+
+	list, err = m.pending([]Item{
+		{ID: "0001_a.sql", Hash: hash("create table test.a()")},
+		{ID: "r__v.sql", Hash: hash("create or replace view test.v as select 2")},
+	})
+	if err != nil || len(list) != 0 {
+		t.Fatalf("unchanged repeatable migration should not be pending, got %v, %v", list, err)
+	}
+}
+
+func TestPendingPrerequisite(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "-- psql-migration:after 0001_a.sql\ncreate table test.b()",
+		"0003_c.sql", "-- psql-migration:after 0001_a.sql\n-- psql-migration:after r__v.sql\nselect 1",
+		"r__v.sql", "create or replace view test.v as select 1",
+	))
+
+	list, err := m.pending([]Item{{ID: "0001_a.sql", Hash: hash("create table test.a()")}})
+	if err == nil {
+		t.Fatalf("prerequisite executed after the migration should not satisfy it, got %v", list)
+	}
+	var missing *MissingPrerequisiteError
+	if !errors.As(err, &missing) || missing.ID != "0003_c.sql" || missing.RequiredID != "r__v.sql" {
+		t.Fatalf("should return MissingPrerequisiteError, got %v", err)
+	}
+
+	list, err = m.pending([]Item{{ID: "r__v.sql", Hash: hash("create or replace view test.v as select 1")}})
+	if err != nil {
+		t.Fatalf("prerequisite executed before or pending earlier should satisfy it, got %v", err)
+	}
+	if !reflect.DeepEqual(list, []string{"0001_a.sql", "0002_b.sql", "0003_c.sql"}) {
+		t.Fatalf("invalid pending list: %v", list)
+	}
+
+	if _, err := NewE(testSource(
+		"0001_a.sql", "-- psql-migration:after\nselect 1",
+	)); err == nil {
+		t.Fatalf("after directive without id should be rejected")
+	}
+}
+
+func TestPendingOnDrift(t *testing.T) {
+	var drifted []string
+	rejected := errors.New("rejected")
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	), func(o *Options) {
+		o.OnDrift = func(err *MismatchHashError) error {
+			drifted = append(drifted, err.ID)
+			if err.HashInDB == "reject" {
+				return rejected
+			}
+			return nil
+		}
+	})
+
+	list, err := m.pending([]Item{{ID: "0001_a.sql", Hash: "accept"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"0002_b.sql"}) || !reflect.DeepEqual(drifted, []string{"0001_a.sql"}) {
+		t.Fatalf("accepted drift should be treated as executed, got %v, %v", list, drifted)
+	}
+
+	if _, err := m.pending([]Item{{ID: "0001_a.sql", Hash: "reject"}}); err != rejected {
+		t.Fatalf("should return the error from OnDrift, got %v", err)
+	}
+}
+
+func TestRunOnDriftRepair(t *testing.T) {
+	target := testTarget(t)
+	if _, err := New(testSource(
+		"0001_a.sql", "create table test.a()",
+	)).Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(id int)",
+		"0002_b.sql", "create table test.b()",
+	), func(o *Options) {
+		o.OnDrift = func(err *MismatchHashError) error { return nil }
+	})
+	list, err := m.Run(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"0002_b.sql"}) {
+		t.Fatalf("invalid executed list: %v", list)
+	}
+
+	// the hash is repaired, so it is up to date even without OnDrift
+	if err := New(testSource(
+		"0001_a.sql", "create table test.a(id int)",
+		"0002_b.sql", "create table test.b()",
+	)).AssertUpToDate(target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckPendingLimit(t *testing.T) {
+	m := New(testSource(), func(o *Options) { o.MaxPendingForRun = 2 })
+
+	if err := m.checkPendingLimit([]string{"0001_a.sql", "0002_b.sql"}); err != nil {
+		t.Fatalf("pending count under the limit should be allowed, got %v", err)
+	}
+
+	var tooMany *TooManyPendingError
+	err := m.checkPendingLimit([]string{"0001_a.sql", "0002_b.sql", "0003_c.sql"})
+	if !errors.As(err, &tooMany) || tooMany.Count != 3 || tooMany.Limit != 2 {
+		t.Fatalf("should return TooManyPendingError, got %v", err)
+	}
+
+	if err := New(testSource()).checkPendingLimit(make([]string, 1000)); err != nil {
+		t.Fatalf("no limit by default, got %v", err)
+	}
+}
+
+func TestRunMaxPending(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	)
+
+	var tooMany *TooManyPendingError
+	if _, err := New(source, func(o *Options) { o.MaxPendingForRun = 2 }).Run(target); !errors.As(err, &tooMany) {
+		t.Fatalf("should return TooManyPendingError, got %v", err)
+	}
+	if list, err := New(source, func(o *Options) { o.MaxPendingForRun = 3 }).Run(target); err != nil || len(list) != 3 {
+		t.Fatalf("should execute all migrations, got %v, %v", list, err)
+	}
+}
+
+func TestRunPostCommitVerify(t *testing.T) {
+	target := testTarget(t)
+	postCommitVerify := func(o *Options) { o.PostCommitVerify = true }
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+	), postCommitVerify)
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// a trigger that silently drop the meta row
+	m = New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", ""+
+			"create function test.drop_meta() returns trigger language plpgsql as $$ begin return null; end $$;"+
+			"create trigger drop_meta before insert on go_migration.meta for each row execute function test.drop_meta();",
+		"0003_c.sql", "create table test.c()",
+	), postCommitVerify)
+	_, err := m.Run(target)
+	var verify *PostCommitVerifyError
+	if !errors.As(err, &verify) || !reflect.DeepEqual(verify.Pending, []string{"0002_b.sql", "0003_c.sql"}) {
+		t.Fatalf("should return PostCommitVerifyError, got %v", err)
+	}
+}
+
+func TestCheckReadTarget(t *testing.T) {
+	target := testTarget(t)
+	replica := withRuntimeParam(t, target, "default_transaction_read_only", "on")
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	), func(o *Options) { o.ReadTarget = replica })
+
+	list, err := m.Check(target)
+	if err != nil {
+		t.Fatalf("Check against replica without meta table should not fail: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("invalid pending list: %v", list)
+	}
+
+	if _, err := m.Run(target); err != nil {
+		t.Fatalf("Run should use the primary: %v", err)
+	}
+
+	list, err = m.Check(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("invalid pending list: %v", list)
+	}
+}
+
+func TestRunDelayBetween(t *testing.T) {
+	target := testTarget(t)
+
+	delay := 200 * time.Millisecond
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	), func(o *Options) { o.DelayBetween = delay })
+
+	start := time.Now()
+	list, err := m.Run(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("invalid executed list: %v", list)
+	}
+	if d := time.Since(start); d < 2*delay {
+		t.Fatalf("Run should pause between migrations, took only %s", d)
+	}
+}
+
+func TestNewDownMigration(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0001_a.down.sql", "drop table test.a",
+		"0002_b.sql", "create table test.b()",
+	))
+	if all := m.All(); len(all) != 2 {
+		t.Fatalf("down migration should not be listed: %v", all)
+	}
+	if e := m.entries[0]; !e.hasDown || e.down != "drop table test.a" {
+		t.Fatalf("invalid down migration: %#v", e)
+	}
+	if e := m.entries[1]; e.hasDown {
+		t.Fatalf("0002_b.sql should not have down migration")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("New should panic on down migration without its migration")
+		}
+	}()
+	New(testSource("0001_a.down.sql", "drop table test.a"))
+}
+
+func TestNewUpDownMigration(t *testing.T) {
+	m := New(testSource(
+		"0001_create_users.up.sql", "create table test.users()",
+		"0001_create_users.down.sql", "drop table test.users",
+	))
+	if e := m.entries[0]; e.id != "0001_create_users.up.sql" || !e.hasDown || e.down != "drop table test.users" {
+		t.Fatalf("invalid up/down pair: %#v", e)
+	}
+	if id := downID(m.entries[0].id); id != "0001_create_users.down.sql" {
+		t.Fatalf("invalid down id %s", id)
+	}
+
+	if _, err := NewE(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0001_a.up.sql", "create table test.a()",
+		"0001_a.down.sql", "drop table test.a",
+	)); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("down migration with both xxx.sql and xxx.up.sql should be rejected, got %v", err)
+	}
+}
+
+func TestRunSearchPath(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table foo()",
+	), func(o *Options) { o.SearchPath = "test" })
+
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	var schema string
+	if err := conn.QueryRow(bgCtx, `select table_schema from information_schema.tables where table_name = 'foo'`).Scan(&schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema != "test" {
+		t.Fatalf("foo should be created in test schema, got %s", schema)
+	}
+}
+
+func TestAssertUpToDate(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	))
+
+	err := m.AssertUpToDate(target)
+	var pending *PendingMigrationsError
+	if !errors.As(err, &pending) || !reflect.DeepEqual(pending.Pending, []string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("should return PendingMigrationsError, got %v", err)
+	}
+
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AssertUpToDate(target); err != nil {
+		t.Fatalf("should be up to date, got %v", err)
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(testSource("0001_a.sql", "select 1")).RunContext(ctx, "postgres://127.0.0.1:1/x"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("should return context.Canceled, got %v", err)
+	}
+	if _, err := New(testSource("0001_a.sql", "select 1")).CheckContext(ctx, "postgres://127.0.0.1:1/x"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("should return context.Canceled, got %v", err)
+	}
+}
+
+func TestRunContextTimeout(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "select pg_sleep(10)",
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := New(source).RunContext(ctx, withRuntimeParam(t, target, "application_name", "canceled")); err == nil {
+		t.Fatalf("should fail when the context is done")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("should return shortly after the context is done, took %s", d)
+	}
+
+	if list, err := New(source).Check(target); err != nil || len(list) != 2 {
+		t.Fatalf("the transaction should be rolled back, got %v, %v", list, err)
+	}
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	for i := 0; ; i++ {
+		var count int
+		if err := conn.QueryRow(bgCtx, ``+
+			`select count(*) from pg_stat_activity where application_name = 'canceled' and xact_start is not null`,
+		).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count == 0 {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("the transaction should not be left open")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestSplitAfter(t *testing.T) {
+	list := []string{"a", "b", "c"}
+	if before, after := splitAfter(list, "b"); !reflect.DeepEqual(before, []string{"a", "b"}) || !reflect.DeepEqual(after, []string{"c"}) {
+		t.Fatalf("invalid split %v %v", before, after)
+	}
+	if before, after := splitAfter(list, "x"); before != nil || !reflect.DeepEqual(after, list) {
+		t.Fatalf("missing id should leave everything after, got %v %v", before, after)
+	}
+}
+
+func TestSplitSelected(t *testing.T) {
+	selected, rest := splitSelected([]string{"a", "b", "c", "d"}, []string{"d", "b", "x"})
+	if !reflect.DeepEqual(selected, []string{"b", "d"}) || !reflect.DeepEqual(rest, []string{"a", "c"}) {
+		t.Fatalf("invalid split %v %v", selected, rest)
+	}
+}
+
+func TestRunTo(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	), func(o *Options) { o.PostCommitVerify = true })
+
+	var unknown *UnknownMigrationError
+	if _, err := m.RunTo(target, "0004_d.sql"); !errors.As(err, &unknown) || unknown.ID != "0004_d.sql" {
+		t.Fatalf("should return UnknownMigrationError, got %v", err)
+	}
+
+	list, err := m.RunTo(target, "0002_b.sql")
+	if err != nil || !reflect.DeepEqual(list, []string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("should execute up to 0002_b.sql, got %v, %v", list, err)
+	}
+	if pending, err := m.Check(target); err != nil || !reflect.DeepEqual(pending, []string{"0003_c.sql"}) {
+		t.Fatalf("later migrations should be left pending, got %v, %v", pending, err)
+	}
+
+	if list, err := m.RunTo(target, "0001_a.sql"); err != nil || len(list) != 0 {
+		t.Fatalf("already executed upTo should be no-op, got %v, %v", list, err)
+	}
+	if list, err := m.RunTo(target, "0003_c.sql"); err != nil || !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+		t.Fatalf("should execute the rest, got %v, %v", list, err)
+	}
+}
+
+func TestRunSpecific(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	), func(o *Options) { o.PostCommitVerify = true })
+
+	var unknown *UnknownMigrationError
+	if _, err := m.RunSpecific(target, []string{"0002_b.sql", "0004_d.sql"}); !errors.As(err, &unknown) || unknown.ID != "0004_d.sql" {
+		t.Fatalf("should return UnknownMigrationError, got %v", err)
+	}
+
+	list, err := m.RunSpecific(target, []string{"0003_c.sql", "0002_b.sql"})
+	if err != nil || !reflect.DeepEqual(list, []string{"0002_b.sql", "0003_c.sql"}) {
+		t.Fatalf("should execute the specified migrations in source order, got %v, %v", list, err)
+	}
+	if pending, err := m.Check(target); err != nil || !reflect.DeepEqual(pending, []string{"0001_a.sql"}) {
+		t.Fatalf("other migrations should be left pending, got %v, %v", pending, err)
+	}
+	if list, err := m.RunSpecific(target, []string{"0002_b.sql"}); err != nil || len(list) != 0 {
+		t.Fatalf("already executed migration should be ignored, got %v, %v", list, err)
+	}
+}
+
+func TestRunSpecificPrerequisite(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "-- psql-migration:after 0001_a.sql\ncreate table test.b()",
+	))
+
+	var missing *MissingPrerequisiteError
+	if _, err := m.RunSpecific(target, []string{"0002_b.sql"}); !errors.As(err, &missing) ||
+		missing.ID != "0002_b.sql" || missing.RequiredID != "0001_a.sql" {
+		t.Fatalf("should return MissingPrerequisiteError, got %v", err)
+	}
+	if list, err := m.RunSpecific(target, []string{"0001_a.sql", "0002_b.sql"}); err != nil || len(list) != 2 {
+		t.Fatalf("prerequisite selected together should satisfy it, got %v, %v", list, err)
+	}
+}
+
+func TestPendingCount(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	)
+
+	if count, err := New(source).PendingCount(target); err != nil || count != 3 {
+		t.Fatalf("empty database should have every migration pending, got %d, %v", count, err)
+	}
+
+	if _, err := New(source).RunTo(target, "0001_a.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := New(source).PendingCount(target); err != nil || count != 2 {
+		t.Fatalf("partially applied database should have 2 pending, got %d, %v", count, err)
+	}
+
+	if _, err := New(source).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := New(source).PendingCount(target); err != nil || count != 0 {
+		t.Fatalf("fully applied database should have nothing pending, got %d, %v", count, err)
+	}
+
+	squashed, err := New(source).Squash("0002_b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := squashed.PendingCount(target); err != nil || count != 0 {
+		t.Fatalf("squashed migration should be counted as executed, got %d, %v", count, err)
+	}
+
+	repeatable := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+		"r__v.sql", "create or replace view test.v as select 1",
+	)
+	if _, err := New(repeatable).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	changed := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+		"r__v.sql", "create or replace view test.v as select 2",
+	)
+	if count, err := New(changed).PendingCount(target); err != nil || count != 1 {
+		t.Fatalf("changed repeatable migration should be pending, got %d, %v", count, err)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	)
+
+	if applied, pending, err := New(source).Counts(target); err != nil || applied != 0 || pending != 3 {
+		t.Fatalf("empty database should have every migration pending, got %d, %d, %v", applied, pending, err)
+	}
+	if _, err := New(source).RunTo(target, "0002_b.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if applied, pending, err := New(source).Counts(target); err != nil || applied != 2 || pending != 1 {
+		t.Fatalf("invalid counts %d, %d, %v", applied, pending, err)
+	}
+
+	changed := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b(id int)",
+		"0003_c.sql", "create table test.c()",
+	)
+	var mismatch *MismatchHashError
+	if _, _, err := New(changed).Counts(target); !errors.As(err, &mismatch) || mismatch.ID != "0002_b.sql" {
+		t.Fatalf("should return MismatchHashError, got %v", err)
+	}
+	skip := func(o *Options) { o.CountsSkipVerify = true }
+	if applied, pending, err := New(changed, skip).Counts(target); err != nil || applied != 2 || pending != 1 {
+		t.Fatalf("CountsSkipVerify should only count, got %d, %d, %v", applied, pending, err)
+	}
+
+	squashed, err := New(source).Squash("0002_b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied, pending, err := squashed.Counts(target); err != nil || applied != 1 || pending != 1 {
+		t.Fatalf("squashed migrations should be counted through the baseline, got %d, %d, %v", applied, pending, err)
+	}
+}
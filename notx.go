@@ -0,0 +1,83 @@
+package migration
+
+import "strings"
+
+// checkPartialNoTx return *PartialNoTxMigrationError if a pending migration create index concurrently
+// but that index already exists as invalid index, left by previous failed attempt.
+//
+// unqualified index name is resolved against the current search_path, not Options.SearchPath.
+func (r *runner) checkPartialNoTx(list []string) error {
+	for _, id := range list {
+		e := r.m.entries[r.m.revEntries[id]]
+		for _, o := range createdObjects(e.statement) {
+			if o.kind != "index" || !o.concurrently {
+				continue
+			}
+			quoted := make([]string, len(o.name))
+			for i, n := range o.name {
+				quoted[i] = quoteIdent(n)
+			}
+			name := strings.Join(quoted, ".")
+
+			var invalid bool
+			if err := r.conn.QueryRow(r.ctx, ``+
+				`select exists (select 1 from pg_index where indexrelid = to_regclass($1) and not indisvalid)`,
+				name,
+			).Scan(&invalid); err != nil {
+				return err
+			}
+			if invalid {
+				return &PartialNoTxMigrationError{ID: e.id, Index: name}
+			}
+		}
+	}
+	return nil
+}
+
+// execNoTx exec and record migration e with no-transaction directive.
+//
+// e is recorded as dirty and committed together with the migrations before it, before the meta table is unlocked,
+// so concurrent Run see it as dirty instead of pending. e is executed outside transaction, the dirty flag is cleared
+// when it succeed, then the transaction is reopened and the meta table is locked again for the rest.
+// before is the migrations executed before e in the same Run, they are durable once committed.
+func (r *runner) execNoTx(e entry, before []string) error {
+	if err := r.markDirty(e); err != nil {
+		return err
+	}
+	if err := r.commit(); err != nil {
+		return err
+	}
+	r.inTx = false
+	r.durable = append([]string(nil), before...)
+
+	d, err := r.exec(e)
+	if err != nil {
+		return err
+	}
+	r.m.metrics.observeDuration(d)
+	if _, err := r.conn.Exec(r.ctx, `reset all`); err != nil {
+		return err
+	}
+	if err := r.clearDirty(e, d); err != nil {
+		return err
+	}
+	r.durable = append(r.durable, e.id)
+
+	return r.reopen()
+}
+
+// reopen start new transaction after commit, and lock the meta table again,
+// unless it is serialized by Options.AdvisoryLock, which is still held.
+func (r *runner) reopen() (err error) {
+	if err := r.beginTx(); err != nil {
+		return err
+	}
+	r.committed = false
+	if !r.m.opts.AdvisoryLock {
+		if err := r.m.lockMeta(r.ctx, r.conn); err != nil {
+			return err
+		}
+	}
+	r.chain, err = r.m.opts.queryLastChainLink(r.ctx, r.conn)
+	return err
+}
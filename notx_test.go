@@ -0,0 +1,92 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunPartialNoTx(t *testing.T) {
+	target := testTarget(t)
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, `create table test.a(id int); insert into test.a values (1), (1)`); err != nil {
+		t.Fatal(err)
+	}
+	// fail because of the duplicate, leaving invalid index behind
+	if _, err := conn.Exec(bgCtx, `create unique index concurrently a_idx on test.a(id)`); err == nil {
+		t.Fatalf("create index should fail")
+	}
+
+	m := New(testSource(
+		"0001_a.sql", "create unique index concurrently a_idx on test.a(id)",
+	))
+	_, err = m.Run(target)
+	var partial *PartialNoTxMigrationError
+	if !errors.As(err, &partial) || partial.ID != "0001_a.sql" || partial.Index != `"test"."a_idx"` {
+		t.Fatalf("should return PartialNoTxMigrationError, got %v", err)
+	}
+}
+
+func TestLoadNoTx(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(id int)",
+		"0002_b.sql", "-- psql-migration:no-transaction\ncreate index concurrently a_idx on test.a(id)",
+	))
+	if m.entries[0].noTx || !m.entries[1].noTx {
+		t.Fatalf("only 0002_b.sql should be no-transaction")
+	}
+	if m.canBatch([]string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("no-transaction migration cannot be batched")
+	}
+
+	_, err := NewE(testSource(
+		"0001_a.sql", "-- psql-migration:no-transaction\ncreate index concurrently a_idx on test.a(id); select 1",
+	))
+	if err == nil || !strings.Contains(err.Error(), "exactly one statement") {
+		t.Fatalf("no-transaction migration with multiple statements should be rejected, got %v", err)
+	}
+}
+
+func TestRunNoTx(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a(id int); insert into test.a values (1), (1)",
+		"0002_b.sql", "-- psql-migration:no-transaction\ncreate index concurrently a_idx on test.a(id)",
+		"0003_c.sql", "create table test.c()",
+	)
+	if list, err := New(source).Run(target); err != nil || len(list) != 3 {
+		t.Fatalf("should execute all migrations, got %v, %v", list, err)
+	}
+	if list, err := New(source).Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("all migrations should be recorded, got %v, %v", list, err)
+	}
+
+	failing := testSource(
+		"0001_a.sql", "create table test.a(id int); insert into test.a values (1), (1)",
+		"0002_b.sql", "-- psql-migration:no-transaction\ncreate index concurrently a_idx on test.a(id)",
+		"0003_c.sql", "create table test.c()",
+		"0004_d.sql", "create table test.d()",
+		"0005_e.sql", "-- psql-migration:no-transaction\ncreate unique index concurrently a_unique_idx on test.a(id)",
+		"0006_f.sql", "create table test.f()",
+	)
+	if list, err := New(failing).Run(target); err == nil || !reflect.DeepEqual(list, []string{"0004_d.sql"}) {
+		t.Fatalf("duplicate should fail the unique index, after committing 0004_d.sql, got %v, %v", list, err)
+	}
+	var dirty *DirtyMigrationError
+	if _, err := New(failing).Check(target); !errors.As(err, &dirty) || dirty.ID != "0005_e.sql" {
+		t.Fatalf("failed no-transaction migration should be dirty, got %v", err)
+	}
+	status, err := New(failing).Status(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status[3].Applied || status[5].Applied {
+		t.Fatalf("migrations before the failed one should be committed, the later ones should not, got %v", status)
+	}
+}
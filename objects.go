@@ -0,0 +1,127 @@
+package migration
+
+import "strings"
+
+type object struct {
+	kind         string   // table, index, view, function, ...
+	name         []string // qualified name, as postgres see it
+	concurrently bool     // "create index concurrently"
+}
+
+// creatableKinds is the object kinds recognized after "create".
+var creatableKinds = map[string]bool{
+	"table": true, "index": true, "view": true, "sequence": true,
+	"function": true, "procedure": true, "type": true, "schema": true,
+	"trigger": true, "extension": true, "domain": true, "aggregate": true,
+}
+
+// createModifiers is the words that can appear between "create" and the object kind.
+var createModifiers = map[string]bool{
+	"or": true, "replace": true, "unique": true, "temp": true, "temporary": true,
+	"unlogged": true, "global": true, "local": true, "materialized": true,
+	"recursive": true, "constraint": true,
+}
+
+// createdObjects return the objects created by the sql, in order.
+func createdObjects(sql string) []object {
+	var ret []object
+	for _, stmt := range statements(scan(sql)) {
+		if o, ok := parseCreate(stmt); ok {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+func parseCreate(stmt []token) (object, bool) {
+	if len(stmt) == 0 || !stmt[0].is("create") {
+		return object{}, false
+	}
+
+	i := 1
+	for i < len(stmt) && stmt[i].kind == tokenWord && createModifiers[strings.ToLower(stmt[i].text)] {
+		i++
+	}
+	if i >= len(stmt) || stmt[i].kind != tokenWord || !creatableKinds[strings.ToLower(stmt[i].text)] {
+		return object{}, false
+	}
+	o := object{kind: strings.ToLower(stmt[i].text)}
+	i++
+
+	if o.kind == "index" && i < len(stmt) && stmt[i].is("concurrently") {
+		o.concurrently = true
+		i++
+	}
+	if i+2 < len(stmt) && stmt[i].is("if") && stmt[i+1].is("not") && stmt[i+2].is("exists") {
+		i += 3
+	}
+	if o.kind == "index" && i < len(stmt) && stmt[i].is("on") {
+		// unnamed index
+		return object{}, false
+	}
+
+	o.name, _ = parseQualifiedName(stmt[i:])
+	if len(o.name) == 0 {
+		return object{}, false
+	}
+
+	return o, true
+}
+
+// parseQualifiedName parse name like `schema.table` or `"Schema"."Table"` at the beginning of tokens,
+// return the name parts and number of consumed tokens.
+func parseQualifiedName(tokens []token) ([]string, int) {
+	var name []string
+	i := 0
+	for i < len(tokens) {
+		t := tokens[i]
+		if t.kind != tokenWord && t.kind != tokenQuotedIdent {
+			break
+		}
+		name = append(name, t.ident())
+		i++
+		if i < len(tokens) && tokens[i].kind == tokenPunct && tokens[i].text == "." {
+			i++
+			continue
+		}
+		break
+	}
+	return name, i
+}
+
+// matchName report whether qualified name matches query,
+// unqualified query matches any schema.
+func matchName(name, query []string) bool {
+	if len(query) == 0 || len(query) > len(name) {
+		return false
+	}
+	name = name[len(name)-len(query):]
+	for i := range query {
+		if name[i] != query[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WhichMigrationCreated return the id of the first migration that create objectName.
+//
+// objectName is written like in sql, e.g. `users`, `public.users`, or `"MyTable"`.
+// unqualified objectName matches object in any schema.
+//
+// this is only static analysis of the "create ..." statements, objects created
+// indirectly (e.g. inside function body or by "select into") are not detected.
+func (m *Migration) WhichMigrationCreated(objectName string) (string, bool) {
+	query, _ := parseQualifiedName(scan(objectName))
+	if len(query) == 0 {
+		return "", false
+	}
+	for _, e := range m.entries {
+		for _, o := range createdObjects(e.statement) {
+			if matchName(o.name, query) {
+				return e.id, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,55 @@
+package migration
+
+import "testing"
+
+func TestWhichMigrationCreated(t *testing.T) {
+	m := New(testSource(
+		"0001_init.sql", `
+			create table if not exists public.users(id int);
+			create unique index concurrently users_idx on users(id);
+		`,
+		"0002_more.sql", `
+			-- create table comment_only(id int);
+			insert into users values (1);
+			create or replace function f() returns int as $$ create table in_body(); $$ language sql;
+			create table "MyTable"();
+		`,
+		"0003_again.sql", `create table if not exists users(id int)`,
+	))
+
+	tc := []struct {
+		object, id string
+		found      bool
+	}{
+		{"users", "0001_init.sql", true},
+		{"public.users", "0001_init.sql", true},
+		{"USERS", "0001_init.sql", true},
+		{"other.users", "", false},
+		{"users_idx", "0001_init.sql", true},
+		{"f", "0002_more.sql", true},
+		{`"MyTable"`, "0002_more.sql", true},
+		{"mytable", "", false},
+		{"comment_only", "", false},
+		{"in_body", "", false},
+		{"unknown", "", false},
+	}
+
+	for _, c := range tc {
+		t.Run(c.object, func(t *testing.T) {
+			id, found := m.WhichMigrationCreated(c.object)
+			if id != c.id || found != c.found {
+				t.Fatalf("got (%q, %v), want (%q, %v)", id, found, c.id, c.found)
+			}
+		})
+	}
+}
+
+func TestCreatedObjectsConcurrently(t *testing.T) {
+	objs := createdObjects(`
+		create index concurrently if not exists a_idx on a(id);
+		create unique index b_idx on b(id);
+	`)
+	if len(objs) != 2 || !objs[0].concurrently || objs[1].concurrently {
+		t.Fatalf("invalid objects %#v", objs)
+	}
+}
@@ -0,0 +1,451 @@
+package migration
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Options of the Migration, see Option.
+type Options struct {
+	// BeforeEach is called by Run right before executing each migration.
+	BeforeEach func(id string)
+
+	// AfterEach is called by Run after executing each migration,
+	// d is how long the migration statement took. it is called even when the migration fail, with the error.
+	AfterEach func(id string, d time.Duration, err error)
+
+	// MetricsRegisterer, when not nil, is used to register metrics about the migration,
+	// see MetricsRegisterer.
+	MetricsRegisterer MetricsRegisterer
+
+	// ReadTarget, when not empty, is used instead of the target passed to read-only operation like Check.
+	// it can point to a read-only replica to offload the primary, Run always use the primary target.
+	ReadTarget string
+
+	// DelayBetween is how long Run pause between each migration, to let replication or autovacuum catch up.
+	//
+	// Run apply all migration in a single transaction, so the delay also extends how long
+	// the meta table lock and the locks acquired by previous migrations are held.
+	DelayBetween time.Duration
+
+	// KeepAlive, when positive, enables TCP keepalive with this period on both side of the connection,
+	// so network middleboxes don't drop the connection while a long migration is running.
+	KeepAlive time.Duration
+
+	// NoWait make Run fail immediately with *LockHeldError, that describe who hold the lock,
+	// instead of waiting when another session already lock the meta table.
+	NoWait bool
+
+	// DryRunContinueOnError make DryRun continue executing the rest of migrations after a failure,
+	// so all broken migrations are reported at once, see DryRun.
+	DryRunContinueOnError bool
+
+	// SearchPath, when not empty, is comma separated list of schema set as search_path
+	// for each migration, so unqualified objects are created in the intended schema
+	// regardless of the role defaults.
+	SearchPath string
+
+	// ProcessLockKey, when not zero, make the operations that use the locked transaction of Run, i.e. Run and
+	// its variants, ApplyPlan, EnsureApplied, Baseline, Rollback and DryRun, hold session level pg_advisory_lock
+	// with this key for its whole duration, in addition to the meta table lock, RunSQLTx hold pg_advisory_xact_lock
+	// instead. other tools using the same key are mutually excluded with them. the other operations that modify
+	// the database, like ClearDirty and UnsafeMarkAsExecuted, don't take it.
+	ProcessLockKey int64
+
+	// StrictSemicolon make trailing semicolons significant for the migration hash,
+	// by default "a;" and "a" have the same hash.
+	//
+	// it changes the hash of every migration that ends with semicolon, so enabling it against
+	// existing database will make Check and Run fail with *MismatchHashError for those migrations.
+	StrictSemicolon bool
+
+	// StoreNormalized make Run also store the normalized text of each executed migration in the meta table,
+	// not just its hash, so DriftDiff can show what changed.
+	StoreNormalized bool
+
+	// OnDrift, when not nil, is called when a migration already executed in the database
+	// has different hash with the source, instead of failing with err.
+	//
+	// if it return nil, the drift is accepted: Check and Run continue as if the hash is the same,
+	// and Run also repair the hash in the meta table. otherwise the returned error is returned as is.
+	OnDrift func(err *MismatchHashError) error
+
+	// OnOrphan, when not nil, is called when migrations already executed in the database are not found
+	// in the source, e.g. old migration files are pruned, instead of failing with err.
+	//
+	// if it return nil, the orphans are accepted: Check and Run continue ignoring them, they stay in the meta table.
+	// otherwise the returned error is returned as is.
+	OnOrphan func(err *OrphanedMigrationError) error
+
+	// OneStatementPerFile make New reject migration file that has more than one top-level statement,
+	// with *MultipleStatementsError.
+	OneStatementPerFile bool
+
+	// AutoCreateMeta make Run create the meta table if not exists, it is true by default.
+	//
+	// set it to false when the migration role doesn't have privilege to create schema,
+	// the meta table must be created beforehand by Bootstrap.
+	AutoCreateMeta bool
+
+	// CountsSkipVerify make Counts only count, without verifying the hashes of the executed migrations.
+	CountsSkipVerify bool
+
+	// RunInSchemasContinueOnError make RunInSchemas continue to the next schema when one of them fail,
+	// instead of stopping at the first failure.
+	RunInSchemasContinueOnError bool
+
+	// MaxPendingForRun, when positive, make Run refuse to execute more than this many pending migrations
+	// at once with *TooManyPendingError, as guard against unexpected source. set it to 0 to override.
+	MaxPendingForRun int
+
+	// OnResult, when not nil, is called by Run with the rows returned by the last statement of each migration,
+	// like "update ... returning id", it is not called when the statement doesn't return rows (e.g. DDL).
+	// rows is closed after OnResult return.
+	//
+	// the last statement is executed separately via extended protocol, so it cannot be "copy from stdin".
+	// RunSQLTx doesn't support it.
+	OnResult func(id string, rows pgx.Rows)
+
+	// SplitStatements make Run execute each top-level statement of the migration with its own Exec, instead of
+	// the whole file at once, for statement that cannot be part of multi-statement query. the file is split on
+	// semicolons outside string literals, dollar-quoted strings, quoted identifiers, and comments, and the index
+	// of the failed statement is reported in *ExecError. RunSQLTx doesn't support it.
+	SplitStatements bool
+
+	// Precheck, when not nil, is called by Run after connecting, before taking any lock or starting the transaction,
+	// to assert preconditions like disk space or replication lag. if it return error, Run is aborted
+	// with *PrecheckFailedError without touching any migration.
+	Precheck func(conn *pgx.Conn) error
+
+	// LockTable make Run lock a dedicated lock table next to the meta table, instead of the meta table itself,
+	// so Check and other readers of the meta table are not blocked while Run is in progress.
+	//
+	// Run with and without LockTable don't exclude each other, so every deployer of the same database
+	// must use the same setting.
+	LockTable bool
+
+	// AdvisoryLock make Run serialize with session level pg_advisory_lock, keyed by hash of the meta table name,
+	// instead of locking the meta table, so it doesn't contend with Check and other readers at all.
+	// the lock is held until Run end, including while migration with no-transaction directive is executed.
+	//
+	// like Options.LockTable, Run with and without AdvisoryLock don't exclude each other. see WithAdvisoryLock.
+	AdvisoryLock bool
+
+	// PostCommitVerify make Run check the target again on fresh connection after commit, and return
+	// *PostCommitVerifyError if the committed state doesn't match the source, e.g. because a trigger mutate
+	// the meta table. the migrations are already committed at that point.
+	PostCommitVerify bool
+
+	// DeploymentID, when not empty, is stored with every migration executed by Run,
+	// see MigrationsForDeployment.
+	DeploymentID string
+
+	// SourceVersion, when not empty, is stored in the run history with every Run, e.g. the git commit of
+	// the migration files, to correlate the schema state with the code, see RunHistory.
+	SourceVersion string
+
+	// SingleBatch make Run execute all pending migrations and their meta rows in single Exec, to save round trips
+	// when there are many small migrations, e.g. bootstrapping fresh database over high latency link.
+	// the failed migration is still reported in *ExecError.
+	//
+	// it is ignored when per-migration result is needed: with Options.BeforeEach, Options.AfterEach, Options.OnResult,
+	// Options.DelayBetween, Options.SplitStatements, or when some pending migration has expect-rows directive.
+	// the duration metric is not observed in single batch.
+	SingleBatch bool
+
+	// WarnOnBlockers, when not nil, is called by Run before taking any lock, with other sessions in the same
+	// database that are in transaction, oldest first, it is not called when there is none.
+	// those transactions may block the migration, or be blocked by it, for unbounded time.
+	//
+	// it can log them and return nil to continue, or return error to abort Run with *BlockedError,
+	// e.g. when some Blocker.TxAge is too long.
+	WarnOnBlockers func(blockers []Blocker) error
+
+	// RejectEmptyMigration make New reject migration file that is empty after normalization,
+	// i.e. only has whitespace and comments, with *EmptyMigrationError.
+	RejectEmptyMigration bool
+
+	// EmptyMigrationHash, when not nil, is used to compute the hash of migration file that is empty after
+	// normalization, instead of the hash of empty string, which is the same for all of them.
+	// content is the file content as is. see HashRawContent.
+	//
+	// it changes the hash of existing empty migrations, so enabling it against existing database
+	// will make Check and Run fail with *MismatchHashError for those migrations.
+	EmptyMigrationHash func(id string, content string) string
+
+	// Finalizer, when not empty, is sql executed once by Run after the last migration, e.g. to refresh
+	// materialized view. it is not executed when there is no pending migration.
+	//
+	// it is executed in the same transaction as the migrations, or after commit with Options.FinalizerAfterCommit.
+	// failed finalizer is reported with *FinalizerError.
+	Finalizer string
+
+	// FinalizerAfterCommit make Options.Finalizer executed after the migrations are committed, outside transaction,
+	// for statement that cannot run inside transaction block, like "vacuum analyze" or "create index concurrently".
+	// Options.SearchPath is not applied to it.
+	FinalizerAfterCommit bool
+
+	// ContentAddressed make the id of each migration derived from its hash, "sha256:<hash>", instead of its file name,
+	// so identical content always has the same id regardless of the file name. the file name is still used
+	// for ordering, so it act as the sequence, e.g. "0001.sql".
+	//
+	// changing a migration doesn't cause *MismatchHashError, it become new pending migration instead.
+	// two migrations with the same content make New panic.
+	// it changes every id, so it cannot be enabled against database migrated without it.
+	ContentAddressed bool
+
+	// ForceSchemaQualify, when not empty, make New look for "create table" and "create index" on table without
+	// explicit schema, which would land in whatever schema is first in the search_path at the time Run is executed.
+	// they are reported by (*Migration).UnqualifiedObjects, with suggestion to qualify them with this schema.
+	ForceSchemaQualify string
+
+	// StrictSchemaQualify make New panic with *SchemaQualifyError instead,
+	// when Options.ForceSchemaQualify found unqualified object.
+	StrictSchemaQualify bool
+
+	// StrictOrdering make New reject, with *OrderingError, versioned migration whose file name doesn't start
+	// with numeric prefix followed by "_" or ".", or whose prefix is not greater than the one before it,
+	// e.g. "0001a_hotfix.sql" sorted between "0001_a.sql" and "0002_b.sql".
+	//
+	// sequence prefixes must also be gap-free, each one more than the previous. 14-digit timestamp prefixes,
+	// like the ones from the create command of the cli, only need to be increasing.
+	// repeatable migrations are not checked.
+	StrictOrdering bool
+
+	// CaptureSchemaHash make Run compute hash of the live schema (tables, columns, and indexes, outside the
+	// system schemas and the meta table schema) after executing the migrations, and store it next to the meta table,
+	// so out-of-band schema change can be detected later by VerifySchemaHash.
+	//
+	// the hash is only captured when some migration is executed, or when it is not captured yet,
+	// so Run doesn't silently accept out-of-band change.
+	CaptureSchemaHash bool
+
+	// Maintenance make Run set the maintenance flag, stored next to the meta table, before starting the
+	// transaction, and clear it at the end, whether the migrations succeed or not. the application can poll it
+	// with InMaintenance to enter read-only mode while the schema is being changed.
+	//
+	// it is also set by the other functions executing migrations in the locked transaction: RunTo, RunConn,
+	// EnsureApplied, and Rollback, but not DryRun. the flag is set after taking the advisory lock of Options.AdvisoryLock,
+	// which is implied, so concurrent Run waiting for the lock, or failing to get it, doesn't touch the flag.
+	// the meta table is still locked too, unless Options.AdvisoryLock is set explicitly.
+	Maintenance bool
+
+	// MaxRetries is how many times Run, RunTo, and RunConn retry the whole transaction from the beginning when
+	// it fail with transient error: serialization failure, deadlock, or error accepted by Options.Retryable.
+	// it is not retried once the transaction is committed. 0 means no retry. see WithSerializationRetry.
+	MaxRetries int
+
+	// RetryBackoff is how long to wait before the first retry, doubled for each subsequent retry.
+	RetryBackoff time.Duration
+
+	// StatementTimeout and LockTimeout, when positive, are set as statement_timeout and lock_timeout with
+	// "set local" right after Run begin the transaction, so runaway migration or long wait for a lock held by
+	// the application fail with *TimeoutError instead of blocking indefinitely. they apply to each statement,
+	// including waiting for the meta table lock, not to the whole Run.
+	//
+	// each migration is executed after "reset all", which also reset "set local", so they are set again
+	// after it. see WithStatementTimeout and WithLockTimeout.
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+
+	// Retryable, when not nil, report whether err is transient in addition to serialization failure
+	// and deadlock, e.g. lock error raised by some extension, see Options.MaxRetries.
+	Retryable func(err error) bool
+
+	// AppID, when not empty, tag the target database with this app id on the first Run, and make Check and Run
+	// fail with *InvalidAppIDError when the database is already tagged with different one, so the migrations
+	// of one application are never executed against the database of another. default to the app id in
+	// __APP_ID__.txt of the source, see New. see WithAppID.
+	AppID string
+
+	// location of the meta table, default to defaultMetaSchema and defaultMetaTable
+	metaSchema string
+	metaTable  string
+}
+
+// Option for New.
+//
+// for example:
+//
+//	migration.New(source, func(o *migration.Options) {
+//		o.AfterEach = func(id string, d time.Duration, err error) { ... }
+//	})
+type Option func(*Options)
+
+// WithSchema set the schema of the meta table, default to "go_migration".
+// name can only contains [a-z0-9_], otherwise New panic.
+func WithSchema(name string) Option {
+	return func(o *Options) { o.metaSchema = name }
+}
+
+// WithTable set the name of the meta table, default to "meta".
+// name can only contains [a-z0-9_], at most 51 characters, otherwise New panic.
+//
+// the lock table and the schema hash table are named name + "_lock" and name + "_schema_hash",
+// the limit keep them within postgres identifier length limit.
+func WithTable(name string) Option {
+	return func(o *Options) { o.metaTable = name }
+}
+
+// WithAdvisoryLock set Options.AdvisoryLock.
+func WithAdvisoryLock(enabled bool) Option {
+	return func(o *Options) { o.AdvisoryLock = enabled }
+}
+
+// WithSerializationRetry set Options.MaxRetries and Options.RetryBackoff, so Run retry the whole transaction
+// up to attempts times when it fail with serialization failure or deadlock, e.g. when two deployers race to migrate.
+func WithSerializationRetry(attempts int, backoff time.Duration) Option {
+	return func(o *Options) {
+		o.MaxRetries = attempts
+		o.RetryBackoff = backoff
+	}
+}
+
+// WithAppID set Options.AppID.
+func WithAppID(id string) Option {
+	return func(o *Options) { o.AppID = id }
+}
+
+// WithStatementTimeout set Options.StatementTimeout.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(o *Options) { o.StatementTimeout = d }
+}
+
+// WithLockTimeout set Options.LockTimeout.
+func WithLockTimeout(d time.Duration) Option {
+	return func(o *Options) { o.LockTimeout = d }
+}
+
+// WithStrictOrdering set Options.StrictOrdering.
+func WithStrictOrdering(enabled bool) Option {
+	return func(o *Options) { o.StrictOrdering = enabled }
+}
+
+// newOptions return Options with opts applied, for package-level functions.
+func newOptions(opts []Option) (*Options, error) {
+	o := new(Options)
+	for _, f := range opts {
+		f(o)
+	}
+	return o, o.validate()
+}
+
+// maxIdentLen is postgres identifier length limit, longer name is truncated.
+const maxIdentLen = 63
+
+// maxMetaTableLen is the limit of the meta table name, so the side tables, named with the longest suffix
+// like "_schema_hash", still fit maxIdentLen and don't collide after truncation.
+const maxMetaTableLen = maxIdentLen - len("_schema_hash")
+
+// validate the options that cannot be validated when they are set.
+func (o *Options) validate() error {
+	if o.metaSchema != "" && !isSafeIdent(o.metaSchema, maxIdentLen) {
+		return &InvalidMetaNameError{Name: o.metaSchema, Max: maxIdentLen}
+	}
+	if o.metaTable != "" && !isSafeIdent(o.metaTable, maxMetaTableLen) {
+		return &InvalidMetaNameError{Name: o.metaTable, Max: maxMetaTableLen}
+	}
+	return nil
+}
+
+// isSafeIdent report whether name only contains [a-z0-9_], and is at most max characters.
+func isSafeIdent(name string, max int) bool {
+	if len(name) > max {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z') && !('0' <= c && c <= '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Options) readTarget(target string) string {
+	if o.ReadTarget != "" {
+		return o.ReadTarget
+	}
+	return target
+}
+
+// statementPrefix is executed before each migration statement, in the same Exec.
+func (o *Options) statementPrefix() string {
+	return o.resetSQL(`set local`)
+}
+
+// sessionPrefix is like statementPrefix, but for migration with no-transaction directive,
+// it must be executed in separate Exec, because multiple statements in one Exec run in implicit transaction.
+func (o *Options) sessionPrefix() string {
+	return o.resetSQL(`set`)
+}
+
+// resetSQL reset the session parameters, and set the search_path and the timeouts with the set command.
+func (o *Options) resetSQL(set string) string {
+	prefix := `reset all;`
+	if o.SearchPath != "" {
+		var schemas []string
+		for _, s := range strings.Split(o.SearchPath, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				schemas = append(schemas, quoteIdent(s))
+			}
+		}
+		prefix += set + ` search_path to ` + strings.Join(schemas, ", ") + `;`
+	}
+	return prefix + o.timeoutSQL(set)
+}
+
+// timeoutSQL set Options.StatementTimeout and Options.LockTimeout with the set command,
+// empty string if neither is set.
+func (o *Options) timeoutSQL(set string) string {
+	sql := ``
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"statement_timeout", o.StatementTimeout},
+		{"lock_timeout", o.LockTimeout},
+	} {
+		if t.d > 0 {
+			ms := t.d.Milliseconds()
+			if ms == 0 {
+				ms = 1 // 0 means no timeout
+			}
+			sql += set + ` ` + t.name + ` to ` + strconv.FormatInt(ms, 10) + `;`
+		}
+	}
+	return sql
+}
+
+func (o *Options) normalizer() normalizer {
+	return normalizer{keepTrailingSemicolon: o.StrictSemicolon}
+}
+
+// entryHash compute the hash of e, see Options.EmptyMigrationHash.
+func (o *Options) entryHash(e *entry) string {
+	return o.entryHashWith(e, o.normalizerFor(e))
+}
+
+// legacyEntryHash compute the hash of e like older version did, before quoted text was kept as is.
+func (o *Options) legacyEntryHash(e *entry) string {
+	n := o.normalizerFor(e)
+	n.legacy = true
+	return o.entryHashWith(e, n)
+}
+
+func (o *Options) entryHashWith(e *entry, n normalizer) string {
+	if o.EmptyMigrationHash != nil && n.normalize(e.statement) == "" {
+		return o.EmptyMigrationHash(e.id, e.statement)
+	}
+	return n.hash(e.statement)
+}
+
+// normalizerFor e, taking its directives into account.
+func (o *Options) normalizerFor(e *entry) normalizer {
+	n := o.normalizer()
+	n.sortStatements = e.unorderedGrants
+	return n
+}
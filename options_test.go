@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatementPrefix(t *testing.T) {
+	if p := new(Options).statementPrefix(); p != `reset all;` {
+		t.Fatalf("invalid prefix %s", p)
+	}
+	o := &Options{SearchPath: ` app, $user ,,public`}
+	if p := o.statementPrefix(); p != `reset all;set local search_path to "app", "$user", "public";` {
+		t.Fatalf("invalid prefix %s", p)
+	}
+	o = &Options{StatementTimeout: 1500 * time.Millisecond, LockTimeout: time.Microsecond}
+	if p := o.statementPrefix(); p != `reset all;set local statement_timeout to 1500;set local lock_timeout to 1;` {
+		t.Fatalf("timeouts should be set again after reset all, got %s", p)
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	if !New(testSource()).opts.AutoCreateMeta {
+		t.Fatalf("AutoCreateMeta should be true by default")
+	}
+	if New(testSource(), func(o *Options) { o.AutoCreateMeta = false }).opts.AutoCreateMeta {
+		t.Fatalf("AutoCreateMeta should be overridable")
+	}
+}
+
+func TestWithSchemaAndTable(t *testing.T) {
+	m := New(testSource(), WithSchema("tenant_x_mig"), WithTable("migrations"))
+	if ident := m.opts.metaIdent(); ident != `"tenant_x_mig"."migrations"` {
+		t.Fatalf("invalid meta table %s", ident)
+	}
+	if ident := m.opts.lockTableIdent(); ident != `"tenant_x_mig"."migrations_lock"` {
+		t.Fatalf("invalid lock table %s", ident)
+	}
+	if ddl := m.opts.metaDDL(); strings.Contains(ddl, defaultMetaSchema) {
+		t.Fatalf("meta DDL should not use the default schema: %s", ddl)
+	}
+
+	for _, opt := range []Option{
+		WithSchema(`x"; drop table users; --`),
+		WithSchema("Tenant"),
+		WithTable("meta-table"),
+		WithTable(strings.Repeat("a", 64)),
+		WithSchema(strings.Repeat("a", 64)),
+		// the side tables like "<name>_schema_hash" would be truncated and collide
+		WithTable(strings.Repeat("a", maxMetaTableLen+1)),
+	} {
+		if _, err := NewE(testSource(), opt); err == nil || !strings.Contains(err.Error(), "invalid meta table name") {
+			t.Fatalf("unsafe name should be rejected, got %v", err)
+		}
+	}
+	if _, err := NewE(testSource(), WithSchema(strings.Repeat("a", 63)), WithTable(strings.Repeat("a", maxMetaTableLen))); err != nil {
+		t.Fatalf("name within the limit should be accepted, got %v", err)
+	}
+	if err := Bootstrap("", WithTable("a b")); err == nil || !strings.Contains(err.Error(), "invalid meta table name") {
+		t.Fatalf("package-level function should validate the name, got %v", err)
+	}
+}
+
+func TestRunWithSchemaAndTable(t *testing.T) {
+	target := testTarget(t)
+	tenant := func(name string) []Option {
+		return []Option{WithSchema("test"), WithTable(name)}
+	}
+
+	source := testSource("0001_a.sql", "create table if not exists test.a()")
+	if _, err := New(source, tenant("tenant_a")...).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := New(source, tenant("tenant_b")...).Check(target); err != nil || len(list) != 1 {
+		t.Fatalf("each tenant should have its own meta table, got %v, %v", list, err)
+	}
+	if ok, err := IsInitialized(target, tenant("tenant_a")...); err != nil || !ok {
+		t.Fatalf("meta table should be created in the configured location, got %v, %v", ok, err)
+	}
+	if ok, err := IsInitialized(target); err != nil || ok {
+		t.Fatalf("default meta table should not be created, got %v, %v", ok, err)
+	}
+}
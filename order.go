@@ -0,0 +1,65 @@
+package migration
+
+// OrderDiscrepancy describe a migration that was applied after another migration
+// that comes later in the source.
+type OrderDiscrepancy struct {
+	ID           string
+	AppliedAfter string
+}
+
+// VerifyApplyOrder compare the order migrations were applied in the database with the order in the source.
+//
+// it return every migration that was applied after a migration that comes later in the source,
+// this is only diagnostic. Run and RunTo never apply migrations out of order, but RunSpecific and EnsureApplied
+// can execute a migration before the earlier pending ones, and UnsafeMarkAsExecuted can record one.
+func (m *Migration) VerifyApplyOrder(target string) ([]OrderDiscrepancy, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(bgCtx)
+
+	if exists, err := m.opts.metaExists(bgCtx, conn); err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := conn.Query(bgCtx, ``+
+		`select id from `+m.opts.metaIdent()+` order by at, id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		applied = append(applied, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.orderDiscrepancies(applied), nil
+}
+
+// orderDiscrepancies check applied, the list of migration id in the order they were applied.
+func (m *Migration) orderDiscrepancies(applied []string) []OrderDiscrepancy {
+	var ret []OrderDiscrepancy
+	latest := -1
+	for _, id := range applied {
+		i, ok := m.revEntries[id]
+		if !ok {
+			continue
+		}
+		if i < latest {
+			ret = append(ret, OrderDiscrepancy{ID: id, AppliedAfter: m.entries[latest].id})
+			continue
+		}
+		latest = i
+	}
+	return ret
+}
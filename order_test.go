@@ -0,0 +1,28 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderDiscrepancies(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "",
+		"0002_b.sql", "",
+		"0003_c.sql", "",
+		"0004_d.sql", "",
+	))
+
+	if d := m.orderDiscrepancies([]string{"0001_a.sql", "0002_b.sql", "0004_d.sql"}); len(d) != 0 {
+		t.Fatalf("in order history should not have discrepancy: %v", d)
+	}
+
+	d := m.orderDiscrepancies([]string{"0001_a.sql", "0004_d.sql", "deleted.sql", "0002_b.sql", "0003_c.sql"})
+	want := []OrderDiscrepancy{
+		{ID: "0002_b.sql", AppliedAfter: "0004_d.sql"},
+		{ID: "0003_c.sql", AppliedAfter: "0004_d.sql"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Fatalf("invalid discrepancies %v", d)
+	}
+}
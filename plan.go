@@ -0,0 +1,94 @@
+package migration
+
+import "encoding/json"
+
+// plan is the pending migrations exported by ExportPlan.
+type plan struct {
+	Migrations []plannedMigration `json:"migrations"`
+}
+
+type plannedMigration struct {
+	ID        string `json:"id"`
+	Hash      string `json:"hash"`
+	Statement string `json:"statement"`
+}
+
+// planArtifact is the serialized plan together with its signature.
+type planArtifact struct {
+	Plan      []byte `json:"plan"`
+	Signature []byte `json:"signature"`
+}
+
+// ExportPlan serialize the pending migrations of target (their ids, hashes, and statements), sign it with
+// signer, and return both as single artifact, to be approved and later applied by ApplyPlan.
+//
+// signer receive the serialized plan and return its signature, e.g. ed25519.Sign with the pipeline key.
+// ExportPlan never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) ExportPlan(target string, signer func([]byte) ([]byte, error)) ([]byte, error) {
+	list, err := m.Check(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var p plan
+	for _, id := range list {
+		e := m.entries[m.revEntries[id]]
+		p.Migrations = append(p.Migrations, plannedMigration{ID: e.id, Hash: e.hash, Statement: e.statement})
+	}
+	planBytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer(planBytes)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(planArtifact{Plan: planBytes, Signature: signature})
+}
+
+// ApplyPlan verify the signature of artifact exported by ExportPlan, and execute exactly the migrations in it,
+// like Run.
+//
+// verify receive the serialized plan and its signature, and return error if the signature is invalid,
+// it is returned as *PlanSignatureError. *PlanMismatchError is returned when the source has different statement
+// for some of the planned migrations, or when the pending migrations in target are no longer the planned ones,
+// e.g. because other plan was applied in between. nothing is executed in both cases.
+func (m *Migration) ApplyPlan(target string, artifact []byte, verify func(plan []byte, signature []byte) error) ([]string, error) {
+	var a planArtifact
+	if err := json.Unmarshal(artifact, &a); err != nil {
+		return nil, &PlanSignatureError{Err: err}
+	}
+	if err := verify(a.Plan, a.Signature); err != nil {
+		return nil, &PlanSignatureError{Err: err}
+	}
+	var p plan
+	if err := json.Unmarshal(a.Plan, &p); err != nil {
+		return nil, err
+	}
+
+	planned := make([]string, len(p.Migrations))
+	var changed []string
+	for i, pm := range p.Migrations {
+		planned[i] = pm.ID
+		j, ok := m.revEntries[pm.ID]
+		if !ok || m.entries[j].hash != pm.Hash || m.entries[j].statement != pm.Statement {
+			changed = append(changed, pm.ID)
+		}
+	}
+	if len(changed) > 0 {
+		return nil, &PlanMismatchError{Planned: planned, Changed: changed}
+	}
+
+	return m.opts.retry(bgCtx, runAttempt(
+		func() (*runner, error) { return m.begin(bgCtx, target) },
+		func(r *runner) ([]string, error) {
+			pick := func(list []string) ([]string, []string, error) {
+				if !equalStrings(list, planned) {
+					return nil, nil, &PlanMismatchError{Planned: planned, Pending: list}
+				}
+				return list, nil, nil
+			}
+			return m.run(r, pick, func(remaining []string) error { return m.postCommitVerify(bgCtx, target, remaining) })
+		},
+	))
+}
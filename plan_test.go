@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	target := testTarget(t)
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := func(b []byte) ([]byte, error) { return ed25519.Sign(priv, b), nil }
+	verify := func(b, sig []byte) error {
+		if !ed25519.Verify(pub, b, sig) {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	)
+
+	artifact, err := New(source).ExportPlan(target, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tamper the planned statement, keeping the old signature
+	var a planArtifact
+	if err := json.Unmarshal(artifact, &a); err != nil {
+		t.Fatal(err)
+	}
+	var p plan
+	if err := json.Unmarshal(a.Plan, &p); err != nil {
+		t.Fatal(err)
+	}
+	p.Migrations[1].Statement = "drop schema test cascade"
+	if a.Plan, err = json.Marshal(p); err != nil {
+		t.Fatal(err)
+	}
+	tampered, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sigErr *PlanSignatureError
+	if _, err := New(source).ApplyPlan(target, tampered, verify); !errors.As(err, &sigErr) {
+		t.Fatalf("tampered plan should be rejected, got %v", err)
+	}
+
+	changed := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b(id int)",
+	)
+	var mismatch *PlanMismatchError
+	if _, err := New(changed).ApplyPlan(target, artifact, verify); !errors.As(err, &mismatch) || !reflect.DeepEqual(mismatch.Changed, []string{"0002_b.sql"}) {
+		t.Fatalf("plan should be rejected when the source is changed, got %v", err)
+	}
+
+	list, err := New(source).ApplyPlan(target, artifact, verify)
+	if err != nil || !reflect.DeepEqual(list, []string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("should apply the plan, got %v, %v", list, err)
+	}
+
+	if _, err := New(source).ApplyPlan(target, artifact, verify); !errors.As(err, &mismatch) || len(mismatch.Pending) != 0 {
+		t.Fatalf("already applied plan should be rejected, got %v", err)
+	}
+}
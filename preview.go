@@ -0,0 +1,108 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PreviewWithRollback return the sql script of the transaction Run would execute against target, and the
+// script that would reverse it with the down migrations in reverse order, so both can be reviewed before
+// approving the deployment. migration without down migration is noted as comment in rollback.
+//
+// both are empty if there is no pending migration. the scripts are meant for review, Run doesn't execute
+// them as is, e.g. migration with Options.OnResult is executed in two steps.
+//
+// PreviewWithRollback never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) PreviewWithRollback(target string) (apply string, rollback string, err error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close(bgCtx)
+
+	list, err := m.check(bgCtx, conn)
+	if err != nil || len(list) == 0 {
+		return "", "", err
+	}
+
+	exists, err := m.opts.metaExists(bgCtx, conn)
+	if err != nil {
+		return "", "", err
+	}
+	chain := ""
+	if exists {
+		if chain, err = m.opts.queryLastChainLink(bgCtx, conn); err != nil {
+			return "", "", err
+		}
+	}
+	var serverVersion string
+	if err := conn.QueryRow(bgCtx, `select version()`).Scan(&serverVersion); err != nil {
+		return "", "", err
+	}
+
+	// like runner.begin, the session level locks are taken before the transaction and held until the end,
+	// the meta table is only locked inside each transaction
+	var lock, unlock string
+	if key := m.opts.ProcessLockKey; key != 0 {
+		lock += fmt.Sprintf("select pg_advisory_lock(%d);\n", key)
+		unlock = fmt.Sprintf("select pg_advisory_unlock(%d);\n", key) + unlock
+	}
+	if m.opts.AdvisoryLock || m.opts.Maintenance {
+		key := m.opts.advisoryLockKey()
+		lock += fmt.Sprintf("select pg_advisory_lock(%d);\n", key)
+		unlock = fmt.Sprintf("select pg_advisory_unlock(%d);\n", key) + unlock
+	}
+	if lock != "" {
+		lock += "\n"
+		unlock = "\n" + unlock
+	}
+	begin := "begin isolation level serializable;\n"
+	if sql := m.opts.timeoutSQL("set local"); sql != "" {
+		begin += sql + "\n"
+	}
+	if !m.opts.AdvisoryLock {
+		begin += "lock table " + m.opts.lockIdent() + " in access exclusive mode;\n"
+	}
+
+	var a strings.Builder
+	if !exists && m.opts.AutoCreateMeta {
+		a.WriteString(m.opts.metaDDL() + ";\n\n")
+	}
+	a.WriteString(lock + begin)
+	for _, id := range list {
+		e := m.entries[m.revEntries[id]]
+		if e.noTx {
+			fmt.Fprintf(&a, "\ncommit;\n\n-- %s, outside transaction\n%s\n%s\n;\n", e.id, m.opts.sessionPrefix(), e.statement)
+			a.WriteString(inlineArgs(m.opts.recordSQL(e), m.opts.insertArgs(e, chain, serverVersion, nil)) + ";\n")
+			a.WriteString("reset all;\n\n" + begin)
+			chain = chainLink(chain, e.id, e.hash)
+			continue
+		}
+		fmt.Fprintf(&a, "\n-- %s\n%s%s\n;\n", e.id, m.opts.statementPrefix(), e.statement)
+		a.WriteString(inlineArgs(m.opts.recordSQL(e), m.opts.insertArgs(e, chain, serverVersion, nil)) + ";\n")
+		chain = chainLink(chain, e.id, e.hash)
+	}
+	if m.opts.Finalizer != "" && !m.opts.FinalizerAfterCommit {
+		fmt.Fprintf(&a, "\n-- finalizer\n%s%s\n;\n", m.opts.statementPrefix(), m.opts.Finalizer)
+	}
+	a.WriteString("\ncommit;\n")
+	if m.opts.Finalizer != "" && m.opts.FinalizerAfterCommit {
+		fmt.Fprintf(&a, "\n-- finalizer\n%s\n;\n", m.opts.Finalizer)
+	}
+	a.WriteString(unlock)
+
+	var r strings.Builder
+	r.WriteString(lock + begin)
+	for i := len(list) - 1; i >= 0; i-- {
+		e := m.entries[m.revEntries[list[i]]]
+		if !e.hasDown {
+			fmt.Fprintf(&r, "\n-- %s has no down migration, it cannot be rolled back\n", e.id)
+			continue
+		}
+		fmt.Fprintf(&r, "\n-- %s\n%s%s\n;\n", downID(e.id), m.opts.statementPrefix(), e.down)
+		r.WriteString("delete from " + m.opts.metaIdent() + " where id = " + quoteLiteral(e.id) + ";\n")
+	}
+	r.WriteString("\ncommit;\n" + unlock)
+
+	return a.String(), r.String(), nil
+}
@@ -0,0 +1,101 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func assertOrder(t *testing.T, name, script string, parts ...string) {
+	t.Helper()
+	pos := -1
+	for _, p := range parts {
+		i := strings.Index(script, p)
+		if i < 0 || i < pos {
+			t.Fatalf("%s should contain %q in order:\n%s", name, p, script)
+		}
+		pos = i
+	}
+}
+
+func TestPreviewWithRollback(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0001_a.down.sql", "drop table test.a",
+		"0002_b.up.sql", "create table test.b()",
+		"0002_b.down.sql", "drop table test.b",
+	)
+	m := New(source)
+
+	apply, rollback, err := m.PreviewWithRollback(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertOrder(t, "apply", apply,
+		"begin isolation level serializable;",
+		"-- 0001_a.sql", "create table test.a()", `'0001_a.sql'`,
+		"-- 0002_b.up.sql", "create table test.b()", `'0002_b.up.sql'`,
+		"commit;",
+	)
+	assertOrder(t, "rollback", rollback,
+		"begin isolation level serializable;",
+		"-- 0002_b.down.sql", "drop table test.b", `where id = '0002_b.up.sql'`,
+		"-- 0001_a.down.sql", "drop table test.a", `where id = '0001_a.sql'`,
+		"commit;",
+	)
+
+	// both scripts must be executable as is
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, apply); err != nil {
+		t.Fatalf("apply script failed: %v", err)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("apply script should execute everything, got %v, %v", list, err)
+	}
+	if err := m.VerifyChain(target); err != nil {
+		t.Fatalf("apply script should keep the chain, got %v", err)
+	}
+	if _, err := conn.Exec(bgCtx, rollback); err != nil {
+		t.Fatalf("rollback script failed: %v", err)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 2 {
+		t.Fatalf("rollback script should reverse everything, got %v, %v", list, err)
+	}
+
+	_, rollback, err = New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0002_b.down.sql", "drop table test.b",
+	)).PreviewWithRollback(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rollback, "-- 0001_a.sql has no down migration") {
+		t.Fatalf("rollback should note the gap:\n%s", rollback)
+	}
+}
+
+func TestPreviewWithRollbackAdvisoryLock(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0001_a.down.sql", "drop table test.a",
+	), func(o *Options) { o.AdvisoryLock = true })
+
+	apply, rollback, err := m.PreviewWithRollback(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := fmt.Sprintf("select pg_advisory_lock(%d);", m.opts.advisoryLockKey())
+	unlock := fmt.Sprintf("select pg_advisory_unlock(%d);", m.opts.advisoryLockKey())
+	assertOrder(t, "apply", apply, lock, "begin isolation level serializable;", "create table test.a()", "commit;", unlock)
+	assertOrder(t, "rollback", rollback, lock, "begin isolation level serializable;", "drop table test.a", "commit;", unlock)
+	if strings.Contains(apply, "pg_advisory_xact_lock") {
+		t.Fatalf("apply should take the session level lock like Run:\n%s", apply)
+	}
+}
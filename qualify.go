@@ -0,0 +1,96 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnqualifiedObject is a table or index created without explicit schema, see Options.ForceSchemaQualify.
+type UnqualifiedObject struct {
+	ID        string // the migration
+	Line      int
+	Kind      string // "table" or "index"
+	Name      string // the unqualified table name, for index it is the indexed table
+	Suggested string // Name qualified with Options.ForceSchemaQualify
+}
+
+func (u UnqualifiedObject) String() string {
+	on := ""
+	if u.Kind == "index" {
+		on = " on"
+	}
+	return fmt.Sprintf("%s:%d: create %s%s %s is not schema-qualified, use %s", u.ID, u.Line, u.Kind, on, u.Name, u.Suggested)
+}
+
+// UnqualifiedObjects return the tables and indexes created without explicit schema, found by New
+// with Options.ForceSchemaQualify, in order. it is meant to be printed as warnings.
+func (m *Migration) UnqualifiedObjects() []UnqualifiedObject {
+	return m.unqualified
+}
+
+// checkSchemaQualify collect the unqualified objects of all entries, see Options.ForceSchemaQualify.
+func (m *Migration) checkSchemaQualify() error {
+	schema := m.opts.ForceSchemaQualify
+	for _, e := range m.entries {
+		for _, stmt := range statements(scan(e.statement)) {
+			kind, name, ok := unqualifiedCreate(stmt)
+			if !ok {
+				continue
+			}
+			m.unqualified = append(m.unqualified, UnqualifiedObject{
+				ID:        e.id,
+				Line:      stmt[0].line,
+				Kind:      kind,
+				Name:      name,
+				Suggested: quoteIdent(schema) + "." + quoteIdent(name),
+			})
+		}
+	}
+	if m.opts.StrictSchemaQualify && len(m.unqualified) > 0 {
+		return &SchemaQualifyError{Objects: m.unqualified}
+	}
+	return nil
+}
+
+// unqualifiedCreate check whether stmt is "create table" or "create index" on table without schema qualifier,
+// temporary table is ignored because it always lives in its own schema.
+func unqualifiedCreate(stmt []token) (kind string, name string, ok bool) {
+	if len(stmt) == 0 || !stmt[0].is("create") {
+		return "", "", false
+	}
+
+	i := 1
+	for i < len(stmt) && stmt[i].kind == tokenWord && createModifiers[strings.ToLower(stmt[i].text)] {
+		if stmt[i].is("temp") || stmt[i].is("temporary") {
+			return "", "", false
+		}
+		i++
+	}
+	if i >= len(stmt) || !(stmt[i].is("table") || stmt[i].is("index")) {
+		return "", "", false
+	}
+	kind = strings.ToLower(stmt[i].text)
+	i++
+
+	if kind == "index" {
+		// index is always created in the schema of its table, so check the table instead
+		for i < len(stmt) && !stmt[i].is("on") {
+			i++
+		}
+		i++
+		if i < len(stmt) && stmt[i].is("only") {
+			i++
+		}
+	} else if i+2 < len(stmt) && stmt[i].is("if") && stmt[i+1].is("not") && stmt[i+2].is("exists") {
+		i += 3
+	}
+	if i >= len(stmt) {
+		return "", "", false
+	}
+
+	qualified, _ := parseQualifiedName(stmt[i:])
+	if len(qualified) != 1 {
+		return "", "", false
+	}
+	return kind, qualified[0], true
+}
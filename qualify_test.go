@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnqualifiedObjects(t *testing.T) {
+	source := testSource(
+		"0001_a.sql", "create table users(id int);\n"+
+			"create table if not exists app.orders(id int);\n"+
+			"create temp table scratch(id int);\n"+
+			"create unique index concurrently if not exists users_id on only users(id);\n"+
+			"create index on app.orders(id);\n"+
+			`create table "Mixed"(id int);`,
+		"0002_b.sql", "create view v as select 1",
+	)
+
+	if list := New(source).UnqualifiedObjects(); list != nil {
+		t.Fatalf("analysis should be disabled by default, got %v", list)
+	}
+
+	m := New(source, func(o *Options) { o.ForceSchemaQualify = "app" })
+	expected := []UnqualifiedObject{
+		{ID: "0001_a.sql", Line: 1, Kind: "table", Name: "users", Suggested: `"app"."users"`},
+		{ID: "0001_a.sql", Line: 4, Kind: "index", Name: "users", Suggested: `"app"."users"`},
+		{ID: "0001_a.sql", Line: 6, Kind: "table", Name: "Mixed", Suggested: `"app"."Mixed"`},
+	}
+	if got := m.UnqualifiedObjects(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("invalid unqualified objects %v", got)
+	}
+	if s := expected[0].String(); s != `0001_a.sql:1: create table users is not schema-qualified, use "app"."users"` {
+		t.Fatalf("invalid string %s", s)
+	}
+
+	_, err := NewE(source, func(o *Options) {
+		o.ForceSchemaQualify = "app"
+		o.StrictSchemaQualify = true
+	})
+	var qualify *SchemaQualifyError
+	if !errors.As(err, &qualify) || !reflect.DeepEqual(qualify.Objects, expected) {
+		t.Fatalf("should return SchemaQualifyError, got %v", err)
+	}
+}
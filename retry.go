@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+)
+
+// retryable report whether err is transient, see Options.MaxRetries.
+func (o *Options) retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01": // deadlock_detected
+			return true
+		}
+	}
+	return o.Retryable != nil && o.Retryable(err)
+}
+
+// retry call attempt until it succeed, fail with error that is not transient, or fail after commit,
+// up to Options.MaxRetries times, with exponential backoff starting from Options.RetryBackoff.
+func (o *Options) retry(ctx context.Context, attempt func() (list []string, committed bool, err error)) ([]string, error) {
+	backoff := o.RetryBackoff
+	for i := 0; ; i++ {
+		list, committed, err := attempt()
+		if err == nil || committed || i >= o.MaxRetries || !o.retryable(err) {
+			return list, err
+		}
+		if backoff > 0 {
+			if err := sleep(ctx, backoff); err != nil {
+				return nil, err
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// runAttempt begin with begin and run the migrations with run, for Options.retry.
+func runAttempt(begin func() (*runner, error), run func(r *runner) ([]string, error)) func() ([]string, bool, error) {
+	return func() ([]string, bool, error) {
+		r, err := begin()
+		if err != nil {
+			return nil, false, err
+		}
+		list, err := run(r)
+		return list, r.committed || len(r.durable) > 0, err
+	}
+}
@@ -0,0 +1,131 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestRetry(t *testing.T) {
+	custom := &pgconn.PgError{Code: "ZZ001"}
+	o := &Options{
+		MaxRetries: 3,
+		Retryable: func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) && pgErr.Code == "ZZ001"
+		},
+	}
+
+	attempts := 0
+	list, err := o.retry(bgCtx, func() ([]string, bool, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, false, &ExecError{ID: "a.sql", Err: custom}
+		}
+		return []string{"a.sql"}, true, nil
+	})
+	if err != nil || attempts != 3 || len(list) != 1 {
+		t.Fatalf("custom error should be retried, got %v, %v after %d attempts", list, err, attempts)
+	}
+
+	attempts = 0
+	_, err = o.retry(bgCtx, func() ([]string, bool, error) {
+		attempts++
+		return nil, false, &pgconn.PgError{Code: "40001"}
+	})
+	if err == nil || attempts != 4 {
+		t.Fatalf("should give up after MaxRetries, got %v after %d attempts", err, attempts)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		err       error
+		committed bool
+	}{
+		{"non transient", &pgconn.PgError{Code: "42P01"}, false},
+		{"committed", &FinalizerError{Committed: true, Err: custom}, true},
+	} {
+		attempts = 0
+		o.retry(bgCtx, func() ([]string, bool, error) {
+			attempts++
+			return nil, tc.committed, tc.err
+		})
+		if attempts != 1 {
+			t.Fatalf("%s error should not be retried, got %d attempts", tc.name, attempts)
+		}
+	}
+
+	attempts = 0
+	new(Options).retry(bgCtx, func() ([]string, bool, error) {
+		attempts++
+		return nil, false, &pgconn.PgError{Code: "40001"}
+	})
+	if attempts != 1 {
+		t.Fatalf("should not retry by default, got %d attempts", attempts)
+	}
+}
+
+func TestWithSerializationRetry(t *testing.T) {
+	o, err := newOptions([]Option{WithSerializationRetry(2, time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	_, err = o.retry(bgCtx, func() ([]string, bool, error) {
+		attempts++
+		return nil, false, &ExecError{ID: "a.sql", Err: &pgconn.PgError{Code: "40P01"}}
+	})
+	if err == nil || attempts != 3 {
+		t.Fatalf("deadlock should be retried 2 times, got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	_, err = o.retry(bgCtx, func() ([]string, bool, error) {
+		attempts++
+		return nil, false, &ExecError{ID: "a.sql", Err: &pgconn.PgError{Code: "42601"}}
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("syntax error should not be retried, got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestRunRetryable(t *testing.T) {
+	target := testTarget(t)
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, `create sequence test.attempt`); err != nil {
+		t.Fatal(err)
+	}
+
+	// sequence is not transactional, so the migration fail on the first two attempts only
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "do $$ begin if nextval('test.attempt') < 3 then "+
+			"raise exception 'flaky' using errcode = 'ZZ001'; end if; end $$",
+	)
+	list, err := New(source, func(o *Options) {
+		o.MaxRetries = 5
+		o.Retryable = func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) && pgErr.Code == "ZZ001"
+		}
+	}).Run(target)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("should succeed after retry, got %v, %v", list, err)
+	}
+
+	var attempt int
+	if err := conn.QueryRow(bgCtx, `select last_value from test.attempt`).Scan(&attempt); err != nil {
+		t.Fatal(err)
+	}
+	if attempt != 3 {
+		t.Fatalf("should take 3 attempts, got %d", attempt)
+	}
+}
@@ -0,0 +1,62 @@
+package migration
+
+// VerifyReversible check that each down migration fully reverse its up migration, meant to be called in CI
+// against throwaway database that has none of the migrations executed yet.
+//
+// each migration is executed in order, and when it has down migration, the down migration is executed right
+// after it and the schema (tables, columns, and indexes, like Options.CaptureSchemaHash) must be back to the
+// state before the migration, otherwise *IrreversibleMigrationError is returned. the down migration is then
+// undone, so the next migration is executed on top of it. migration without down migration is not checked.
+//
+// everything is executed in single transaction that is always rolled back, so target is not modified,
+// the meta table is not used. migration with no-transaction directive cannot be checked,
+// *NoTxUnsupportedError is returned.
+func (m *Migration) VerifyReversible(target string) error {
+	r := &runner{m: m, ctx: bgCtx, ownConn: true}
+	conn, err := m.opts.connect(bgCtx, target, r.onNotice)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	defer r.close()
+
+	if _, err := conn.Exec(bgCtx, `begin`); err != nil {
+		return err
+	}
+	r.inTx = true
+
+	for _, e := range m.entries {
+		if e.noTx {
+			return &NoTxUnsupportedError{ID: e.id}
+		}
+		before, err := m.opts.querySchemaHash(bgCtx, conn)
+		if err != nil {
+			return err
+		}
+		if _, err := r.exec(e); err != nil {
+			return err
+		}
+		if !e.hasDown {
+			continue
+		}
+
+		if _, err := conn.Exec(bgCtx, `savepoint psql_migration_reversible`); err != nil {
+			return err
+		}
+		if _, err := r.exec(entry{id: downID(e.id), statement: e.down}); err != nil {
+			return err
+		}
+		after, err := m.opts.querySchemaHash(bgCtx, conn)
+		if err != nil {
+			return err
+		}
+		if after != before {
+			return &IrreversibleMigrationError{ID: e.id}
+		}
+		if _, err := conn.Exec(bgCtx, `rollback to savepoint psql_migration_reversible`); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
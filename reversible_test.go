@@ -0,0 +1,36 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyReversible(t *testing.T) {
+	target := testTarget(t)
+
+	reversible := testSource(
+		"0001_a.sql", "create table test.a(id int primary key)",
+		"0001_a.down.sql", "drop table test.a",
+		"0002_b.sql", "alter table test.a add column name text; create index a_name on test.a(name)",
+		"0002_b.down.sql", "alter table test.a drop column name",
+		"0003_c.sql", "create table test.c()",
+	)
+	if err := New(reversible).VerifyReversible(target); err != nil {
+		t.Fatalf("should be reversible, got %v", err)
+	}
+
+	broken := testSource(
+		"0001_a.sql", "create table test.a(id int primary key)",
+		"0001_a.down.sql", "drop table test.a",
+		"0002_b.sql", "alter table test.a add column name text, add column email text",
+		"0002_b.down.sql", "alter table test.a drop column name",
+	)
+	var irreversible *IrreversibleMigrationError
+	if err := New(broken).VerifyReversible(target); !errors.As(err, &irreversible) || irreversible.ID != "0002_b.sql" {
+		t.Fatalf("should return IrreversibleMigrationError, got %v", err)
+	}
+
+	if list, err := New(reversible).Check(target); err != nil || len(list) != 3 {
+		t.Fatalf("target should not be modified, got %v, %v", list, err)
+	}
+}
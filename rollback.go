@@ -0,0 +1,107 @@
+package migration
+
+// RollbackCoverage return the ids of the migrations that have down migration, and the ones that don't,
+// both in the migration order.
+func (m *Migration) RollbackCoverage() (covered, uncovered []string) {
+	for _, e := range m.entries {
+		if e.hasDown {
+			covered = append(covered, e.id)
+		} else {
+			uncovered = append(uncovered, e.id)
+		}
+	}
+	return covered, uncovered
+}
+
+// Rollback execute the down migrations of the last steps executed migrations, in reverse order,
+// and delete them from the meta table, so Run will execute them again.
+//
+// it is executed in the same locked serializable transaction as Run, either all of them are rolled back or none.
+// will return the rolled back ids, latest first.
+//
+// will return *MissingDownMigrationError if some of them has no down migration, *SquashedRollbackError if
+// some of them is squashed (see Squash), *OrphanedMigrationError if some of them is not found in the source, or *MismatchHashError and *InvalidAppIDError like Run.
+// nothing is executed in that case.
+func (m *Migration) Rollback(target string, steps int) ([]string, error) {
+	if steps <= 0 {
+		return nil, nil
+	}
+
+	r, err := m.begin(bgCtx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	if err := m.enforceAppID(r.ctx, r.conn); err != nil {
+		return nil, err
+	}
+	applied, err := r.queryLastApplied(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]entry, 0, len(applied))
+	for _, it := range applied {
+		i, ok := m.revEntries[it.ID]
+		if !ok {
+			if b, ok := m.replacedBy[it.ID]; ok {
+				return nil, &SquashedRollbackError{ID: it.ID, Baseline: m.entries[b].id}
+			}
+			return nil, &OrphanedMigrationError{Orphans: []Item{it}}
+		}
+		e := m.entries[i]
+		if !e.hashMatches(it.Hash) {
+			err := &MismatchHashError{Item: Item{ID: it.ID, Hash: e.hash}, HashInDB: it.Hash}
+			if m.opts.OnDrift == nil {
+				return nil, err
+			}
+			if err := m.opts.OnDrift(err); err != nil {
+				return nil, err
+			}
+		}
+		if !e.hasDown {
+			return nil, &MissingDownMigrationError{ID: e.id}
+		}
+		list = append(list, e)
+	}
+
+	var ret []string
+	for _, e := range list {
+		if _, err := r.exec(entry{id: downID(e.id), statement: e.down}); err != nil {
+			return nil, err
+		}
+		if _, err := r.conn.Exec(r.ctx, `delete from `+m.opts.metaIdent()+` where id = $1`, e.id); err != nil {
+			return nil, err
+		}
+		ret = append(ret, e.id)
+	}
+
+	if err := r.commit(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// queryLastApplied return the last n rows in the meta table, latest first.
+func (r *runner) queryLastApplied(n int) ([]Item, error) {
+	rows, err := r.conn.Query(r.ctx, ``+
+		`select id, hash from `+r.m.opts.metaIdent()+` order by at desc, id desc limit $1`,
+		n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []Item
+	for rows.Next() {
+		var it Item
+		if err := rows.Scan(&it.ID, &it.Hash); err != nil {
+			return nil, err
+		}
+		ret = append(ret, it)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRollbackCoverage(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0001_a.down.sql", "drop table test.a",
+		"0002_b.sql", "insert into test.a default values",
+		"0003_c.sql", "create table test.c()",
+		"0003_c.down.sql", "drop table test.c",
+	))
+
+	covered, uncovered := m.RollbackCoverage()
+	if !reflect.DeepEqual(covered, []string{"0001_a.sql", "0003_c.sql"}) {
+		t.Fatalf("invalid covered list: %v", covered)
+	}
+	if !reflect.DeepEqual(uncovered, []string{"0002_b.sql"}) {
+		t.Fatalf("invalid uncovered list: %v", uncovered)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.up.sql", "create table test.b()",
+		"0002_b.down.sql", "drop table test.b",
+		"0003_c.up.sql", "create table test.c()",
+		"0003_c.down.sql", "drop table test.c",
+	))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := m.Rollback(target, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"0003_c.up.sql", "0002_b.up.sql"}) {
+		t.Fatalf("should rollback the latest first, got %v", list)
+	}
+	if pending, err := m.Check(target); err != nil || !reflect.DeepEqual(pending, []string{"0002_b.up.sql", "0003_c.up.sql"}) {
+		t.Fatalf("rolled back migrations should be pending again, got %v, %v", pending, err)
+	}
+
+	_, err = m.Rollback(target, 1)
+	var missing *MissingDownMigrationError
+	if !errors.As(err, &missing) || missing.ID != "0001_a.sql" {
+		t.Fatalf("should return MissingDownMigrationError, got %v", err)
+	}
+
+	if _, err := m.Run(target); err != nil {
+		t.Fatalf("rolled back migrations should be executable again: %v", err)
+	}
+	_, err = m.Rollback(target, 3)
+	if !errors.As(err, &missing) {
+		t.Fatalf("should return MissingDownMigrationError, got %v", err)
+	}
+	if pending, err := m.Check(target); err != nil || len(pending) != 0 {
+		t.Fatalf("nothing should be rolled back when one of them cannot be, got %v, %v", pending, err)
+	}
+
+	s, err := m.Squash("0003_c.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var squashed *SquashedRollbackError
+	if _, err := s.Rollback(target, 1); !errors.As(err, &squashed) || squashed.ID != "0003_c.up.sql" {
+		t.Fatalf("should return SquashedRollbackError, got %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+package migration
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// runner hold a connection in serializable transaction with the meta table locked.
+type runner struct {
+	m                *Migration
+	ctx              context.Context
+	conn             *pgx.Conn
+	ownConn          bool // conn is opened by the runner, and onNotice is hooked into it
+	inTx             bool
+	nestedTxDetected bool
+	committed        bool
+	processLocked    bool
+	advisoryLocked   bool   // see Options.AdvisoryLock
+	maintenance      bool   // the maintenance flag is set, see Options.Maintenance
+	chain            string // prev_hash for the next recorded row
+	serverVersion    string
+	batchCurrent     string   // id of the migration being executed in single batch
+	durable          []string // migrations already committed by execNoTx, still committed when the rest fail
+	dryRun           bool     // see beginDryRun
+}
+
+// begin connect to target, start the transaction, and lock the meta table.
+func (m *Migration) begin(ctx context.Context, target string) (*runner, error) {
+	r := &runner{m: m, ctx: ctx, ownConn: true}
+	conn, err := m.opts.setupConn(ctx, target, r.onNotice)
+	if err != nil {
+		return nil, err
+	}
+	r.conn = conn
+	if err := r.begin(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// beginDryRun is like begin, but the meta table is created inside the transaction, so it is rolled back
+// with the rest, and the maintenance flag is not set, for DryRun.
+func (m *Migration) beginDryRun(ctx context.Context, target string) (*runner, error) {
+	r := &runner{m: m, ctx: ctx, ownConn: true, dryRun: true}
+	conn, err := m.opts.connect(ctx, target, r.onNotice)
+	if err != nil {
+		return nil, err
+	}
+	r.conn = conn
+	if err := r.begin(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// beginConn is like begin, but use conn owned by the caller, it is not closed by the runner.
+func (m *Migration) beginConn(ctx context.Context, conn *pgx.Conn) (*runner, error) {
+	if err := m.opts.ensureMeta(ctx, conn); err != nil {
+		return nil, err
+	}
+	r := &runner{m: m, ctx: ctx, conn: conn}
+	if err := r.begin(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// begin start the transaction on r.conn and lock the meta table, r is closed on failure.
+func (r *runner) begin() (err error) {
+	defer func() {
+		if err != nil {
+			r.close()
+		}
+	}()
+
+	m, ctx, conn := r.m, r.ctx, r.conn
+
+	if m.opts.Precheck != nil {
+		if err := m.opts.Precheck(conn); err != nil {
+			return &PrecheckFailedError{Err: err}
+		}
+	}
+
+	if m.opts.WarnOnBlockers != nil {
+		blockers, err := queryOpenTransactions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(blockers) > 0 {
+			if err := m.opts.WarnOnBlockers(blockers); err != nil {
+				return &BlockedError{Blockers: blockers, Err: err}
+			}
+		}
+	}
+
+	if key := m.opts.ProcessLockKey; key != 0 {
+		if _, err := conn.Exec(ctx, `select pg_advisory_lock($1)`, key); err != nil {
+			return err
+		}
+		r.processLocked = true
+	}
+
+	// the maintenance flag is only touched while holding the advisory lock, so concurrent Run that is still
+	// waiting for the lock, or fail to get it, never set or clear the flag of the running one
+	if m.opts.AdvisoryLock || m.opts.Maintenance {
+		if err := m.lockAdvisory(ctx, conn); err != nil {
+			return err
+		}
+		r.advisoryLocked = true
+	}
+
+	if m.opts.Maintenance && !r.dryRun {
+		if err := m.opts.setMaintenance(ctx, conn, true); err != nil {
+			return err
+		}
+		r.maintenance = true
+	}
+
+	if err := r.beginTx(); err != nil {
+		return err
+	}
+	if r.dryRun {
+		if err := m.opts.ensureMeta(ctx, conn); err != nil {
+			return err
+		}
+	}
+	if !m.opts.AdvisoryLock {
+		if err := m.lockMeta(ctx, conn); err != nil {
+			return err
+		}
+	}
+	if r.chain, err = m.opts.queryLastChainLink(ctx, conn); err != nil {
+		return err
+	}
+	return conn.QueryRow(ctx, `select version()`).Scan(&r.serverVersion)
+}
+
+// beginTx start the serializable transaction, and set the timeouts, see Options.StatementTimeout.
+func (r *runner) beginTx() error {
+	if _, err := r.conn.Exec(r.ctx, `begin isolation level serializable`); err != nil {
+		return err
+	}
+	r.inTx = true
+	if sql := r.m.opts.timeoutSQL(`set local`); sql != "" {
+		if _, err := r.conn.Exec(r.ctx, sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runner) onNotice(n *pgconn.Notice) {
+	switch {
+	case n.Code == "25001": // there is already a transaction in progress
+		r.nestedTxDetected = true
+	case strings.HasPrefix(n.Message, batchMarker):
+		r.batchCurrent = strings.TrimPrefix(n.Message, batchMarker)
+	}
+}
+
+// close rollback the transaction if not committed yet, clear the maintenance flag, release the advisory lock
+// and the process lock, and close the connection if it is opened by the runner.
+//
+// it doesn't use r.ctx, so the transaction is still rolled back when r.ctx is cancelled.
+func (r *runner) close() {
+	if r.inTx && !r.committed {
+		r.conn.Exec(bgCtx, `rollback`)
+	}
+	if r.maintenance {
+		r.m.opts.setMaintenance(bgCtx, r.conn, false)
+	}
+	if r.advisoryLocked {
+		r.conn.Exec(bgCtx, `select pg_advisory_unlock($1)`, r.m.opts.advisoryLockKey())
+	}
+	if r.processLocked {
+		r.conn.Exec(bgCtx, `select pg_advisory_unlock($1)`, r.m.opts.ProcessLockKey)
+	}
+	if r.ownConn {
+		r.conn.Close(bgCtx)
+	}
+}
+
+func (r *runner) commit() error {
+	if _, err := r.conn.Exec(r.ctx, `commit`); err != nil {
+		return err
+	}
+	r.committed = true
+	return nil
+}
+
+// finalize execute Options.Finalizer, inside the transaction unless it is already committed.
+func (r *runner) finalize() error {
+	sql := r.m.opts.Finalizer
+	if !r.committed {
+		sql = r.m.opts.statementPrefix() + sql
+	}
+	if _, err := r.conn.Exec(r.ctx, sql); err != nil {
+		return &FinalizerError{Committed: r.committed, Err: err}
+	}
+	return nil
+}
+
+// check return the pending migrations, like (*Migration).check,
+// repair the hash of the drifted migrations accepted by Options.OnDrift, and tag the database with Options.AppID.
+func (r *runner) check() ([]string, error) {
+	if err := r.m.opts.checkDirty(r.ctx, r.conn); err != nil {
+		return nil, err
+	}
+	if err := r.m.enforceAppID(r.ctx, r.conn); err != nil {
+		return nil, err
+	}
+	inDB, err := r.m.opts.queryMeta(r.ctx, r.conn)
+	if err != nil {
+		return nil, err
+	}
+	list, err := r.m.pending(inDB)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range r.m.drifted(inDB) {
+		if _, err := r.conn.Exec(r.ctx, r.m.opts.repairSQL(), r.m.opts.recordArgs(e)...); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// execEach exec and record each migration in list.
+func (r *runner) execEach(list []string) error {
+	for i, l := range list {
+		if i > 0 && r.m.opts.DelayBetween > 0 {
+			if err := sleep(r.ctx, r.m.opts.DelayBetween); err != nil {
+				return err
+			}
+		}
+		e := r.m.entries[r.m.revEntries[l]]
+		if e.noTx {
+			if err := r.execNoTx(e, list[:i]); err != nil {
+				return err
+			}
+			continue
+		}
+		d, err := r.exec(e)
+		if err != nil {
+			return err
+		}
+		r.m.metrics.observeDuration(d)
+		if err := r.record(e, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec execute the migration statement, and return how long it took.
+func (r *runner) exec(e entry) (time.Duration, error) {
+	r.nestedTxDetected = false
+	if r.m.opts.BeforeEach != nil {
+		r.m.opts.BeforeEach(e.id)
+	}
+	start := time.Now()
+	tag, stmt, err := r.execStatement(e)
+	d := time.Since(start)
+	if r.m.opts.AfterEach != nil {
+		r.m.opts.AfterEach(e.id, d, err)
+	}
+	if err != nil {
+		return d, r.m.opts.execError(e.id, stmt, err)
+	}
+	if r.nestedTxDetected {
+		return d, &NestedTransactionError{ID: e.id}
+	}
+	if err := e.checkRowCount(tag.RowsAffected()); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// execStatement execute e.statement, with Options.OnResult the last statement is executed separately
+// so its rows can be passed to the callback, and with Options.SplitStatements every statement is.
+//
+// it also return the 1-based index of the failed statement when they are executed separately, 0 otherwise.
+func (r *runner) execStatement(e entry) (pgconn.CommandTag, int, error) {
+	o := &r.m.opts
+	prefix := o.statementPrefix()
+	if e.noTx {
+		if _, err := r.conn.Exec(r.ctx, o.sessionPrefix()); err != nil {
+			return nil, 0, err
+		}
+		prefix = ""
+	}
+
+	stmts := statements(scan(e.statement))
+	if len(stmts) == 0 || (o.OnResult == nil && !o.SplitStatements) {
+		tag, err := r.conn.Exec(r.ctx, prefix+e.statement)
+		return tag, 0, err
+	}
+
+	lastStart := stmts[len(stmts)-1][0].pos
+	last, lastIndex := e.statement[lastStart:], 0
+	if o.SplitStatements {
+		if prefix != "" {
+			if _, err := r.conn.Exec(r.ctx, prefix); err != nil {
+				return nil, 0, err
+			}
+		}
+		for i, stmt := range stmts[:len(stmts)-1] {
+			if _, err := r.conn.Exec(r.ctx, statementText(e.statement, stmt)); err != nil {
+				return nil, i + 1, err
+			}
+		}
+		last, lastIndex = statementText(e.statement, stmts[len(stmts)-1]), len(stmts)
+	} else if _, err := r.conn.Exec(r.ctx, prefix+e.statement[:lastStart]); err != nil {
+		return nil, 0, err
+	}
+
+	if o.OnResult == nil {
+		tag, err := r.conn.Exec(r.ctx, last)
+		return tag, lastIndex, err
+	}
+
+	rows, err := r.conn.Query(r.ctx, last)
+	if err != nil {
+		return nil, lastIndex, err
+	}
+	defer rows.Close()
+	if len(rows.FieldDescriptions()) > 0 {
+		o.OnResult(e.id, rows)
+	}
+	rows.Close()
+	return rows.CommandTag(), lastIndex, rows.Err()
+}
+
+// checkRowCount check the rows affected by e against its expect-rows directive.
+func (e entry) checkRowCount(got int64) error {
+	if e.expectRows != nil && !e.expectRows.match(got) {
+		return &RowCountError{ID: e.id, Got: got, Expected: e.expectRows.String()}
+	}
+	return nil
+}
+
+// record e as executed in the meta table, d is how long it took.
+func (r *runner) record(e entry, d time.Duration) error {
+	if _, err := r.conn.Exec(r.ctx, r.m.opts.recordSQL(e), r.m.opts.insertArgs(e, r.chain, r.serverVersion, &d)...); err != nil {
+		return err
+	}
+	r.chain = chainLink(r.chain, e.id, e.hash)
+	return nil
+}
+
+// recordSQL record e, it take the insertArgs.
+//
+// at is the time of the insert rather than the transaction start, so rows inserted by a single Run
+// are still ordered by at in the order they were executed.
+func (o *Options) recordSQL(e entry) string {
+	return `insert into ` + o.metaIdent() + `(id, hash, normalized, prev_hash, server_version, deployment_id, duration_ms, at) ` +
+		`values ($1, $2, $3, $4, $5, $6, $7, clock_timestamp())` + upsertClause(e)
+}
+
+// upsertClause replace the existing row of e if it is repeatable migration re-executed because its hash changed,
+// it is empty for versioned migration, so recording it twice still fail with unique violation.
+func upsertClause(e entry) string {
+	if !isRepeatable(e.id) {
+		return ``
+	}
+	return ` on conflict (id) do update set hash = excluded.hash, normalized = excluded.normalized, ` +
+		`prev_hash = excluded.prev_hash, server_version = excluded.server_version, ` +
+		`deployment_id = excluded.deployment_id, duration_ms = excluded.duration_ms, dirty = excluded.dirty, at = excluded.at`
+}
+
+// insertArgs return the arguments of recordSQL for e, d is how long it took, nil if unknown.
+func (o *Options) insertArgs(e entry, prevHash, serverVersion string, d *time.Duration) []any {
+	var deploymentID *string
+	if o.DeploymentID != "" {
+		deploymentID = &o.DeploymentID
+	}
+	var durationMS *int64
+	if d != nil {
+		ms := d.Milliseconds()
+		durationMS = &ms
+	}
+	return append(o.recordArgs(e), prevHash, serverVersion, deploymentID, durationMS)
+}
+
+func (o *Options) repairSQL() string {
+	return `update ` + o.metaIdent() + ` set hash = $2, normalized = $3 where id = $1`
+}
+
+// recordArgs return the arguments of recordSQL and repairSQL for e.
+func (o *Options) recordArgs(e entry) []any {
+	var normalized *string
+	if o.StoreNormalized {
+		s := o.normalizerFor(&e).normalize(e.statement)
+		normalized = &s
+	}
+	return []any{e.id, e.hash, normalized}
+}
@@ -0,0 +1,259 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestRunOnResult(t *testing.T) {
+	target := testTarget(t)
+
+	results := make(map[string][]int)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(id int, done bool default false);",
+		"0002_b.sql", "insert into test.a(id) values (1), (2), (3);\n"+
+			"-- psql-migration:expect-rows == 2\n"+
+			"update test.a set done = true where id >= $x$2$x$::int returning id; -- trailing comment",
+	), func(o *Options) {
+		o.OnResult = func(id string, rows pgx.Rows) {
+			results[id] = []int{}
+			for rows.Next() {
+				var v int
+				if err := rows.Scan(&v); err != nil {
+					t.Fatal(err)
+				}
+				results[id] = append(results[id], v)
+			}
+		}
+	})
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string][]int{"0002_b.sql": {2, 3}}; !reflect.DeepEqual(results, want) {
+		t.Fatalf("invalid results %v", results)
+	}
+}
+
+func TestRunServerVersion(t *testing.T) {
+	target := testTarget(t)
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := m.opts.connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+
+	var version string
+	if err := conn.QueryRow(bgCtx, `select version()`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := conn.QueryRow(bgCtx, ``+
+		`select count(*) from `+m.opts.metaIdent()+` where server_version = $1`,
+		version,
+	).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("every row should have the server version, got %d", count)
+	}
+}
+
+func TestRunPrecheck(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+	)
+
+	lowDisk := errors.New("low disk")
+	_, err := New(source, func(o *Options) {
+		o.Precheck = func(conn *pgx.Conn) error { return lowDisk }
+	}).Run(target)
+	var precheck *PrecheckFailedError
+	if !errors.As(err, &precheck) || !errors.Is(err, lowDisk) {
+		t.Fatalf("should return PrecheckFailedError, got %v", err)
+	}
+	if list, err := New(source).Check(target); err != nil || len(list) != 1 {
+		t.Fatalf("nothing should be executed, got %v, %v", list, err)
+	}
+
+	called := false
+	list, err := New(source, func(o *Options) {
+		o.Precheck = func(conn *pgx.Conn) error {
+			called = true
+			var size int64
+			return conn.QueryRow(bgCtx, `select pg_database_size(current_database())`).Scan(&size)
+		}
+	}).Run(target)
+	if err != nil || !called || len(list) != 1 {
+		t.Fatalf("passing precheck should not block the run, got %v, %v, %v", list, err, called)
+	}
+}
+
+func TestRunFinalizer(t *testing.T) {
+	target := testTarget(t)
+	source := testSource(
+		"0001_a.sql", "create table test.a(); create table test.finalized(at timestamptz default now())",
+	)
+	finalizer := func(o *Options) { o.Finalizer = "insert into test.finalized default values" }
+
+	countFinalized := func() int {
+		conn, err := new(Options).connect(bgCtx, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close(bgCtx)
+		var count int
+		if err := conn.QueryRow(bgCtx, `select count(*) from test.finalized`).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	if _, err := New(source, finalizer).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if count := countFinalized(); count != 1 {
+		t.Fatalf("finalizer should run once, got %d", count)
+	}
+
+	if _, err := New(source, finalizer).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if count := countFinalized(); count != 1 {
+		t.Fatalf("finalizer should be skipped when nothing is pending, got %d", count)
+	}
+
+	source2 := testSource(
+		"0001_a.sql", "create table test.a(); create table test.finalized(at timestamptz default now())",
+		"0002_b.sql", "create table test.b()",
+	)
+	_, err := New(source2, func(o *Options) { o.Finalizer = "select 1/0" }).Run(target)
+	var fin *FinalizerError
+	if !errors.As(err, &fin) || fin.Committed {
+		t.Fatalf("should return FinalizerError, got %v", err)
+	}
+	if list, err := New(source2).Check(target); err != nil || len(list) != 1 {
+		t.Fatalf("failed finalizer should rollback the migrations, got %v, %v", list, err)
+	}
+
+	list, err := New(source2, func(o *Options) {
+		o.Finalizer = "select 1/0"
+		o.FinalizerAfterCommit = true
+	}).Run(target)
+	if !errors.As(err, &fin) || !fin.Committed || len(list) != 1 {
+		t.Fatalf("should return committed FinalizerError, got %v, %v", list, err)
+	}
+	if list, err := New(source2).Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("migrations should be committed before finalizer, got %v, %v", list, err)
+	}
+}
+
+func TestRunBeforeAfterEach(t *testing.T) {
+	target := testTarget(t)
+
+	var events []string
+	hooks := func(o *Options) {
+		o.BeforeEach = func(id string) { events = append(events, "before "+id) }
+		o.AfterEach = func(id string, d time.Duration, err error) {
+			if err != nil {
+				events = append(events, "failed "+id)
+				return
+			}
+			events = append(events, "after "+id)
+		}
+	}
+
+	_, err := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "select 1/0",
+		"0003_c.sql", "create table test.c()",
+	), hooks).Run(target)
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.ID != "0002_b.sql" {
+		t.Fatalf("should return ExecError, got %v", err)
+	}
+	expected := []string{"before 0001_a.sql", "after 0001_a.sql", "before 0002_b.sql", "failed 0002_b.sql"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("invalid hooks call %v", events)
+	}
+}
+
+func TestRunTimeouts(t *testing.T) {
+	target := testTarget(t)
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "select pg_sleep(2)",
+	), WithStatementTimeout(200*time.Millisecond))
+	_, err := m.Run(target)
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.ID != "0002_b.sql" || timeout.Kind != "statement_timeout" {
+		t.Fatalf("Run should return TimeoutError, got %v", err)
+	}
+
+	m = New(testSource("0001_a.sql", "create table test.a()"))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	other, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(bgCtx)
+	if _, err := other.Exec(bgCtx, `begin; lock table test.a in access share mode`); err != nil {
+		t.Fatal(err)
+	}
+
+	m = New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "alter table test.a add column id int",
+	), WithLockTimeout(200*time.Millisecond))
+	_, err = m.Run(target)
+	if !errors.As(err, &timeout) || timeout.ID != "0002_b.sql" || timeout.Kind != "lock_timeout" {
+		t.Fatalf("Run should return TimeoutError, got %v", err)
+	}
+}
+
+func TestRunSplitStatements(t *testing.T) {
+	target := testTarget(t)
+	split := func(o *Options) { o.SplitStatements = true }
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a(s text);\n"+
+			"insert into test.a values ('x;y');\n"+
+			"create function test.f() returns int language sql as $$ select 1; $$;\n"+
+			"-- psql-migration:expect-rows == 1\n"+
+			"update test.a set s = 'z' -- trailing comment",
+	), split)
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New(testSource(
+		"0001_a.sql", "create table test.a(s text);\n"+
+			"insert into test.a values ('x;y');\n"+
+			"create function test.f() returns int language sql as $$ select 1; $$;\n"+
+			"-- psql-migration:expect-rows == 1\n"+
+			"update test.a set s = 'z' -- trailing comment",
+		"0002_b.sql", "select 1; select 1/0; select 2",
+	), split).Run(target)
+	var exec *ExecError
+	if !errors.As(err, &exec) || exec.ID != "0002_b.sql" || exec.Statement != 2 {
+		t.Fatalf("should report the failed statement, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package migration
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// RunRecord is a Run invocation recorded in the target database, see RunHistory.
+type RunRecord struct {
+	// SourceVersion is Options.SourceVersion of the Run, empty when it was not set.
+	SourceVersion string
+
+	// IDs is the migrations executed by the Run, empty when nothing was pending.
+	IDs []string
+
+	At time.Time
+}
+
+// recordRun append the run history, in the same transaction as the executed migrations.
+func (r *runner) recordRun(list []string) error {
+	o := &r.m.opts
+	var sourceVersion *string
+	if o.SourceVersion != "" {
+		sourceVersion = &o.SourceVersion
+	}
+	if list == nil {
+		list = []string{}
+	}
+	_, err := r.conn.Exec(r.ctx, ``+
+		`insert into `+o.runsIdent()+`(source_version, ids) values ($1, $2)`,
+		sourceVersion, list,
+	)
+	return err
+}
+
+// queryRuns return the run history, empty if the run history table doesn't exist.
+func (o *Options) queryRuns(ctx context.Context, conn *pgx.Conn) ([]RunRecord, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `select to_regclass($1) is not null`, o.runsIdent()).Scan(&exists); err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, ``+
+		`select coalesce(source_version, ''), ids, at from `+o.runsIdent()+` order by id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []RunRecord
+	for rows.Next() {
+		var rec RunRecord
+		if err := rows.Scan(&rec.SourceVersion, &rec.IDs, &rec.At); err != nil {
+			return nil, err
+		}
+		ret = append(ret, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// RunHistory return every Run invocation recorded in the target database, oldest first,
+// including the ones that had nothing to execute. unlike History, it is per deployment instead of per migration.
+//
+// RunHistory never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) RunHistory(target string) ([]RunRecord, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(bgCtx)
+
+	return m.opts.queryRuns(bgCtx, conn)
+}
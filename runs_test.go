@@ -0,0 +1,53 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunHistory(t *testing.T) {
+	target := testTarget(t)
+	sourceVersion := func(v string) Option {
+		return func(o *Options) { o.SourceVersion = v }
+	}
+
+	m := New(testSource("0001_a.sql", "create table test.a()"), sourceVersion("abc123"))
+	if list, err := m.RunHistory(target); err != nil || len(list) != 0 {
+		t.Fatalf("run history should be empty before the first run, got %v, %v", list, err)
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	m = New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	), sourceVersion("def456"))
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := m.RunHistory(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("each run should be recorded, got %v", list)
+	}
+	for i, want := range []RunRecord{
+		{SourceVersion: "abc123", IDs: []string{"0001_a.sql"}},
+		{SourceVersion: "def456", IDs: []string{"0002_b.sql"}},
+		{SourceVersion: "def456", IDs: []string{}},
+	} {
+		if list[i].At.IsZero() {
+			t.Fatalf("invalid run record %v", list[i])
+		}
+		list[i].At = want.At
+		if !reflect.DeepEqual(list[i], want) {
+			t.Fatalf("invalid run record %d: %v", i, list[i])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package migration
+
+import "strings"
+
+type tokenKind int
+
+const (
+	tokenWord         tokenKind = iota // keyword, unquoted identifier, or number
+	tokenQuotedIdent                   // "ident"
+	tokenString                        // 'string', E'string'
+	tokenDollarString                  // $tag$string$tag$
+	tokenComment                       // -- comment, /* comment */
+	tokenPunct                         // any other single character, like ; ( ) .
+)
+
+type token struct {
+	kind tokenKind
+	text string // exactly as written in the source
+	pos  int    // byte offset in the source
+	line int    // 1-based line number in the source
+}
+
+// is report whether t is word w, case insensitive.
+func (t token) is(w string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, w)
+}
+
+// ident return the identifier name as postgres see it,
+// unquoted identifier is lowercased, quoted one is unquoted as is.
+func (t token) ident() string {
+	if t.kind == tokenQuotedIdent {
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], `""`, `"`)
+	}
+	return strings.ToLower(t.text)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || ('0' <= c && c <= '9') || c == '$'
+}
+
+// scan split sql into tokens, whitespace is dropped, comments are kept as tokenComment.
+//
+// unterminated quote or comment run until the end of sql.
+func scan(sql string) []token {
+	var ret []token
+	line := 1
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		start := i
+		kind := tokenPunct
+
+		switch {
+		case isSpace(c):
+			if c == '\n' {
+				line++
+			}
+			i++
+			continue
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			kind = tokenComment
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			kind = tokenComment
+			depth := 0
+			for i < len(sql) {
+				if sql[i] == '/' && i+1 < len(sql) && sql[i+1] == '*' {
+					depth++
+					i += 2
+				} else if sql[i] == '*' && i+1 < len(sql) && sql[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+
+		case c == '\'' || ((c == 'e' || c == 'E') && i+1 < len(sql) && sql[i+1] == '\''):
+			kind = tokenString
+			backslashEscape := c != '\''
+			if backslashEscape {
+				i++
+			}
+			i = scanQuoted(sql, i, '\'', backslashEscape)
+
+		case c == '"':
+			kind = tokenQuotedIdent
+			i = scanQuoted(sql, i, '"', false)
+
+		case c == '$' && dollarTag(sql[i:]) != "":
+			kind = tokenDollarString
+			tag := dollarTag(sql[i:])
+			if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag)
+			} else {
+				i = len(sql)
+			}
+
+		case isWordPart(c):
+			kind = tokenWord
+			for i < len(sql) && isWordPart(sql[i]) {
+				i++
+			}
+
+		default:
+			i++
+		}
+
+		text := sql[start:i]
+		ret = append(ret, token{kind, text, start, line})
+		line += strings.Count(text, "\n")
+	}
+	return ret
+}
+
+// scanQuoted return the position after the closing quote of the quoted text started at sql[i],
+// doubled quote is an escaped quote.
+func scanQuoted(sql string, i int, quote byte, backslashEscape bool) int {
+	for i++; i < len(sql); i++ {
+		switch {
+		case backslashEscape && sql[i] == '\\':
+			i++
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag return the dollar quote opening tag (like "$$" or "$body$") at the beginning of s,
+// or empty string if s doesn't start with one.
+func dollarTag(s string) string {
+	if len(s) < 2 || s[0] != '$' {
+		return ""
+	}
+	if s[1] == '$' {
+		return "$$"
+	}
+	if !isWordStart(s[1]) {
+		return ""
+	}
+	for i := 2; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case !isWordPart(s[i]):
+			return ""
+		}
+	}
+	return ""
+}
+
+// statementText return the text of stmt, one of the statements of sql, from its first to its last token.
+func statementText(sql string, stmt []token) string {
+	last := stmt[len(stmt)-1]
+	return sql[stmt[0].pos : last.pos+len(last.text)]
+}
+
+// statements group tokens into top-level statements separated by semicolon,
+// comments are dropped and empty statements are skipped.
+func statements(tokens []token) [][]token {
+	var ret [][]token
+	var cur []token
+	for _, t := range tokens {
+		switch {
+		case t.kind == tokenComment:
+		case t.kind == tokenPunct && t.text == ";":
+			if len(cur) > 0 {
+				ret = append(ret, cur)
+			}
+			cur = nil
+		default:
+			cur = append(cur, t)
+		}
+	}
+	if len(cur) > 0 {
+		ret = append(ret, cur)
+	}
+	return ret
+}
@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	tc := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			"it should split words and punctuation",
+			"create table a(id int);",
+			[]string{"create", "table", "a", "(", "id", "int", ")", ";"},
+		},
+		{
+			"it should keep comments",
+			"a -- x ; y\nb /* c /* nested */ ; */ d",
+			[]string{"a", "-- x ; y", "b", "/* c /* nested */ ; */", "d"},
+		},
+		{
+			"it should keep string literal as is",
+			`insert into t values ('a -- b; ''c''', E'd\'e')`,
+			[]string{"insert", "into", "t", "values", "(", `'a -- b; ''c'''`, ",", `E'd\'e'`, ")"},
+		},
+		{
+			"it should keep quoted identifier as is",
+			`select "My ""Table"".x"`,
+			[]string{"select", `"My ""Table"".x"`},
+		},
+		{
+			"it should keep dollar quoted string as is",
+			"as $body$ begin -- x; select $$a;$$; end $body$; select $1",
+			[]string{"as", "$body$ begin -- x; select $$a;$$; end $body$", ";", "select", "$1"},
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, tok := range scan(c.sql) {
+				got = append(got, tok.text)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("invalid tokens %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestScanLine(t *testing.T) {
+	tokens := scan("a\n/* x\n y */ b\n'c\n' d")
+	var lines []int
+	for _, tok := range tokens {
+		lines = append(lines, tok.line)
+	}
+	if !reflect.DeepEqual(lines, []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("invalid lines %v", lines)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	stmts := statements(scan("a 1; ; -- comment\nb $$;$$;c"))
+	if len(stmts) != 3 {
+		t.Fatalf("invalid number of statements %d", len(stmts))
+	}
+	if stmts[1][1].text != "$$;$$" {
+		t.Fatalf("invalid statement %v", stmts[1])
+	}
+}
+
+func TestStatementText(t *testing.T) {
+	sql := "insert into a values ('x;y');\n-- c;\ncreate function f() returns int as $$ select 1; $$ language sql /* z; */;\n select \"a;b\" "
+	var got []string
+	for _, stmt := range statements(scan(sql)) {
+		got = append(got, statementText(sql, stmt))
+	}
+	want := []string{
+		"insert into a values ('x;y')",
+		"create function f() returns int as $$ select 1; $$ language sql",
+		`select "a;b"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid statements %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// schemaObjectsSQL describe the live schema, one row per table, column, and index,
+// outside the system schemas and the schema of the meta table ($1).
+const schemaObjectsSQL = `` +
+	`with s as (` +
+	`select nspname from pg_namespace where nspname not in ('pg_catalog', 'information_schema', $1) ` +
+	`and nspname not like 'pg\_toast%' and nspname not like 'pg\_temp\_%'` +
+	`) ` +
+	`select format('table %I.%I %s', table_schema, table_name, table_type) ` +
+	`from information_schema.tables where table_schema in (select nspname from s) ` +
+	`union all ` +
+	`select format('column %I.%I.%I %s %s %s %s %s %s %s', table_schema, table_name, column_name, ` +
+	`data_type, udt_schema, udt_name, character_maximum_length, numeric_precision, numeric_scale, ` +
+	`is_nullable || ' ' || coalesce(column_default, '')) ` +
+	`from information_schema.columns where table_schema in (select nspname from s) ` +
+	`union all ` +
+	`select format('index %I.%I %s', schemaname, indexname, indexdef) ` +
+	`from pg_indexes where schemaname in (select nspname from s)`
+
+// querySchemaHash compute the hash of the live schema, see Options.CaptureSchemaHash.
+func (o *Options) querySchemaHash(ctx context.Context, conn *pgx.Conn) (string, error) {
+	rows, err := conn.Query(ctx, schemaObjectsSQL, o.metaSchemaName())
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// queryStoredSchemaHash return the schema hash captured by Run, or empty string if none.
+func (o *Options) queryStoredSchemaHash(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `select to_regclass($1) is not null`, o.schemaHashIdent()).Scan(&exists); err != nil || !exists {
+		return "", err
+	}
+	var hash string
+	err := conn.QueryRow(ctx, `select hash from `+o.schemaHashIdent()).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// captureSchemaHash store the hash of the schema, unless it is already captured and force is false.
+func (r *runner) captureSchemaHash(force bool) error {
+	o := &r.m.opts
+	if !force {
+		stored, err := o.queryStoredSchemaHash(r.ctx, r.conn)
+		if err != nil || stored != "" {
+			return err
+		}
+	}
+	hash, err := o.querySchemaHash(r.ctx, r.conn)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.Exec(r.ctx, ``+
+		`insert into `+o.schemaHashIdent()+`(hash) values ($1) `+
+		`on conflict (id) do update set hash = excluded.hash, at = now()`,
+		hash,
+	)
+	return err
+}
+
+// VerifySchemaHash compare the hash of the live schema with the one captured by the last Run with
+// Options.CaptureSchemaHash, and return *SchemaHashMismatchError if they are different, e.g. because someone
+// manually altered a table. it also return *SchemaHashMismatchError if the hash was never captured.
+//
+// VerifySchemaHash never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) VerifySchemaHash(target string) error {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	stored, err := m.opts.queryStoredSchemaHash(bgCtx, conn)
+	if err != nil {
+		return err
+	}
+	current, err := m.opts.querySchemaHash(bgCtx, conn)
+	if err != nil {
+		return err
+	}
+	if stored != current {
+		return &SchemaHashMismatchError{Stored: stored, Current: current}
+	}
+	return nil
+}
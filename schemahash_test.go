@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifySchemaHash(t *testing.T) {
+	target := testTarget(t)
+	capture := func(o *Options) { o.CaptureSchemaHash = true }
+	source := testSource(
+		"0001_a.sql", "create table test.a(id int primary key)",
+	)
+
+	var mismatch *SchemaHashMismatchError
+	if err := New(source).VerifySchemaHash(target); !errors.As(err, &mismatch) || mismatch.Stored != "" {
+		t.Fatalf("should report that the hash was never captured, got %v", err)
+	}
+
+	m := New(source, capture)
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySchemaHash(target); err != nil {
+		t.Fatalf("schema should match right after Run, got %v", err)
+	}
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, `alter table test.a add column name text`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.VerifySchemaHash(target); !errors.As(err, &mismatch) || mismatch.Stored == mismatch.Current {
+		t.Fatalf("manual alter table should be detected, got %v", err)
+	}
+	if _, err := m.Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySchemaHash(target); !errors.As(err, &mismatch) {
+		t.Fatalf("Run without pending migration should not accept the manual change, got %v", err)
+	}
+
+	if _, err := New(testSource(
+		"0001_a.sql", "create table test.a(id int primary key)",
+		"0002_b.sql", "create index on test.a(name)",
+	), capture).Run(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySchemaHash(target); err != nil {
+		t.Fatalf("schema hash should be captured again after executing migration, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package migration
+
+// schemaMetaTable is the name of the meta table created inside each schema by RunInSchemas.
+const schemaMetaTable = defaultMetaSchema + "_" + defaultMetaTable
+
+// RunInSchemas Run the migration once for each schema, in order, and return the executed migrations
+// of each schema.
+//
+// each schema is tracked independently by its own meta table inside that schema, and the migrations
+// are executed with the schema in front of the search_path (before Options.SearchPath), so unqualified
+// object names refer to the schema. schema is created if not exists, it must only contain [a-z0-9_],
+// like WithSchema, otherwise its failure is *InvalidMetaNameError.
+//
+// by default it stop at the first failure, with Options.RunInSchemasContinueOnError the rest of the
+// schemas are still migrated. the failures are reported as *MultiSchemaError, the returned map
+// contains the schemas that succeed.
+func (m *Migration) RunInSchemas(target string, schemas []string) (map[string][]string, error) {
+	ret := make(map[string][]string)
+	failures := make(map[string]error)
+	for _, schema := range schemas {
+		var list []string
+		s, err := m.inSchema(schema)
+		if err == nil {
+			list, err = s.Run(target)
+		}
+		if err != nil {
+			failures[schema] = err
+			if !m.opts.RunInSchemasContinueOnError {
+				break
+			}
+			continue
+		}
+		ret[schema] = list
+	}
+	if len(failures) > 0 {
+		return ret, &MultiSchemaError{Failures: failures}
+	}
+	return ret, nil
+}
+
+// inSchema return copy of m that tracked and executed in schema.
+func (m *Migration) inSchema(schema string) (*Migration, error) {
+	if !isSafeIdent(schema, maxIdentLen) {
+		return nil, &InvalidMetaNameError{Name: schema, Max: maxIdentLen}
+	}
+	ret := *m
+	ret.opts.metaSchema = schema
+	ret.opts.metaTable = schemaMetaTable
+	if m.opts.SearchPath != "" {
+		ret.opts.SearchPath = schema + "," + m.opts.SearchPath
+	} else {
+		ret.opts.SearchPath = schema
+	}
+	return &ret, nil
+}
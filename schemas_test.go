@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInSchema(t *testing.T) {
+	m := New(testSource(), func(o *Options) { o.SearchPath = "public" })
+	s, err := m.inSchema("tenant_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident := s.opts.metaIdent(); ident != `"tenant_a"."go_migration_meta"` {
+		t.Fatalf("invalid meta table %s", ident)
+	}
+	if s.opts.SearchPath != "tenant_a,public" {
+		t.Fatalf("invalid search path %s", s.opts.SearchPath)
+	}
+	if ident := m.opts.metaIdent(); ident != `"go_migration"."meta"` {
+		t.Fatalf("original migration should not be modified, got %s", ident)
+	}
+
+	for _, schema := range []string{"Tenant", "tenant;drop", strings.Repeat("a", maxIdentLen+1)} {
+		if _, err := m.inSchema(schema); !errors.As(err, new(*InvalidMetaNameError)) {
+			t.Fatalf("should return InvalidMetaNameError for %q, got %v", schema, err)
+		}
+	}
+}
+
+func TestRunInSchemas(t *testing.T) {
+	target := testTarget(t)
+	schemas := []string{"test_tenant_a", "test_tenant_b", "test_tenant_c"}
+
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	for _, s := range schemas {
+		if _, err := conn.Exec(bgCtx, `drop schema if exists `+quoteIdent(s)+` cascade`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Exec(bgCtx, `create schema test_tenant_b; create table test_tenant_b.users()`); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(testSource(
+		"0001_a.sql", "create table users(id int)",
+		"0002_b.sql", "alter table users add column name text",
+	), func(o *Options) { o.RunInSchemasContinueOnError = true })
+
+	ret, err := m.RunInSchemas(target, schemas)
+	var multi *MultiSchemaError
+	if !errors.As(err, &multi) || len(multi.Failures) != 1 || multi.Failures["test_tenant_b"] == nil {
+		t.Fatalf("should fail only in test_tenant_b, got %v", err)
+	}
+	want := map[string][]string{
+		"test_tenant_a": {"0001_a.sql", "0002_b.sql"},
+		"test_tenant_c": {"0001_a.sql", "0002_b.sql"},
+	}
+	if !reflect.DeepEqual(ret, want) {
+		t.Fatalf("invalid result %v", ret)
+	}
+
+	if _, err := conn.Exec(bgCtx, `drop table test_tenant_b.users`); err != nil {
+		t.Fatal(err)
+	}
+	ret, err = m.RunInSchemas(target, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{
+		"test_tenant_a": nil,
+		"test_tenant_b": {"0001_a.sql", "0002_b.sql"},
+		"test_tenant_c": nil,
+	}
+	if !reflect.DeepEqual(ret, want) {
+		t.Fatalf("invalid result %v", ret)
+	}
+}
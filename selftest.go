@@ -0,0 +1,31 @@
+package migration
+
+// selfTestRounds is how many times each migration is re-hashed by SelfTest.
+const selfTestRounds = 3
+
+// SelfTest re-normalize and re-hash every migration several times and check that the result is always
+// the same as the hash computed by New, returning *NondeterministicHashError otherwise.
+//
+// it guard against nondeterminism in the normalizer, which would make Run fail with *MismatchHashError
+// randomly, it is meant to be called in tests or CI.
+func (m *Migration) SelfTest() error {
+	return m.selfTest(func(e *entry) (string, string) {
+		n := m.opts.normalizerFor(e)
+		return n.normalize(e.statement), m.opts.entryHash(e)
+	})
+}
+
+// selfTest check that f, which return the normalized text and the hash of e, is deterministic.
+func (m *Migration) selfTest(f func(e *entry) (normalized, hash string)) error {
+	for i := range m.entries {
+		e := &m.entries[i]
+		firstNormalized, _ := f(e)
+		for round := 0; round < selfTestRounds; round++ {
+			normalized, hash := f(e)
+			if normalized != firstNormalized || hash != e.hash {
+				return &NondeterministicHashError{ID: e.id}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package migration
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "CREATE TABLE test.a(id int); -- comment",
+		"0002_b.sql", "-- psql-migration:unordered-grants\ngrant select on test.a to b; grant select on test.a to a;",
+		"0003_c.sql", "create function test.f() returns text language sql as $$ select 'A  b' $$",
+	))
+	if err := m.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	err := m.selfTest(func(e *entry) (string, string) {
+		calls++
+		n := normalizer{}.normalize(e.statement) + strconv.Itoa(calls)
+		return n, e.hash
+	})
+	var nondeterministic *NondeterministicHashError
+	if !errors.As(err, &nondeterministic) || nondeterministic.ID != "0001_a.sql" {
+		t.Fatalf("should return NondeterministicHashError, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package migration
+
+import "github.com/jackc/pgx/v4"
+
+// Session hold one connection to the target database, so Check and Run called through it share the
+// same connection instead of connecting for each call, see Open.
+type Session struct {
+	m    *Migration
+	conn *pgx.Conn
+}
+
+// Open connect to target and create the meta table if needed (see Options.AutoCreateMeta),
+// the returned Session must be closed by the caller.
+func (m *Migration) Open(target string) (*Session, error) {
+	conn, err := m.opts.setupConn(bgCtx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{m: m, conn: conn}, nil
+}
+
+// Check is like (*Migration).Check, but on the session connection, Options.ReadTarget is not used.
+func (s *Session) Check() ([]string, error) {
+	return s.m.check(bgCtx, s.conn)
+}
+
+// Run is like (*Migration).Run, but on the session connection, with the same limitation as RunConn.
+func (s *Session) Run() ([]string, error) {
+	return s.m.RunConn(bgCtx, s.conn)
+}
+
+// Close the session connection.
+func (s *Session) Close() error {
+	return s.conn.Close(bgCtx)
+}
@@ -0,0 +1,39 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.pids(pid int)",
+		"0002_b.sql", "insert into test.pids select pg_backend_pid()",
+	))
+
+	sess, err := m.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	pid := sess.conn.PgConn().PID()
+
+	if list, err := sess.Check(); err != nil || !reflect.DeepEqual(list, []string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("invalid pending list %v, %v", list, err)
+	}
+	if list, err := sess.Run(); err != nil || len(list) != 2 {
+		t.Fatalf("should execute all migrations, got %v, %v", list, err)
+	}
+	if list, err := sess.Check(); err != nil || len(list) != 0 {
+		t.Fatalf("nothing should be pending, got %v, %v", list, err)
+	}
+
+	var migrationPID uint32
+	if err := sess.conn.QueryRow(bgCtx, `select pid from test.pids`).Scan(&migrationPID); err != nil {
+		t.Fatal(err)
+	}
+	if migrationPID != pid || sess.conn.PgConn().PID() != pid {
+		t.Fatalf("run should use the session connection, got backend %d, want %d", migrationPID, pid)
+	}
+}
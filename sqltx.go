@@ -0,0 +1,185 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RunSQLTx is like Run, but execute the pending migrations inside tx, the caller's database/sql transaction,
+// so it works with any postgres driver for database/sql.
+//
+// RunSQLTx never commit or rollback tx, the migrations are only persisted when the caller commit it.
+// tx should be started with sql.LevelSerializable, the same isolation used by Run. The meta table is
+// created if not exists (see Options.AutoCreateMeta) and locked inside tx, so concurrent migrations
+// are still serialized, but the lock is held until the caller end tx. Options.ProcessLockKey and
+// Options.AdvisoryLock are taken with pg_advisory_xact_lock, released when tx end.
+//
+// each migration is executed after "reset all", so "set local" done by the caller before calling RunSQLTx
+// doesn't affect the migrations and is lost afterward. nested transaction inside the migration
+// is not detected, because database/sql doesn't expose the server notices.
+//
+// migration with no-transaction directive cannot be executed inside tx, *NoTxUnsupportedError is returned
+// when one of them is pending. like Run, *DirtyMigrationError is returned when one of them was left dirty.
+func (m *Migration) RunSQLTx(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	if key := m.opts.ProcessLockKey; key != 0 {
+		if _, err := tx.ExecContext(ctx, `select pg_advisory_xact_lock($1)`, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.opts.AutoCreateMeta {
+		if _, err := tx.ExecContext(ctx, m.opts.metaDDL()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.lockSQLTx(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	var chain string
+	var lastID, lastHash, lastPrevHash string
+	switch err := tx.QueryRowContext(ctx, m.opts.lastChainLinkSQL()).Scan(&lastID, &lastHash, &lastPrevHash); {
+	case err == nil:
+		chain = chainLink(lastPrevHash, lastID, lastHash)
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	var serverVersion string
+	if err := tx.QueryRowContext(ctx, `select version()`).Scan(&serverVersion); err != nil {
+		return nil, err
+	}
+
+	if err := m.opts.checkDirtySQLTx(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := m.enforceAppIDSQLTx(ctx, tx); err != nil {
+		return nil, err
+	}
+	inDB, err := m.opts.querySQLTxMeta(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := m.pending(inDB)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkPendingLimit(list); err != nil {
+		return nil, err
+	}
+	for _, l := range list {
+		if e := m.entries[m.revEntries[l]]; e.noTx {
+			return nil, &NoTxUnsupportedError{ID: e.id}
+		}
+	}
+	for _, e := range m.drifted(inDB) {
+		if _, err := tx.ExecContext(ctx, m.opts.repairSQL(), m.opts.recordArgs(e)...); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, l := range list {
+		if i > 0 && m.opts.DelayBetween > 0 {
+			if err := sleep(ctx, m.opts.DelayBetween); err != nil {
+				return nil, err
+			}
+		}
+		e := m.entries[m.revEntries[l]]
+
+		if m.opts.BeforeEach != nil {
+			m.opts.BeforeEach(e.id)
+		}
+		start := time.Now()
+		res, err := tx.ExecContext(ctx, m.opts.statementPrefix()+e.statement)
+		d := time.Since(start)
+		if m.opts.AfterEach != nil {
+			m.opts.AfterEach(e.id, d, err)
+		}
+		if err != nil {
+			return nil, m.opts.execError(e.id, 0, err)
+		}
+		m.metrics.observeDuration(d)
+		got, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if err := e.checkRowCount(got); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, m.opts.recordSQL(e), m.opts.insertArgs(e, chain, serverVersion, &d)...); err != nil {
+			return nil, err
+		}
+		chain = chainLink(chain, e.id, e.hash)
+	}
+
+	m.metrics.addApplied(len(list))
+	m.metrics.setPending(0)
+
+	return list, nil
+}
+
+// lockSQLTx lock the meta table, or take the advisory lock with Options.AdvisoryLock, inside tx.
+func (m *Migration) lockSQLTx(ctx context.Context, tx *sql.Tx) error {
+	if !m.opts.AdvisoryLock {
+		nowait := ""
+		if m.opts.NoWait {
+			nowait = " nowait"
+		}
+		_, err := tx.ExecContext(ctx, `lock table `+m.opts.lockIdent()+` in access exclusive mode`+nowait)
+		return err
+	}
+
+	key := m.opts.advisoryLockKey()
+	if !m.opts.NoWait {
+		_, err := tx.ExecContext(ctx, `select pg_advisory_xact_lock($1)`, key)
+		return err
+	}
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `select pg_try_advisory_xact_lock($1)`, key).Scan(&locked); err != nil || locked {
+		return err
+	}
+	return &LockHeldError{}
+}
+
+// checkDirtySQLTx is like checkDirty, but inside tx.
+func (o *Options) checkDirtySQLTx(ctx context.Context, tx *sql.Tx) error {
+	var hasDirty bool
+	if err := tx.QueryRowContext(ctx, hasColumnSQL, o.metaIdent(), "dirty").Scan(&hasDirty); err != nil || !hasDirty {
+		return err
+	}
+	var id string
+	err := tx.QueryRowContext(ctx, o.firstDirtySQL()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &DirtyMigrationError{ID: id}
+}
+
+func (o *Options) querySQLTxMeta(ctx context.Context, tx *sql.Tx) ([]Item, error) {
+	rows, err := tx.QueryContext(ctx, `select id, hash from `+o.metaIdent())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []Item
+	for rows.Next() {
+		var it Item
+		if err := rows.Scan(&it.ID, &it.Hash); err != nil {
+			return nil, err
+		}
+		ret = append(ret, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,60 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func TestRunSQLTx(t *testing.T) {
+	target := testTarget(t)
+	ctx := context.Background()
+
+	db, err := sql.Open("pgx", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	))
+
+	runInTx := func(commit bool) []string {
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		list, err := m.RunSQLTx(ctx, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit {
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return list
+	}
+
+	want := []string{"0001_a.sql", "0002_b.sql"}
+	if list := runInTx(false); !reflect.DeepEqual(list, want) {
+		t.Fatalf("invalid executed list %v", list)
+	}
+	if list := runInTx(true); !reflect.DeepEqual(list, want) {
+		t.Fatalf("rolled back tx should not persist the migrations, got %v", list)
+	}
+	if list := runInTx(true); len(list) != 0 {
+		t.Fatalf("should not execute anything, got %v", list)
+	}
+
+	if err := m.AssertUpToDate(target); err != nil {
+		t.Fatal(err)
+	}
+}
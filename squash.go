@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Squash return new Migration where migrations up to and including upToID are replaced by a single
+// baseline migration, to speed up bootstrapping fresh database.
+//
+// the baseline migration is the concatenation of the squashed statements, its id is upToID
+// with ".baseline.sql" suffix instead of ".sql", so it is sorted at the same place.
+//
+// database that already execute the squashed migrations is still recognized: the baseline is considered
+// executed when all squashed migrations are recorded in the database with matching hash.
+// will return *IncompleteSquashError from Check and Run if only some of them are recorded.
+// once the baseline is executed or recognized, Run and EnsureApplied persist the mapping from the squashed ids
+// to the baseline id in the "squash" table next to the meta table, so the database itself record which
+// baseline replaced its old ids.
+//
+// the baseline is executed in single transaction, so migration with no-transaction directive cannot be squashed,
+// *NoTxUnsupportedError is returned. pause directive of the squashed migrations make Run pause after the baseline.
+func (m *Migration) Squash(upToID string) (*Migration, error) {
+	upTo, ok := m.revEntries[upToID]
+	if !ok {
+		return nil, &UnknownMigrationError{ID: upToID}
+	}
+
+	var stmt strings.Builder
+	var replaces []entry
+	var pause bool
+	for _, e := range m.entries[:upTo+1] {
+		if len(e.replaces) > 0 {
+			return nil, &SourceError{Name: e.id, Err: errors.New("cannot squash already squashed migration")}
+		}
+		if e.noTx {
+			return nil, &NoTxUnsupportedError{ID: e.id}
+		}
+		pause = pause || e.pause
+		fmt.Fprintf(&stmt, "-- squashed from %s\n%s\n;\n\n", e.id, e.statement)
+		replaces = append(replaces, e)
+	}
+	baseline := entry{
+		id:        strings.TrimSuffix(upToID, ".sql") + ".baseline.sql",
+		statement: stmt.String(),
+		replaces:  replaces,
+		pause:     pause,
+	}
+	baseline.hash = m.opts.normalizer().hash(baseline.statement)
+
+	ret := &Migration{
+		entries:    append([]entry{baseline}, m.entries[upTo+1:]...),
+		revEntries: make(map[string]int),
+		replacedBy: make(map[string]int),
+		opts:       m.opts,
+		metrics:    m.metrics,
+	}
+	for i, e := range ret.entries {
+		if _, ok := ret.revEntries[e.id]; ok {
+			return nil, &SourceError{Name: e.id, Err: errors.New("duplicate entry")}
+		}
+		ret.revEntries[e.id] = i
+	}
+	for _, r := range replaces {
+		ret.replacedBy[r.id] = 0
+	}
+
+	return ret, nil
+}
+
+// recordSquash persist the mapping from the migrations replaced by baseline e to e, see Squash.
+// it is no-op for the mapping that is already recorded.
+func (r *runner) recordSquash(e entry) error {
+	ids := make([]string, len(e.replaces))
+	for i, replaced := range e.replaces {
+		ids[i] = replaced.id
+	}
+	_, err := r.conn.Exec(r.ctx, ``+
+		`insert into `+r.m.opts.squashIdent()+`(id, baseline) select unnest($1::text[]), $2 `+
+		`on conflict (id) do nothing`,
+		ids, e.id,
+	)
+	return err
+}
+
+// checkReplaced check that squashed migration it, that is recorded in the database, is the one replaced by e.
+// like the other migrations, the hash recorded by older version is accepted too.
+func (e *entry) checkReplaced(it Item) error {
+	for _, r := range e.replaces {
+		if r.id == it.ID && !r.hashMatches(it.Hash) {
+			return &MismatchHashError{Item: Item{ID: r.id, Hash: r.hash}, HashInDB: it.Hash}
+		}
+	}
+	return nil
+}
+
+// checkSquashedComplete check that all migrations replaced by e are recorded in the database.
+func (e *entry) checkSquashedComplete(inDB map[string]struct{}) error {
+	var missing []string
+	for _, r := range e.replaces {
+		if _, ok := inDB[r.id]; !ok {
+			missing = append(missing, r.id)
+		}
+	}
+	if len(missing) > 0 {
+		return &IncompleteSquashError{ID: e.id, Missing: missing}
+	}
+	return nil
+}
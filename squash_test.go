@@ -0,0 +1,171 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSquash(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+	legacy := func(ids ...string) []Item {
+		var ret []Item
+		for _, id := range ids {
+			ret = append(ret, Item{ID: id, Hash: m.entries[m.revEntries[id]].hash})
+		}
+		return ret
+	}
+
+	s, err := m.Squash("0002_b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, it := range s.All() {
+		ids = append(ids, it.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"0002_b.baseline.sql", "0003_c.sql"}) {
+		t.Fatalf("invalid squashed entries %v", ids)
+	}
+
+	t.Run("it should apply baseline to fresh database", func(t *testing.T) {
+		list, err := s.pending(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(list, []string{"0002_b.baseline.sql", "0003_c.sql"}) {
+			t.Fatalf("invalid pending %v", list)
+		}
+	})
+
+	t.Run("it should recognize legacy database", func(t *testing.T) {
+		list, err := s.pending(legacy("0001_a.sql", "0002_b.sql"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+			t.Fatalf("invalid pending %v", list)
+		}
+	})
+
+	t.Run("it should recognize database bootstrapped from baseline", func(t *testing.T) {
+		list, err := s.pending([]Item{{ID: "0002_b.baseline.sql", Hash: s.entries[0].hash}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+			t.Fatalf("invalid pending %v", list)
+		}
+	})
+
+	t.Run("it should reject partially migrated legacy database", func(t *testing.T) {
+		_, err := s.pending(legacy("0001_a.sql"))
+		var incomplete *IncompleteSquashError
+		if !errors.As(err, &incomplete) || !reflect.DeepEqual(incomplete.Missing, []string{"0002_b.sql"}) {
+			t.Fatalf("should return IncompleteSquashError, got %v", err)
+		}
+	})
+
+	t.Run("it should detect changed legacy migration", func(t *testing.T) {
+		_, err := s.pending([]Item{{ID: "0001_a.sql", Hash: "x"}, {ID: "0002_b.sql", Hash: "y"}})
+		var mismatch *MismatchHashError
+		if !errors.As(err, &mismatch) || mismatch.ID != "0001_a.sql" {
+			t.Fatalf("should return MismatchHashError, got %v", err)
+		}
+	})
+
+	t.Run("it should accept legacy hash of the replaced migration", func(t *testing.T) {
+		legacy := m.entries[0]
+		legacy.legacyHash = "old"
+		b := entry{id: "0001_a.baseline.sql", replaces: []entry{legacy}}
+		if err := b.checkReplaced(Item{ID: "0001_a.sql", Hash: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.checkReplaced(Item{ID: "0001_a.sql", Hash: "other"}); !errors.As(err, new(*MismatchHashError)) {
+			t.Fatalf("should return MismatchHashError, got %v", err)
+		}
+	})
+
+	noTx := New(testSource(
+		"0001_a.sql", "create table test.a(id int)",
+		"0002_b.sql", "-- psql-migration:no-transaction\ncreate index concurrently a_idx on test.a(id)",
+	))
+	if _, err := noTx.Squash("0002_b.sql"); !errors.As(err, new(*NoTxUnsupportedError)) {
+		t.Fatalf("should return NoTxUnsupportedError, got %v", err)
+	}
+	paused, err := New(testSource(
+		"0001_a.sql", "-- psql-migration:pause\nselect 1",
+		"0002_b.sql", "select 2",
+	)).Squash("0002_b.sql")
+	if err != nil || !paused.entries[0].pause {
+		t.Fatalf("pause directive should be carried to the baseline, got %v", err)
+	}
+
+	if _, err := m.Squash("9999_unknown.sql"); !errors.As(err, new(*UnknownMigrationError)) {
+		t.Fatalf("should return UnknownMigrationError, got %v", err)
+	}
+}
+
+func TestSquashMapping(t *testing.T) {
+	source := testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	)
+	s, err := New(source).Squash("0002_b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := func(t *testing.T, target string) map[string]string {
+		conn, err := new(Options).connect(bgCtx, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close(bgCtx)
+		rows, err := conn.Query(bgCtx, `select id, baseline from `+s.opts.squashIdent())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		ret := make(map[string]string)
+		for rows.Next() {
+			var id, baseline string
+			if err := rows.Scan(&id, &baseline); err != nil {
+				t.Fatal(err)
+			}
+			ret[id] = baseline
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	expected := map[string]string{"0001_a.sql": "0002_b.baseline.sql", "0002_b.sql": "0002_b.baseline.sql"}
+
+	t.Run("fresh database", func(t *testing.T) {
+		target := testTarget(t)
+		if _, err := s.Run(target); err != nil {
+			t.Fatal(err)
+		}
+		if got := mapping(t, target); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("invalid mapping %v", got)
+		}
+	})
+
+	t.Run("legacy database", func(t *testing.T) {
+		target := testTarget(t)
+		if _, err := New(source).RunTo(target, "0002_b.sql"); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := s.Run(target); err != nil || !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+			t.Fatalf("only the newer migration should be executed, got %v, %v", list, err)
+		}
+		if got := mapping(t, target); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("invalid mapping %v", got)
+		}
+	})
+}
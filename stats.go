@@ -0,0 +1,31 @@
+package migration
+
+// Stats of the migration source.
+type Stats struct {
+	// Entries is the number of migrations
+	Entries int
+
+	// Bytes is the total size of the migration statements
+	Bytes int
+
+	// Statements is the total number of top-level sql statements
+	Statements int
+
+	// EntryStatements is the number of top-level sql statements of each migration
+	EntryStatements map[string]int
+}
+
+// Stats return size information about the migrations, down migrations are not counted.
+func (m *Migration) Stats() Stats {
+	s := Stats{
+		Entries:         len(m.entries),
+		EntryStatements: make(map[string]int, len(m.entries)),
+	}
+	for _, e := range m.entries {
+		n := len(statements(scan(e.statement)))
+		s.Bytes += len(e.statement)
+		s.Statements += n
+		s.EntryStatements[e.id] = n
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table a(); create table b();",
+		"0001_a.down.sql", "drop table b; drop table a;",
+		"0002_b.sql", "-- only comment; really",
+		"0003_c.sql", "create function f() returns int as $$ select 1; $$ language sql",
+	))
+
+	want := Stats{
+		Entries:    3,
+		Bytes:      35 + 23 + 63,
+		Statements: 3,
+		EntryStatements: map[string]int{
+			"0001_a.sql": 2,
+			"0002_b.sql": 0,
+			"0003_c.sql": 1,
+		},
+	}
+	if s := m.Stats(); !reflect.DeepEqual(s, want) {
+		t.Fatalf("invalid stats %#v", s)
+	}
+}
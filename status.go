@@ -0,0 +1,93 @@
+package migration
+
+import "time"
+
+// MigrationStatus is the state of a migration in the target database, see Status.
+type MigrationStatus struct {
+	ID string
+
+	// Hash in the source, or in the database if the migration is not in the source
+	Hash string
+
+	// InSource is false for migration executed in the database but not found in the source,
+	// e.g. the file is deleted
+	InSource bool
+
+	Applied   bool
+	AppliedAt time.Time // zero if not applied
+
+	// HashMatches report whether the hash in the database is the same as in the source,
+	// it is false if the migration is not applied or not in the source
+	HashMatches bool
+
+	// Dirty report whether the migration was started outside transaction but never finished,
+	// see *DirtyMigrationError
+	Dirty bool
+}
+
+// Status return the state of every migration in the source, in order, followed by the migrations
+// executed in the database but not found in the source, in the order they were executed.
+// migrations squashed by Squash are reported through their baseline, like Check.
+//
+// unlike Check, it doesn't fail on *MismatchHashError or other inconsistency, it report them instead.
+// Status never modify the database, so it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) Status(target string) ([]MigrationStatus, error) {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(bgCtx)
+
+	applied, err := m.opts.queryApplied(bgCtx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return m.status(applied), nil
+}
+
+func (m *Migration) status(applied []appliedRow) []MigrationStatus {
+	inDB := make(map[string]appliedRow, len(applied))
+	for _, r := range applied {
+		inDB[r.id] = r
+	}
+
+	ret := make([]MigrationStatus, 0, len(m.entries))
+	for _, e := range m.entries {
+		s := MigrationStatus{ID: e.id, Hash: e.hash, InSource: true}
+		if r, ok := inDB[e.id]; ok {
+			s.Applied = true
+			s.AppliedAt = r.at
+			s.HashMatches = e.hashMatches(r.hash)
+			s.Dirty = r.dirty
+		} else if len(e.replaces) > 0 {
+			squashedStatus(&s, e, inDB)
+		}
+		ret = append(ret, s)
+	}
+	for _, r := range applied {
+		_, ok := m.revEntries[r.id]
+		if _, squashed := m.replacedBy[r.id]; !ok && !squashed {
+			ret = append(ret, MigrationStatus{ID: r.id, Hash: r.hash, Applied: true, AppliedAt: r.at, Dirty: r.dirty})
+		}
+	}
+	return ret
+}
+
+// squashedStatus fill s, the status of baseline e, from the migrations it replaces, like Check, it is applied
+// when all of them are recorded in the database, at the time the last one was recorded.
+func squashedStatus(s *MigrationStatus, e entry, inDB map[string]appliedRow) {
+	s.HashMatches = true
+	for _, replaced := range e.replaces {
+		r, ok := inDB[replaced.id]
+		if !ok {
+			*s = MigrationStatus{ID: s.ID, Hash: s.Hash, InSource: true}
+			return
+		}
+		if r.at.After(s.AppliedAt) {
+			s.AppliedAt = r.at
+		}
+		s.HashMatches = s.HashMatches && replaced.hashMatches(r.hash)
+		s.Dirty = s.Dirty || r.dirty
+	}
+	s.Applied = true
+}
@@ -0,0 +1,112 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+	t1 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	got := m.status([]appliedRow{
+		{"0001_a.sql", hash("create table test.a()"), t1, false, 0},
+		{"0000_deleted.sql", "xxx", t2, false, 0},
+		{"0002_b.sql", "changed", t3, true, 0},
+	})
+	expected := []MigrationStatus{
+		{ID: "0001_a.sql", Hash: hash("create table test.a()"), InSource: true, Applied: true, AppliedAt: t1, HashMatches: true},
+		{ID: "0002_b.sql", Hash: hash("create table test.b()"), InSource: true, Applied: true, AppliedAt: t3, Dirty: true},
+		{ID: "0003_c.sql", Hash: hash("create table test.c()"), InSource: true},
+		{ID: "0000_deleted.sql", Hash: "xxx", Applied: true, AppliedAt: t2},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("invalid status:\n%v", got)
+	}
+}
+
+func TestStatusDB(t *testing.T) {
+	target := testTarget(t)
+
+	if _, err := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	)).Run(target); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0003_c.sql", "create table test.c()",
+	)).Status(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("invalid status: %v", list)
+	}
+	if s := list[0]; s.ID != "0001_a.sql" || !s.Applied || !s.HashMatches || s.AppliedAt.IsZero() {
+		t.Fatalf("0001_a.sql should be applied: %v", s)
+	}
+	if s := list[1]; s.ID != "0003_c.sql" || s.Applied {
+		t.Fatalf("0003_c.sql should be pending: %v", s)
+	}
+	if s := list[2]; s.ID != "0002_b.sql" || s.InSource || !s.Applied {
+		t.Fatalf("0002_b.sql should be reported as not in source: %v", s)
+	}
+}
+
+func TestStatusSquashed(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+	s, err := m.Squash("0002_b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	got := s.status([]appliedRow{
+		{"0001_a.sql", hash("create table test.a()"), t1, false, 0},
+		{"0002_b.sql", hash("create table test.b()"), t2, false, 0},
+	})
+	expected := []MigrationStatus{
+		{ID: "0002_b.baseline.sql", Hash: s.entries[0].hash, InSource: true, Applied: true, AppliedAt: t2, HashMatches: true},
+		{ID: "0003_c.sql", Hash: hash("create table test.c()"), InSource: true},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("invalid status:\n%v", got)
+	}
+
+	got = s.status([]appliedRow{{"0001_a.sql", hash("create table test.a()"), t1, false, 0}})
+	if len(got) != 2 || got[0].Applied {
+		t.Fatalf("partially applied baseline should not be applied:\n%v", got)
+	}
+}
+
+func TestStatusBaselineMeta(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+	))
+	createOldMeta(t, target, &m.opts, `id text primary key, hash text, at timestamp with time zone default now()`)
+
+	list, err := m.Status(target)
+	if err != nil {
+		t.Fatalf("Status should work against meta table without dirty column: %v", err)
+	}
+	if len(list) != 2 || !list[0].Applied || list[0].Dirty || list[1].Applied {
+		t.Fatalf("invalid status:\n%v", list)
+	}
+}
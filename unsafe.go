@@ -2,26 +2,60 @@ package migration
 
 import "fmt"
 
-func (m *Migration) UnsafeMarkAsExecued(target string, id string) error {
-	eIdx, ok := m.revEntries[id]
-	if !ok {
+// UnsafeMarkAsExecuted record migration id as executed with its current hash, without executing it,
+// or replace its hash if it is already recorded, and clear its dirty flag. it panic if id is not found in the source.
+//
+// it is unsafe because the database is trusted to already have the changes of the migration.
+func (m *Migration) UnsafeMarkAsExecuted(target string, id string) error {
+	if _, ok := m.revEntries[id]; !ok {
 		panic(fmt.Sprintf("migration: entry not found; %s", id))
 	}
-	entry := m.entries[eIdx]
+	return m.UnsafeMarkAsExecutedMany(target, []string{id})
+}
+
+// UnsafeMarkAsExecued is the old misspelled name of UnsafeMarkAsExecuted.
+//
+// Deprecated: use UnsafeMarkAsExecuted.
+func (m *Migration) UnsafeMarkAsExecued(target string, id string) error {
+	return m.UnsafeMarkAsExecuted(target, id)
+}
 
-	conn, err := setupConn(target, nil)
+// UnsafeMarkAsExecutedMany is like UnsafeMarkAsExecuted for all ids, in single transaction, so either all or none
+// of them are recorded. will return *UnknownMigrationError if some id is not found in the source,
+// or *InvalidAppIDError like Run.
+func (m *Migration) UnsafeMarkAsExecutedMany(target string, ids []string) error {
+	list := make([]entry, len(ids))
+	for i, id := range ids {
+		j, ok := m.revEntries[id]
+		if !ok {
+			return &UnknownMigrationError{ID: id}
+		}
+		list[i] = m.entries[j]
+	}
+
+	conn, err := m.opts.setupConn(bgCtx, target, nil)
 	if err != nil {
 		return err
 	}
 	defer conn.Close(bgCtx)
 
-	if _, err := conn.Exec(bgCtx, ``+
-		`insert into go_migration.meta(id, hash) values ($1, $2) `+
-		`on conflict (id) do update set hash = excluded.hash`,
-		entry.id, entry.hash,
-	); err != nil {
+	if _, err := conn.Exec(bgCtx, `begin`); err != nil {
 		return err
 	}
-
-	return nil
+	if err := m.enforceAppID(bgCtx, conn); err != nil {
+		conn.Exec(bgCtx, `rollback`)
+		return err
+	}
+	for _, e := range list {
+		if _, err := conn.Exec(bgCtx, ``+
+			`insert into `+m.opts.metaIdent()+`(id, hash) values ($1, $2) `+
+			`on conflict (id) do update set hash = excluded.hash, dirty = false`,
+			e.id, e.hash,
+		); err != nil {
+			conn.Exec(bgCtx, `rollback`)
+			return err
+		}
+	}
+	_, err = conn.Exec(bgCtx, `commit`)
+	return err
 }
@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnsafeMarkAsExecutedMany(t *testing.T) {
+	target := testTarget(t)
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"0003_c.sql", "create table test.c()",
+	))
+
+	var unknown *UnknownMigrationError
+	if err := m.UnsafeMarkAsExecutedMany(target, []string{"0001_a.sql", "0009_x.sql"}); !errors.As(err, &unknown) || unknown.ID != "0009_x.sql" {
+		t.Fatalf("should return UnknownMigrationError, got %v", err)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 3 {
+		t.Fatalf("nothing should be marked when some id is unknown, got %v, %v", list, err)
+	}
+
+	if err := m.UnsafeMarkAsExecutedMany(target, []string{"0001_a.sql", "0002_b.sql"}); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := m.Check(target); err != nil || !reflect.DeepEqual(list, []string{"0003_c.sql"}) {
+		t.Fatalf("marked migrations should not be pending, got %v, %v", list, err)
+	}
+
+	if err := m.UnsafeMarkAsExecued(target, "0003_c.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := m.Check(target); err != nil || len(list) != 0 {
+		t.Fatalf("deprecated alias should still work, got %v, %v", list, err)
+	}
+}
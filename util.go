@@ -2,6 +2,12 @@ package migration
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -10,6 +16,9 @@ import (
 type Item struct {
 	ID   string
 	Hash string
+
+	// Statement is the migration sql, only filled by Iterate
+	Statement string
 }
 
 func (m *Migration) All() []Item {
@@ -23,40 +32,338 @@ func (m *Migration) All() []Item {
 	return r
 }
 
+// Iterate call f for each migration in order, with its index and Item including the statement,
+// it stop when f return false.
+func (m *Migration) Iterate(f func(i int, it Item) bool) {
+	for i, e := range m.entries {
+		if !f(i, Item{ID: e.id, Hash: e.hash, Statement: e.statement}) {
+			return
+		}
+	}
+}
+
 var bgCtx = context.Background()
 
-func setupConn(target string, onNestedTx func()) (*pgx.Conn, error) {
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sleep for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+const (
+	defaultMetaSchema = "go_migration"
+	defaultMetaTable  = "meta"
+)
+
+// quoteIdent quote name so it can be safely interpolated as sql identifier.
+//
+// name can contains any character except NUL, quoteIdent will panic on empty name
+// or name that contains NUL, because postgres cannot represent them.
+func quoteIdent(name string) string {
+	if name == "" || strings.ContainsRune(name, 0) {
+		panic(fmt.Sprintf("migration: invalid identifier: %q", name))
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (o *Options) metaSchemaName() string {
+	if o.metaSchema != "" {
+		return o.metaSchema
+	}
+	return defaultMetaSchema
+}
+
+func (o *Options) metaTableName() string {
+	if o.metaTable != "" {
+		return o.metaTable
+	}
+	return defaultMetaTable
+}
+
+// metaIdent return the quoted name of the meta table.
+func (o *Options) metaIdent() string {
+	return quoteIdent(o.metaSchemaName()) + "." + quoteIdent(o.metaTableName())
+}
+
+// sideTableIdent return the quoted name of auxiliary table next to the meta table,
+// named suffix, or prefixed by the meta table name when it is configured by WithTable.
+func (o *Options) sideTableIdent(suffix string) string {
+	name := suffix
+	if o.metaTable != "" {
+		name = o.metaTable + "_" + suffix
+	}
+	return quoteIdent(o.metaSchemaName()) + "." + quoteIdent(name)
+}
+
+// lockTableIdent return the quoted name of the dedicated lock table, see Options.LockTable.
+func (o *Options) lockTableIdent() string {
+	return o.sideTableIdent("lock")
+}
+
+// schemaHashIdent return the quoted name of the table storing the schema hash, see Options.CaptureSchemaHash.
+func (o *Options) schemaHashIdent() string {
+	return o.sideTableIdent("schema_hash")
+}
+
+// appIDIdent return the quoted name of the table storing the app id of the database, see Options.AppID.
+func (o *Options) appIDIdent() string {
+	return o.sideTableIdent("app_id")
+}
+
+// runsIdent return the quoted name of the table storing the run history, see RunHistory.
+func (o *Options) runsIdent() string {
+	return o.sideTableIdent("runs")
+}
+
+// squashIdent return the quoted name of the table storing the ids replaced by the executed baselines, see Squash.
+func (o *Options) squashIdent() string {
+	return o.sideTableIdent("squash")
+}
+
+// maintenanceIdent return the quoted name of the table storing the maintenance flag, see Options.Maintenance.
+func (o *Options) maintenanceIdent() string {
+	return o.sideTableIdent("maintenance")
+}
+
+// lockIdent return the quoted name of the table locked by Run.
+func (o *Options) lockIdent() string {
+	if o.LockTable {
+		return o.lockTableIdent()
+	}
+	return o.metaIdent()
+}
+
+func (o *Options) connConfig(target string, onNotice func(n *pgconn.Notice)) (*pgx.ConnConfig, error) {
 	config, err := pgx.ParseConfig(target)
 	if err != nil {
 		return nil, err
 	}
-	if onNestedTx != nil {
-		config.OnNotice = func(pc *pgconn.PgConn, n *pgconn.Notice) {
-			if n.Code == "25001" {
-				onNestedTx()
+	if onNotice != nil {
+		config.OnNotice = func(pc *pgconn.PgConn, n *pgconn.Notice) { onNotice(n) }
+	}
+	if o.KeepAlive > 0 {
+		config.DialFunc = o.keepAliveDialer(config).DialContext
+		secs := strconv.Itoa(int(math.Max(1, o.KeepAlive.Seconds())))
+		for _, p := range []string{"tcp_keepalives_idle", "tcp_keepalives_interval"} {
+			if _, ok := config.RuntimeParams[p]; !ok {
+				config.RuntimeParams[p] = secs
 			}
 		}
 	}
+	return config, nil
+}
 
-	conn, err := pgx.ConnectConfig(bgCtx, config)
+// keepAliveDialer return the dialer with Options.KeepAlive, replacing the default dialer of config,
+// it keep the timeout of the default one, set by connect_timeout of the target.
+func (o *Options) keepAliveDialer(config *pgx.ConnConfig) *net.Dialer {
+	return &net.Dialer{KeepAlive: o.KeepAlive, Timeout: config.ConnectTimeout}
+}
+
+// connect to target without touching the schema, safe to be used against read-only replica.
+func (o *Options) connect(ctx context.Context, target string, onNotice func(n *pgconn.Notice)) (*pgx.Conn, error) {
+	config, err := o.connConfig(target, onNotice)
 	if err != nil {
 		return nil, err
 	}
-	connMoved := false
-	defer func() {
-		if !connMoved {
-			conn.Close(bgCtx)
-		}
-	}()
+	return pgx.ConnectConfig(ctx, config)
+}
 
-	if _, err := conn.Exec(bgCtx, ``+
-		`create schema if not exists go_migration;`+
-		`create table if not exists go_migration.meta`+
-		`(id text primary key, hash text, at timestamp with time zone default now())`,
-	); err != nil {
+// connectReadOnly is like connect, but every transaction in the connection is read-only,
+// so accidental write fail instead of silently modifying the database.
+func (o *Options) connectReadOnly(ctx context.Context, target string) (*pgx.Conn, error) {
+	config, err := o.connConfig(target, nil)
+	if err != nil {
 		return nil, err
 	}
+	config.RuntimeParams["default_transaction_read_only"] = "on"
+	return pgx.ConnectConfig(ctx, config)
+}
 
-	connMoved = true
+// setupConn connect to target and make sure the meta table exists, see ensureMeta.
+func (o *Options) setupConn(ctx context.Context, target string, onNotice func(n *pgconn.Notice)) (*pgx.Conn, error) {
+	conn, err := o.connect(ctx, target, onNotice)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.ensureMeta(ctx, conn); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
 	return conn, nil
 }
+
+// ensureMeta make sure the meta table exists, unless Options.AutoCreateMeta is false.
+func (o *Options) ensureMeta(ctx context.Context, conn *pgx.Conn) error {
+	if !o.AutoCreateMeta {
+		return nil
+	}
+	_, err := conn.Exec(ctx, o.metaDDL())
+	return err
+}
+
+// quoteLiteral quote s so it can be safely interpolated as sql string literal,
+// it assume standard_conforming_strings is on.
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
+
+// metaColumns is the columns added to the meta table after it was first introduced.
+var metaColumns = []struct{ name, typ string }{
+	{"normalized", "text"},
+	{"prev_hash", "text"},
+	{"server_version", "text"},
+	{"deployment_id", "text"},
+	{"dirty", "boolean not null default false"},
+	{"duration_ms", "bigint"},
+}
+
+// metaDDL create the meta table, the lock table, the schema hash table, the maintenance table,
+// the run history table, and the app id table if not exists,
+// and add the missing metaColumns.
+//
+// alter table take access exclusive lock even when the column already exists, which would wait behind
+// in-progress Run with Options.LockTable, so it is only executed when some column is missing.
+func (o *Options) metaDDL() string {
+	var names, adds []string
+	for _, c := range metaColumns {
+		names = append(names, quoteLiteral(c.name))
+		adds = append(adds, ` add column if not exists `+quoteIdent(c.name)+` `+c.typ)
+	}
+	return `` +
+		`create schema if not exists ` + quoteIdent(o.metaSchemaName()) + `;` +
+		`create table if not exists ` + o.metaIdent() +
+		`(id text primary key, hash text, at timestamp with time zone default now());` +
+		`do $psql_migration$ begin ` +
+		`if (select count(*) from pg_attribute where attrelid = ` + quoteLiteral(o.metaIdent()) + `::regclass ` +
+		`and attname in (` + strings.Join(names, ", ") + `) and not attisdropped) < ` + strconv.Itoa(len(metaColumns)) + ` then ` +
+		`alter table ` + o.metaIdent() + strings.Join(adds, ",") + `; ` +
+		`end if; end $psql_migration$;` +
+		`create table if not exists ` + o.lockTableIdent() + `();` +
+		`create table if not exists ` + o.schemaHashIdent() +
+		`(id int primary key default 1 check (id = 1), hash text not null, at timestamp with time zone default now());` +
+		`create table if not exists ` + o.maintenanceIdent() +
+		`(id int primary key default 1 check (id = 1), active boolean not null, at timestamp with time zone default now());` +
+		`create table if not exists ` + o.runsIdent() +
+		`(id bigserial primary key, source_version text, ids text[] not null, at timestamp with time zone default now());` +
+		`create table if not exists ` + o.squashIdent() +
+		`(id text primary key, baseline text not null, at timestamp with time zone default now());` +
+		`create table if not exists ` + o.appIDIdent() +
+		`(id int primary key default 1 check (id = 1), app_id text not null, at timestamp with time zone default now())`
+}
+
+// metaExists report whether the meta table already exists.
+func (o *Options) metaExists(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	var exists bool
+	err := conn.QueryRow(ctx, ``+
+		`select to_regclass($1) is not null`,
+		o.metaIdent(),
+	).Scan(&exists)
+	return exists, err
+}
+
+// queryMeta return all rows in the meta table, it return empty list if the meta table is not exists yet.
+func (o *Options) queryMeta(ctx context.Context, conn *pgx.Conn) ([]Item, error) {
+	if exists, err := o.metaExists(ctx, conn); err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, ``+
+		`select id, hash from `+o.metaIdent(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []Item
+	for rows.Next() {
+		var it Item
+		if err := rows.Scan(&it.ID, &it.Hash); err != nil {
+			return nil, err
+		}
+		ret = append(ret, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// appliedRow is a row in the meta table.
+type appliedRow struct {
+	id       string
+	hash     string
+	at       time.Time
+	dirty    bool
+	duration time.Duration // zero if unknown
+}
+
+// queryApplied return all rows in the meta table in the order they were executed,
+// it return empty list if the meta table is not exists yet.
+func (o *Options) queryApplied(ctx context.Context, conn *pgx.Conn) ([]appliedRow, error) {
+	if exists, err := o.metaExists(ctx, conn); err != nil || !exists {
+		return nil, err
+	}
+
+	// the meta table is not upgraded by the functions that never modify the database
+	dirty := `false`
+	if ok, err := o.metaHasColumn(ctx, conn, "dirty"); err != nil {
+		return nil, err
+	} else if ok {
+		dirty = `dirty`
+	}
+	duration := `0`
+	if ok, err := o.metaHasColumn(ctx, conn, "duration_ms"); err != nil {
+		return nil, err
+	} else if ok {
+		duration = `coalesce(duration_ms, 0)`
+	}
+
+	rows, err := conn.Query(ctx, ``+
+		`select id, hash, at, `+dirty+`, `+duration+` from `+o.metaIdent()+` order by at, id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []appliedRow
+	for rows.Next() {
+		var r appliedRow
+		var durationMS int64
+		if err := rows.Scan(&r.id, &r.hash, &r.at, &r.dirty, &durationMS); err != nil {
+			return nil, err
+		}
+		r.duration = time.Duration(durationMS) * time.Millisecond
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,180 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tc := []struct {
+		name, ident, quoted string
+	}{
+		{"it should quote plain name", "meta", `"meta"`},
+		{"it should preserve case", "Meta", `"Meta"`},
+		{"it should escape embedded quote", `me"ta`, `"me""ta"`},
+		{"it should escape injection attempt", `x"; drop table users; --`, `"x""; drop table users; --"`},
+		{"it should keep unicode", "tábla_名前", `"tábla_名前"`},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if q := quoteIdent(c.ident); q != c.quoted {
+				t.Fatalf("invalid quoted identifier %s %s", q, c.quoted)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentReject(t *testing.T) {
+	for _, ident := range []string{"", "me\x00ta"} {
+		t.Run(ident, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("quoteIdent should panic on %q", ident)
+				}
+			}()
+			quoteIdent(ident)
+		})
+	}
+}
+
+func TestSleep(t *testing.T) {
+	start := time.Now()
+	if err := sleep(bgCtx, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("sleep returned too early: %s", d)
+	}
+
+	ctx, cancel := context.WithCancel(bgCtx)
+	cancel()
+	start = time.Now()
+	if err := sleep(ctx, time.Hour); err != context.Canceled {
+		t.Fatalf("sleep should return context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("sleep should return immediately when cancelled: %s", d)
+	}
+}
+
+func TestConnConfigKeepAlive(t *testing.T) {
+	config, err := (&Options{KeepAlive: 30 * time.Second}).connConfig("host=localhost tcp_keepalives_interval=5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := config.RuntimeParams["tcp_keepalives_idle"]; v != "30" {
+		t.Fatalf("invalid tcp_keepalives_idle %q", v)
+	}
+	if v := config.RuntimeParams["tcp_keepalives_interval"]; v != "5" {
+		t.Fatalf("tcp_keepalives_interval from target should be kept, got %q", v)
+	}
+	if config.DialFunc == nil {
+		t.Fatalf("DialFunc should be set")
+	}
+
+	o := &Options{KeepAlive: 30 * time.Second}
+	config, err = o.connConfig("host=localhost connect_timeout=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := o.keepAliveDialer(config); d.Timeout != 3*time.Second || d.KeepAlive != 30*time.Second {
+		t.Fatalf("connect_timeout should be kept, got %v", d)
+	}
+
+	config, err = new(Options).connConfig("host=localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.RuntimeParams["tcp_keepalives_idle"]; ok {
+		t.Fatalf("tcp_keepalives_idle should not be set by default")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	m := New(testSource(
+		"0002_b.sql", "create table test.b()",
+		"0001_a.sql", "create table test.a()",
+		"0003_c.sql", "create table test.c()",
+	))
+
+	var visited []Item
+	m.Iterate(func(i int, it Item) bool {
+		if i != len(visited) {
+			t.Fatalf("invalid index %d", i)
+		}
+		visited = append(visited, it)
+		return true
+	})
+	want := []Item{
+		{ID: "0001_a.sql", Hash: hash("create table test.a()"), Statement: "create table test.a()"},
+		{ID: "0002_b.sql", Hash: hash("create table test.b()"), Statement: "create table test.b()"},
+		{ID: "0003_c.sql", Hash: hash("create table test.c()"), Statement: "create table test.c()"},
+	}
+	if !reflect.DeepEqual(visited, want) {
+		t.Fatalf("invalid visited items %v", visited)
+	}
+
+	var ids []string
+	m.Iterate(func(i int, it Item) bool {
+		ids = append(ids, it.ID)
+		return i < 1
+	})
+	if !reflect.DeepEqual(ids, []string{"0001_a.sql", "0002_b.sql"}) {
+		t.Fatalf("should stop when f return false, got %v", ids)
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	if q := quoteLiteral(`it's`); q != `'it''s'` {
+		t.Fatalf("invalid quoted literal %s", q)
+	}
+}
+
+func TestConnectReadOnly(t *testing.T) {
+	target := testTarget(t)
+
+	conn, err := new(Options).connectReadOnly(bgCtx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+
+	var pgErr *pgconn.PgError
+	if _, err := conn.Exec(bgCtx, `create table test.a()`); !errors.As(err, &pgErr) || pgErr.Code != "25006" {
+		t.Fatalf("write should fail with read_only_sql_transaction, got %v", err)
+	}
+	if _, err := conn.Exec(bgCtx, `begin; create table test.a(); commit`); !errors.As(err, &pgErr) || pgErr.Code != "25006" {
+		t.Fatalf("write in explicit transaction should fail too, got %v", err)
+	}
+	conn.Exec(bgCtx, `rollback`)
+
+	m := New(testSource("0001_a.sql", "create table test.a()"))
+	if list, err := m.Check(target); err != nil || len(list) != 1 {
+		t.Fatalf("Check should work with read-only connection, got %v, %v", list, err)
+	}
+	if err := Verify(target, nil); err != nil {
+		t.Fatalf("Verify should work with read-only connection, got %v", err)
+	}
+}
+
+// createOldMeta create the meta table with columns, like created by older version, with 0001_a.sql recorded.
+func createOldMeta(t *testing.T, target string, o *Options, columns string) {
+	conn, err := new(Options).connect(bgCtx, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(bgCtx)
+	if _, err := conn.Exec(bgCtx, ``+
+		`create schema if not exists `+quoteIdent(o.metaSchemaName())+`;`+
+		`create table `+o.metaIdent()+`(`+columns+`);`+
+		`insert into `+o.metaIdent()+`(id, hash) values ('0001_a.sql', `+quoteLiteral(hash("create table test.a()"))+`)`,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+package migration
+
+import "sort"
+
+// Verify that every migration executed in the target database has the same hash as expected.
+//
+// expected is map of migration id to its hash, as reported by (*Migration).All, so Verify can be
+// used by small binary that doesn't embed the migration source.
+//
+// will return *MismatchHashError if the hash is different, or *OrphanedMigrationError if the database
+// already execute migration that not in expected. Migration in expected that is not executed yet is not an error.
+//
+// Verify never modify the database, it connects with default_transaction_read_only. opts is usually WithSchema and WithTable, to locate the meta table.
+func Verify(target string, expected map[string]string, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	conn, err := o.connectReadOnly(bgCtx, target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	inDB, err := o.queryMeta(bgCtx, conn)
+	if err != nil {
+		return err
+	}
+
+	return verify(expected, inDB)
+}
+
+// Verify that every migration executed in the target database is in the source with the same hash,
+// without computing the pending migrations, e.g. for readiness probe that only care about consistency.
+//
+// will return *MismatchHashError if the hash is different, unless accepted by Options.OnDrift, or
+// *OrphanedMigrationError if the database already execute migration that not in the source,
+// unless accepted by Options.OnOrphan.
+// repeatable migration with different hash is not an error, it is just pending to be re-executed.
+//
+// it doesn't lock the meta table and never modify the database, so it is cheap enough to be called frequently,
+// and it can be pointed to read-only replica via Options.ReadTarget.
+func (m *Migration) Verify(target string) error {
+	conn, err := m.opts.connectReadOnly(bgCtx, m.opts.readTarget(target))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(bgCtx)
+
+	inDB, err := m.opts.queryMeta(bgCtx, conn)
+	if err != nil {
+		return err
+	}
+
+	return m.verify(inDB)
+}
+
+// verify is like the package-level verify, but against the source, taking legacy hash, squash, and repeatable migration into account.
+func (m *Migration) verify(inDB []Item) error {
+	sorted := append([]Item(nil), inDB...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	var orphans []Item
+	for _, it := range sorted {
+		i, ok := m.revEntries[it.ID]
+		if !ok {
+			if b, ok := m.replacedBy[it.ID]; ok {
+				if err := m.entries[b].checkReplaced(it); err != nil {
+					return err
+				}
+				continue
+			}
+			orphans = append(orphans, it)
+			continue
+		}
+		e := m.entries[i]
+		if e.hashMatches(it.Hash) || isRepeatable(e.id) {
+			continue
+		}
+		err := &MismatchHashError{Item: Item{ID: it.ID, Hash: e.hash}, HashInDB: it.Hash}
+		if m.opts.OnDrift == nil {
+			return err
+		}
+		if err := m.opts.OnDrift(err); err != nil {
+			return err
+		}
+	}
+	return m.opts.acceptOrphans(orphans)
+}
+
+// acceptOrphans return *OrphanedMigrationError for orphans, unless accepted by Options.OnOrphan.
+func (o *Options) acceptOrphans(orphans []Item) error {
+	if len(orphans) == 0 {
+		return nil
+	}
+	err := &OrphanedMigrationError{Orphans: orphans}
+	if o.OnOrphan == nil {
+		return err
+	}
+	return o.OnOrphan(err)
+}
+
+func verify(expected map[string]string, inDB []Item) error {
+	sorted := append([]Item(nil), inDB...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	var orphans []Item
+	for _, it := range sorted {
+		h, ok := expected[it.ID]
+		if !ok {
+			orphans = append(orphans, it)
+			continue
+		}
+		if h != it.Hash {
+			return &MismatchHashError{Item: Item{ID: it.ID, Hash: h}, HashInDB: it.Hash}
+		}
+	}
+	if len(orphans) > 0 {
+		return &OrphanedMigrationError{Orphans: orphans}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMigrationVerify(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "create table test.a()",
+		"0002_b.sql", "create table test.b()",
+		"r__v.sql", "create or replace view test.v as select 2",
+	))
+	a := Item{ID: "0001_a.sql", Hash: hash("create table test.a()")}
+
+	if err := m.verify([]Item{a, {ID: "r__v.sql", Hash: "old"}}); err != nil {
+		t.Fatalf("pending and changed repeatable migrations should be accepted, got %v", err)
+	}
+
+	err := m.verify([]Item{a, {ID: "0002_b.sql", Hash: "x"}})
+	var mismatch *MismatchHashError
+	if !errors.As(err, &mismatch) || mismatch.ID != "0002_b.sql" || mismatch.HashInDB != "x" {
+		t.Fatalf("should return MismatchHashError, got %v", err)
+	}
+
+	err = m.verify([]Item{a, {ID: "0000_x.sql", Hash: "x"}})
+	var orphan *OrphanedMigrationError
+	if !errors.As(err, &orphan) || len(orphan.Orphans) != 1 || orphan.Orphans[0].ID != "0000_x.sql" {
+		t.Fatalf("should return OrphanedMigrationError, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	inDB := []Item{
+		{ID: "0002_b.sql", Hash: "b"},
+		{ID: "0001_a.sql", Hash: "a"},
+	}
+
+	t.Run("it should accept matching hashes", func(t *testing.T) {
+		if err := verify(map[string]string{"0001_a.sql": "a", "0002_b.sql": "b", "0003_c.sql": "c"}, inDB); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("it should report drifted hash", func(t *testing.T) {
+		err := verify(map[string]string{"0001_a.sql": "a", "0002_b.sql": "x"}, inDB)
+		var mismatch *MismatchHashError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("should return MismatchHashError, got %v", err)
+		}
+		if mismatch.ID != "0002_b.sql" || mismatch.Hash != "x" || mismatch.HashInDB != "b" {
+			t.Fatalf("invalid error: %#v", mismatch)
+		}
+	})
+
+	t.Run("it should report orphans", func(t *testing.T) {
+		err := verify(map[string]string{}, inDB)
+		var orphan *OrphanedMigrationError
+		if !errors.As(err, &orphan) {
+			t.Fatalf("should return OrphanedMigrationError, got %v", err)
+		}
+		if !reflect.DeepEqual(orphan.Orphans, []Item{{ID: "0001_a.sql", Hash: "a"}, {ID: "0002_b.sql", Hash: "b"}}) {
+			t.Fatalf("invalid orphans: %v", orphan.Orphans)
+		}
+		if msg := err.Error(); msg != `executed migration not found in the source: "0001_a.sql", "0002_b.sql"` {
+			t.Fatalf("invalid message: %s", msg)
+		}
+	})
+}
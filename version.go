@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// versionPrefix return the leading digits of the file name of id, regardless of its directory.
+func versionPrefix(id string) string {
+	id = path.Base(id)
+	i := 0
+	for i < len(id) && '0' <= id[i] && id[i] <= '9' {
+		i++
+	}
+	return id[:i]
+}
+
+// timestampPrefixLen is the length of "yyyymmddhhmmss" prefix, which is not required to be gap-free.
+const timestampPrefixLen = 14
+
+// checkOrdering check the prefixes of the versioned migrations, see Options.StrictOrdering.
+func (m *Migration) checkOrdering() error {
+	var prev string
+	var prevVersion uint64
+	for _, e := range m.entries {
+		if isRepeatable(e.id) {
+			continue
+		}
+		p := versionPrefix(e.id)
+		base := path.Base(e.id)
+		if p == "" || (base[len(p)] != '_' && base[len(p)] != '.') {
+			return &OrderingError{ID: e.id, Previous: prev, Reason: "must start with numeric prefix followed by _"}
+		}
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return &OrderingError{ID: e.id, Previous: prev, Reason: "has too long numeric prefix"}
+		}
+		if prev != "" {
+			switch {
+			case v <= prevVersion:
+				return &OrderingError{ID: e.id, Previous: prev, Reason: "has prefix not greater than the previous one"}
+			case len(p) != timestampPrefixLen && len(versionPrefix(prev)) != timestampPrefixLen && v != prevVersion+1:
+				return &OrderingError{ID: e.id, Previous: prev, Reason: fmt.Sprintf("leave a gap, expected prefix %0*d", len(p), prevVersion+1)}
+			}
+		}
+		prev, prevVersion = e.id, v
+	}
+	return nil
+}
+
+// NextID return the numeric prefix for the next migration file,
+// one more than the biggest numeric prefix of the existing migrations.
+//
+// it is zero padded to the width of the widest existing prefix, but at least 4 digits.
+func (m *Migration) NextID() string {
+	width := 4
+	var max uint64
+	for _, e := range m.entries {
+		p := versionPrefix(e.id)
+		if p == "" {
+			continue
+		}
+		if len(p) > width {
+			width = len(p)
+		}
+		if v, err := strconv.ParseUint(p, 10, 64); err == nil && v > max {
+			max = v
+		}
+	}
+	return fmt.Sprintf("%0*d", width, max+1)
+}
+
+// ByVersion group the migrations by the numeric prefix of their id, each group is in migration order.
+//
+// migrations without numeric prefix (like repeatable ones) are not included.
+// a group with more than one item means some migrations share the same version.
+func (m *Migration) ByVersion() map[int][]Item {
+	ret := make(map[int][]Item)
+	for _, e := range m.entries {
+		v, err := strconv.Atoi(versionPrefix(e.id))
+		if err != nil {
+			continue
+		}
+		ret[v] = append(ret[v], Item{ID: e.id, Hash: e.hash})
+	}
+	return ret
+}
@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNextID(t *testing.T) {
+	tc := []struct {
+		name   string
+		source []string
+		next   string
+	}{
+		{"it should start from 1", nil, "0001"},
+		{"it should increment the biggest prefix", []string{"0001_a.sql", "", "0009_b.sql", "", "r__c.sql", ""}, "0010"},
+		{"it should keep wider prefix", []string{"20220101000000_a.sql", ""}, "20220101000001"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if next := New(testSource(c.source...)).NextID(); next != c.next {
+				t.Fatalf("invalid next id %s, want %s", next, c.next)
+			}
+		})
+	}
+}
+
+func TestByVersion(t *testing.T) {
+	m := New(testSource(
+		"0001_a.sql", "select 1",
+		"0002_b.sql", "select 2",
+		"0002_c.sql", "select 3",
+		"10_d.sql", "select 4",
+		"r__e.sql", "select 5",
+	))
+
+	got := make(map[int][]string)
+	for v, items := range m.ByVersion() {
+		for _, it := range items {
+			got[v] = append(got[v], it.ID)
+		}
+	}
+	want := map[int][]string{
+		1:  {"0001_a.sql"},
+		2:  {"0002_b.sql", "0002_c.sql"},
+		10: {"10_d.sql"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid grouping %v, want %v", got, want)
+	}
+}
+
+func TestStrictOrdering(t *testing.T) {
+	tc := []struct {
+		name     string
+		source   []string
+		id       string
+		previous string
+	}{
+		{"it should accept sequence", []string{"0001_a.sql", "", "0002_b.sql", "", "0003_c.sql", "", "r__v.sql", ""}, "", ""},
+		{"it should accept timestamp", []string{"0001_a.sql", "", "20240101000000_b.sql", "", "20240305070709_c.sql", ""}, "", ""},
+		{"it should accept content-addressed name", []string{"0001.sql", "", "0002.sql", ""}, "", ""},
+		{"it should reject inserted migration", []string{"0001_a.sql", "", "0001a_hotfix.sql", "", "0002_b.sql", ""}, "0001a_hotfix.sql", ""},
+		{"it should reject non-numeric prefix", []string{"0001_a.sql", "", "init.sql", ""}, "init.sql", "0001_a.sql"},
+		{"it should reject duplicate prefix", []string{"0001_a.sql", "", "0001_b.sql", ""}, "0001_b.sql", "0001_a.sql"},
+		{"it should reject gap", []string{"0001_a.sql", "", "0003_c.sql", ""}, "0003_c.sql", "0001_a.sql"},
+		{"it should reject different width", []string{"10_a.sql", "", "9_b.sql", ""}, "9_b.sql", "10_a.sql"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewE(testSource(c.source...), WithStrictOrdering(true))
+			if c.id == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var oerr *OrderingError
+			if !errors.As(err, &oerr) || oerr.ID != c.id || (c.previous != "" && oerr.Previous != c.previous) {
+				t.Fatalf("should return OrderingError for %s, got %v", c.id, err)
+			}
+		})
+	}
+
+	if _, err := NewE(testSource("0001_a.sql", "", "0003_c.sql", "")); err != nil {
+		t.Fatalf("ordering should not be checked by default: %v", err)
+	}
+}